@@ -0,0 +1,141 @@
+package goch
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Account represents user's global profile and credentials, shared
+// between all channels user has joined with it
+type Account struct {
+	UID         string   `json:"uid"`
+	DisplayName string   `json:"display_name"`
+	Email       string   `json:"email"`
+	SecretHash  []byte   `json:"secret_hash,omitempty"`
+	CreatedAt   int64    `json:"created_at"`
+	Channels    []string `json:"channels,omitempty"` // Populated by the store
+}
+
+// Account errors
+var (
+	errInvalidAccount = errors.New("chat: account does not belong to this user")
+	errNotAccount     = errors.New("chat: member is not registered with an account")
+	errAccountMember  = errors.New("chat: member is registered with an account, join with account credentials")
+)
+
+// NewAccount creates new account and returns its secret. If secret
+// is not provided, one is generated.
+func NewAccount(uid, displayName, email, secret string) (*Account, string, error) {
+	if secret == "" {
+		secret = newSecret()
+	}
+	acc := Account{
+		UID:         uid,
+		DisplayName: displayName,
+		Email:       email,
+		CreatedAt:   time.Now().UnixNano(),
+	}
+	if err := acc.SetSecret(secret); err != nil {
+		return nil, "", err
+	}
+	return &acc, secret, nil
+}
+
+// SetSecret hashes secret and stores it on account
+func (a *Account) SetSecret(secret string) error {
+	h, err := hashSecret(secret)
+	if err != nil {
+		return err
+	}
+	a.SecretHash = h
+	return nil
+}
+
+// VerifySecret checks whether secret matches account's secret
+func (a *Account) VerifySecret(secret string) bool {
+	return len(a.SecretHash) > 0 && verifySecret(a.SecretHash, secret)
+}
+
+// Public returns copy of account without credentials
+func (a *Account) Public() *Account {
+	ac := *a
+	ac.SecretHash = nil
+	return &ac
+}
+
+// User returns account's profile as chat user
+func (a *Account) User() *User {
+	return &User{
+		UID:         a.UID,
+		DisplayName: a.DisplayName,
+		Email:       a.Email,
+		Account:     true,
+	}
+}
+
+// RegisterAccount registers account with a chat. Only a reference
+// to the account is stored in chat, profile and credentials are not copied.
+func (c *Chat) RegisterAccount(a *Account) error {
+	if c.IsBanned(a.UID) {
+		return errBanned
+	}
+	if _, ok := c.Members[a.UID]; ok {
+		return errAlreadyRegistered
+	}
+	c.Members[a.UID] = &User{UID: a.UID, Account: true}
+	return nil
+}
+
+// IsAccount checks whether member uid is registered with an account
+func (c *Chat) IsAccount(uid string) bool {
+	u, ok := c.Members[uid]
+	return ok && u.Account
+}
+
+// JoinAccount attempts to join account-registered member to chat,
+// verifying secret against the account
+func (c *Chat) JoinAccount(a *Account, secret string) (*User, error) {
+	if c.Direct {
+		return nil, ErrDirectJoin
+	}
+	if c.IsBanned(a.UID) {
+		return nil, errBanned
+	}
+	u, ok := c.Members[a.UID]
+	if !ok {
+		return nil, errNotRegistered
+	}
+	if !u.Account {
+		return nil, errNotAccount
+	}
+	if !a.VerifySecret(secret) {
+		return nil, ErrInvalidSecret
+	}
+	user := a.User()
+	user.Role = u.Role
+	return user, nil
+}
+
+// Profile fills in profile of account-registered member u from a
+func (u *User) Profile(a *Account) error {
+	if u.UID != a.UID {
+		return errInvalidAccount
+	}
+	u.DisplayName, u.Email = a.DisplayName, a.Email
+	return nil
+}
+
+// DecodeAccount tries to decode binary formatted account in b to Account
+func DecodeAccount(b []byte) (*Account, error) {
+	var a Account
+	if err := decode(b, &a); err != nil {
+		return nil, fmt.Errorf("account: unable to unmarshal account: %v", err)
+	}
+	return &a, nil
+}
+
+// Encode encodes provided account in binary format using DefaultCodec
+func (a *Account) Encode() ([]byte, error) {
+	return encode(a)
+}
@@ -0,0 +1,64 @@
+package goch_test
+
+import (
+	"testing"
+
+	"github.com/ribice/goch"
+)
+
+func TestAccount(t *testing.T) {
+	acc, secret, err := goch.NewAccount("ABC", "John", "john@doe.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 20 || !acc.VerifySecret(secret) || acc.VerifySecret("invalid") {
+		t.Error("expected generated secret to be verified against account")
+	}
+	if acc.Public().SecretHash != nil {
+		t.Error("expected public account not to contain credentials")
+	}
+
+	c := goch.NewChannel("channelName", false)
+	if err = c.RegisterAccount(acc); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.RegisterAccount(acc); err == nil {
+		t.Error("expected error registering account twice")
+	}
+	if m := c.Members["ABC"]; !m.Account || m.DisplayName != "" || m.SecretHash != nil {
+		t.Errorf("expected only account reference to be stored, got %+v", m)
+	}
+
+	if _, err = c.Join("ABC", secret); err == nil {
+		t.Error("expected join without account to fail")
+	}
+	if _, err = c.JoinAccount(acc, "invalid"); err == nil {
+		t.Error("expected join with invalid secret to fail")
+	}
+
+	acc.DisplayName = "Johnny"
+	u, err := c.JoinAccount(acc, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.DisplayName != "Johnny" || u.Email != "john@doe.com" {
+		t.Errorf("expected profile to come from account, got %+v", u)
+	}
+
+	dm := &goch.Chat{Direct: true, Members: c.Members}
+	if _, err = dm.JoinAccount(acc, secret); err == nil {
+		t.Error("expected joining private chat directly to fail")
+	}
+
+	b, err := acc.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, err := goch.DecodeAccount(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dec.VerifySecret(secret) || dec.DisplayName != "Johnny" {
+		t.Errorf("unexpected decoded account %+v", dec)
+	}
+}
@@ -0,0 +1,60 @@
+package goch
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Attachment represents a file attached to a message
+type Attachment struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+	Digest      string `json:"digest"` // Hex encoded SHA-256 of the content
+	UploadedBy  string `json:"uploaded_by"`
+}
+
+// UploadTTL is how long uploaded attachment is kept for if it
+// is not sent with any message, after which its content is deleted
+const UploadTTL = 24 * time.Hour
+
+// attachmentIDSize is number of random bytes in attachment ID. IDs are
+// not guessable, so uploads can't be found by enumerating them.
+const attachmentIDSize = 16
+
+// NewAttachment creates new attachment with unique random ID
+func NewAttachment(name, contentType, uid string) (*Attachment, error) {
+	id := make([]byte, attachmentIDSize)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("attachment: unable to generate id: %v", err)
+	}
+
+	return &Attachment{
+		ID:          hex.EncodeToString(id),
+		Name:        name,
+		ContentType: contentType,
+		UploadedBy:  uid,
+	}, nil
+}
+
+// BlobKey returns key content of chat's attachment id is stored under
+func BlobKey(chat, id string) string {
+	return chat + "." + id
+}
+
+// DecodeAttachment tries to decode binary formatted attachment in b to Attachment
+func DecodeAttachment(b []byte) (*Attachment, error) {
+	var a Attachment
+	if err := decode(b, &a); err != nil {
+		return nil, fmt.Errorf("attachment: unable to unmarshal attachment: %v", err)
+	}
+	return &a, nil
+}
+
+// Encode encodes provided attachment in binary format using DefaultCodec
+func (a *Attachment) Encode() ([]byte, error) {
+	return encode(a)
+}
@@ -0,0 +1,108 @@
+package goch
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Ban represents user banned from a chat
+type Ban struct {
+	UID       string `json:"uid"`
+	BannedBy  string `json:"banned_by"`
+	Reason    string `json:"reason"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Mute represents user which can read but not post to a chat until Until
+type Mute struct {
+	UID     string `json:"uid"`
+	MutedBy string `json:"muted_by"`
+	Until   int64  `json:"until"`
+}
+
+// MaxMuteDuration is the longest time a member can be muted for
+const MaxMuteDuration = 365 * 24 * time.Hour
+
+// Ban errors
+var (
+	errBanned         = errors.New("chat: you are banned from this channel")
+	errNotBanned      = errors.New("chat: user is not banned")
+	errInvalidMute    = errors.New("chat: mute duration must be positive")
+	errSanctionDirect = errors.New("chat: bans and mutes are not supported in private chats")
+	errNotMuted       = errors.New("chat: user is not muted")
+)
+
+// Ban bans uid from chat, removing their membership
+func (c *Chat) Ban(uid, by, reason string) error {
+	if c.Direct {
+		return errSanctionDirect
+	}
+	if c.Bans == nil {
+		c.Bans = make(map[string]*Ban)
+	}
+	c.Bans[uid] = &Ban{UID: uid, BannedBy: by, Reason: reason, CreatedAt: time.Now().UnixNano()}
+	delete(c.Mutes, uid)
+	c.Leave(uid)
+	return nil
+}
+
+// Unban lifts uid's ban
+func (c *Chat) Unban(uid string) error {
+	if _, ok := c.Bans[uid]; !ok {
+		return errNotBanned
+	}
+	delete(c.Bans, uid)
+	return nil
+}
+
+// IsBanned checks whether uid is banned from chat
+func (c *Chat) IsBanned(uid string) bool {
+	_, ok := c.Bans[uid]
+	return ok
+}
+
+// ListBans returns list of bans in chat
+func (c *Chat) ListBans() []*Ban {
+	bans := []*Ban{}
+	for _, b := range c.Bans {
+		bans = append(bans, b)
+	}
+	return bans
+}
+
+// Mute prevents member uid from posting for duration d
+func (c *Chat) Mute(uid, by string, d time.Duration) error {
+	if c.Direct {
+		return errSanctionDirect
+	}
+	if d <= 0 {
+		return errInvalidMute
+	}
+	if _, ok := c.Members[uid]; !ok {
+		return errNotRegistered
+	}
+	if c.Mutes == nil {
+		c.Mutes = make(map[string]*Mute)
+	}
+	c.Mutes[uid] = &Mute{UID: uid, MutedBy: by, Until: time.Now().Add(d).UnixNano()}
+	return nil
+}
+
+// Unmute lifts uid's mute
+func (c *Chat) Unmute(uid string) error {
+	if _, ok := c.Mutes[uid]; !ok {
+		return errNotMuted
+	}
+	delete(c.Mutes, uid)
+	return nil
+}
+
+// muted returns an error if uid is muted at time t
+func (c *Chat) muted(uid string, t time.Time) error {
+	m, ok := c.Mutes[uid]
+	if !ok || t.UnixNano() >= m.Until {
+		return nil
+	}
+	return fmt.Errorf("chat: you are muted until %s", time.Unix(0, m.Until).UTC().Format(time.RFC3339))
+}
@@ -0,0 +1,82 @@
+package goch_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ribice/goch"
+)
+
+func TestBan(t *testing.T) {
+	c := goch.NewChannel("channelName", false)
+	secret, err := c.Register(&goch.User{UID: "ABC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.Ban("ABC", "MOD", "spam"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Members["ABC"]; ok {
+		t.Error("expected banned user to be removed from members")
+	}
+	if _, err = c.Register(&goch.User{UID: "ABC"}); err == nil {
+		t.Error("expected banned user not to be able to register")
+	}
+	if _, err = c.Join("ABC", secret); err == nil || !strings.Contains(err.Error(), "banned") {
+		t.Errorf("expected banned error on join, got %v", err)
+	}
+
+	if err = c.Unban("ABC"); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Unban("ABC"); err == nil {
+		t.Error("expected error unbanning user who is not banned")
+	}
+	if _, err = c.Register(&goch.User{UID: "ABC"}); err != nil {
+		t.Errorf("expected unbanned user to be able to register, got %v", err)
+	}
+
+	dm := &goch.Chat{Direct: true}
+	if err = dm.Ban("ABC", "MOD", ""); err == nil {
+		t.Error("expected bans not to be allowed in private chats")
+	}
+}
+
+func TestMute(t *testing.T) {
+	c := &goch.Chat{
+		Members: map[string]*goch.User{
+			"ABC": &goch.User{UID: "ABC"},
+		},
+	}
+
+	if err := c.Mute("DEF", "MOD", time.Minute); err == nil {
+		t.Error("expected error muting user who is not a member")
+	}
+	if err := c.Mute("ABC", "MOD", 0); err == nil {
+		t.Error("expected error muting with zero duration")
+	}
+	if err := c.Mute("ABC", "MOD", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Authorize("ABC", goch.PostPerm); err == nil || !strings.Contains(err.Error(), "muted until") {
+		t.Errorf("expected muted error, got %v", err)
+	}
+	if err := c.Authorize("ABC", goch.ReadPerm); err != nil {
+		t.Errorf("expected muted user to be able to read, got %v", err)
+	}
+
+	c.Mutes["ABC"].Until = time.Now().Add(-time.Second).UnixNano()
+	if err := c.Authorize("ABC", goch.PostPerm); err != nil {
+		t.Errorf("expected expired mute not to apply, got %v", err)
+	}
+
+	if err := c.Unmute("ABC"); err != nil {
+		t.Error(err)
+	}
+	if err := c.Unmute("ABC"); err == nil {
+		t.Error("expected error unmuting user who is not muted")
+	}
+}
@@ -0,0 +1,63 @@
+package goch
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Bot errors
+var (
+	errNotBot    = errors.New("chat: member is not a bot")
+	errBotMember = errors.New("chat: member is a bot, post with its token instead")
+	errBotToken  = errors.New("chat: invalid bot token")
+)
+
+// RegisterBot registers bot user with a chat and returns its API token.
+// Like secrets of other members, only token's hash is kept in the chat.
+func (c *Chat) RegisterBot(uid, displayName string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("chat: unable to generate bot token: %v", err)
+	}
+
+	return c.Register(&User{
+		UID:         uid,
+		DisplayName: displayName,
+		Secret:      hex.EncodeToString(b),
+		Role:        MemberRole,
+		Bot:         true,
+	})
+}
+
+// RemoveBot removes bot user from chat
+func (c *Chat) RemoveBot(uid string) error {
+	u, ok := c.Members[uid]
+	if !ok {
+		return errNotRegistered
+	}
+	if !u.Bot {
+		return errNotBot
+	}
+	c.Leave(uid)
+	return nil
+}
+
+// IsBot checks whether member uid is a bot
+func (c *Chat) IsBot(uid string) bool {
+	u, ok := c.Members[uid]
+	return ok && u.Bot
+}
+
+// AuthenticateBot verifies bot's token and returns it
+func (c *Chat) AuthenticateBot(uid, token string) (*User, error) {
+	if !c.IsBot(uid) {
+		return nil, errNotBot
+	}
+	u := c.Members[uid]
+	if !u.VerifySecret(token) {
+		return nil, errBotToken
+	}
+	return u.public(), nil
+}
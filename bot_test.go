@@ -0,0 +1,61 @@
+package goch_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ribice/goch"
+)
+
+func TestBot(t *testing.T) {
+	c := goch.NewChannel("channelName", false)
+	token, err := c.RegisterBot("BOT", "Deploy bot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(token) != 64 {
+		t.Errorf("expected 64 characters long token, got %q", token)
+	}
+	if _, err = c.RegisterBot("BOT", "Deploy bot"); err == nil {
+		t.Error("expected error registering bot twice")
+	}
+
+	if _, err = c.Join("BOT", token); err == nil {
+		t.Error("expected bot not to be able to join")
+	}
+	if _, err = c.AuthenticateBot("BOT", "invalid"); err == nil {
+		t.Error("expected authentication with invalid token to fail")
+	}
+
+	u, err := c.AuthenticateBot("BOT", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u.Bot || u.DisplayName != "Deploy bot" || u.SecretHash != nil {
+		t.Errorf("unexpected bot user %+v", u)
+	}
+	if err = c.Authorize("BOT", goch.PostPerm); err != nil {
+		t.Errorf("expected bot to be allowed to post, got %v", err)
+	}
+
+	c.Members["ABC"] = &goch.User{UID: "ABC", Role: goch.OwnerRole}
+	if err = c.Mute("BOT", "ABC", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Authorize("BOT", goch.PostPerm); err == nil {
+		t.Error("expected muted bot not to be allowed to post")
+	}
+
+	if _, err = c.AuthenticateBot("ABC", token); err == nil {
+		t.Error("expected authentication of non-bot member to fail")
+	}
+	if err = c.RemoveBot("ABC"); err == nil {
+		t.Error("expected removing non-bot member to fail")
+	}
+	if err = c.RemoveBot("BOT"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Members["BOT"]; ok {
+		t.Error("expected bot to be removed")
+	}
+}
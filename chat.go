@@ -1,18 +1,23 @@
 package goch
 
 import (
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"regexp"
+	"time"
 
 	"github.com/rs/xid"
-	"github.com/vmihailenco/msgpack"
 )
 
 // NewChannel creates new channel chat
 func NewChannel(name string, private bool) *Chat {
 	ch := Chat{
-		Name:    name,
-		Members: make(map[string]*User),
+		Name:      name,
+		Members:   make(map[string]*User),
+		CreatedAt: time.Now().UnixNano(),
 	}
 
 	if private {
@@ -27,39 +32,161 @@ type Chat struct {
 	Name    string           `json:"name"`
 	Secret  string           `json:"secret"`
 	Members map[string]*User `json:"members"`
+	Direct  bool             `json:"direct"`
+
+	Topic        string `json:"topic"`
+	Description  string `json:"description"`
+	CreatedAt    int64  `json:"created_at"`
+	CreatedBy    string `json:"created_by"`
+	LastActivity int64  `json:"last_activity"`
+	Archived     bool   `json:"archived"` // Archived chats are read-only
+
+	DisableReceipts bool  `json:"disable_receipts"` // Hides members' read positions from each other
+	DefaultTTL      int64 `json:"default_ttl"`      // TTL in seconds of messages sent without one, zero if they never expire
+	InviteOnly      bool  `json:"invite_only"`      // Channel can only be entered with an invite, not its secret
+
+	Bans  map[string]*Ban  `json:"bans,omitempty"`
+	Mutes map[string]*Mute `json:"mutes,omitempty"`
+
+	// Version is incremented by stores on each save, which fails if chat
+	// was saved by someone else since it was loaded
+	Version int64 `json:"version"`
+
+	migrated bool
 }
 
+// ErrChatConflict is returned by stores when chat was modified
+// by someone else since it was loaded
+var ErrChatConflict = errors.New("chat: channel was modified concurrently, try again")
+
 // Chat errors
 var (
 	errAlreadyRegistered = errors.New("chat: uid already registered in this chat")
 	errNotRegistered     = errors.New("chat: not a member of this channel")
-	errInvalidSecret     = errors.New("chat: invalid secret")
+	errPeerNotRegistered = errors.New("chat: peer is not a member of this channel")
+	errDirectSelf        = errors.New("chat: cannot start private chat with yourself")
+	errDirectFromDirect  = errors.New("chat: private chat can only be started from a channel")
+	errNoChannelSecret   = errors.New("chat: channel has no secret")
+)
+
+const directPrefix = "dm_"
+
+// Max length of chat topic and description
+const (
+	MaxTopicLength       = 256
+	MaxDescriptionLength = 1024
 )
 
+var mentionRgx = regexp.MustCompile(`(?:^|[^a-zA-Z0-9_])@([a-zA-Z0-9_]+)`)
+
 // Register registers user with a chat and returns secret which should
-// be stored on the client side, and used for subsequent join requests
+// be stored on the client side, and used for subsequent join requests.
+// Only secret's hash is kept in the chat.
 func (c *Chat) Register(u *User) (string, error) {
+	if c.IsBanned(u.UID) {
+		return "", errBanned
+	}
 	if _, ok := c.Members[u.UID]; ok {
 		return "", errAlreadyRegistered
 	}
-	if u.Secret == "" {
-		u.Secret = newSecret()
+	secret := u.Secret
+	if secret == "" {
+		secret = newSecret()
+	}
+	if err := u.SetSecret(secret); err != nil {
+		return "", err
 	}
 	c.Members[u.UID] = u
-	return u.Secret, nil
+	return secret, nil
 }
 
-// Join attempts to join user to chat
+// Join attempts to join user to chat. Plaintext secrets of members
+// registered before hashing was introduced are replaced by their hash,
+// in which case Migrated reports true and chat should be saved.
 func (c *Chat) Join(uid, secret string) (*User, error) {
+	// Private chats keep no credentials, members join
+	// the channel they share instead
+	if c.Direct {
+		return nil, ErrDirectJoin
+	}
+	if c.IsBanned(uid) {
+		return nil, errBanned
+	}
 	u, ok := c.Members[uid]
 	if !ok {
 		return nil, errNotRegistered
 	}
-	if u.Secret != secret {
-		return nil, errInvalidSecret
+	if u.Account {
+		return nil, errAccountMember
+	}
+	if u.Bot {
+		return nil, errBotMember
+	}
+	if !u.VerifySecret(secret) {
+		return nil, ErrInvalidSecret
+	}
+	if len(u.SecretHash) == 0 {
+		if err := u.SetSecret(secret); err != nil {
+			return nil, err
+		}
+		c.migrated = true
+	}
+	return u.public(), nil
+}
+
+// Migrated reports whether any member's plaintext secret was hashed since chat was loaded
+func (c *Chat) Migrated() bool {
+	return c.migrated
+}
+
+// RotateSecret replaces member's secret with next, or a generated
+// one if next is empty, and returns it. Current secret has to be provided.
+func (c *Chat) RotateSecret(uid, secret, next string) (string, error) {
+	if _, err := c.Join(uid, secret); err != nil {
+		return "", err
+	}
+	if next == "" {
+		next = newSecret()
+	}
+	if err := c.Members[uid].SetSecret(next); err != nil {
+		return "", err
+	}
+	return next, nil
+}
+
+// ErrInvalidSecret is returned when secret does not match member's or channel's
+var ErrInvalidSecret = errors.New("chat: invalid secret")
+
+// ErrDirectJoin is returned when private chat is joined directly. Private
+// chats keep no credentials, so they are opened through a channel instead.
+var ErrDirectJoin = errors.New("chat: private chat can only be opened from a channel")
+
+// ErrInviteOnly is returned when invite-only channel is entered with its secret
+var ErrInviteOnly = errors.New("chat: channel can only be entered with an invite")
+
+// VerifyChannelSecret checks whether secret is channel's secret.
+// Invite-only channels and private chats can not be entered with a secret.
+func (c *Chat) VerifyChannelSecret(secret string) error {
+	if c.Direct {
+		return ErrInvalidSecret
+	}
+	if c.InviteOnly {
+		return ErrInviteOnly
+	}
+	if subtle.ConstantTimeCompare([]byte(c.Secret), []byte(secret)) != 1 {
+		return ErrInvalidSecret
 	}
-	u.Secret = ""
-	return u, nil
+	return nil
+}
+
+// RotateChannelSecret replaces channel's secret with a generated one and
+// returns it, so the previous secret can no longer be used to enter it
+func (c *Chat) RotateChannelSecret() (string, error) {
+	if c.Direct || c.Secret == "" {
+		return "", errNoChannelSecret
+	}
+	c.Secret = newSecret()
+	return c.Secret, nil
 }
 
 // Leave removes user from channel
@@ -71,6 +198,14 @@ func newSecret() string {
 	return xid.New().String()
 }
 
+// MessageTTL returns TTL for message sent with ttl, which is chat's default if ttl is zero
+func (c *Chat) MessageTTL(ttl int64) int64 {
+	if ttl == 0 {
+		return c.DefaultTTL
+	}
+	return ttl
+}
+
 // ListMembers returns list of members associated to a chat
 func (c *Chat) ListMembers() []*User {
 	if len(c.Members) < 1 {
@@ -78,24 +213,106 @@ func (c *Chat) ListMembers() []*User {
 	}
 	var members []*User
 	for _, u := range c.Members {
-		u.Secret = ""
-		members = append(members, u)
+		members = append(members, u.public())
 	}
 	return members
 }
 
-// DecodeChat tries to decode binary formatted message in b to Message
+// Mentions returns unique uids of chat members mentioned as @uid in text
+func (c *Chat) Mentions(text string) []string {
+	var uids []string
+	seen := make(map[string]bool)
+	for _, m := range mentionRgx.FindAllStringSubmatch(text, -1) {
+		uid := m[1]
+		if _, ok := c.Members[uid]; !ok || seen[uid] {
+			continue
+		}
+		seen[uid] = true
+		uids = append(uids, uid)
+	}
+	return uids
+}
+
+// MentionedBy returns chat members mentioned in text
+// written by uid, excluding uid itself
+func (c *Chat) MentionedBy(uid, text string) []string {
+	var uids []string
+	for _, m := range c.Mentions(text) {
+		if m != uid {
+			uids = append(uids, m)
+		}
+	}
+	return uids
+}
+
+// DecodeChat tries to decode binary formatted chat in b to Chat.
+// Both enveloped and legacy msgpack formats are supported.
 func DecodeChat(b string) (*Chat, error) {
 	var c Chat
-	if err := msgpack.Unmarshal([]byte(b), &c); err != nil {
+	if err := decode([]byte(b), &c); err != nil {
 		return nil, fmt.Errorf("client: unable to unmarshal chat: %v", err)
 	}
 	return &c, nil
 }
 
-// Encode encodes provided chat in binary format
+// Encode encodes provided chat in binary format using DefaultCodec
 func (c *Chat) Encode() ([]byte, error) {
-	return msgpack.Marshal(c)
+	return encode(c)
 }
 
-// TODO: Private chats (can only init private chat with people in the same channel)
+// NewDirect creates private chat between two members of channel c.
+// Private chat's name is deterministic, see DirectID. Members' secrets
+// are not copied, private chats are opened from a channel both are in.
+func (c *Chat) NewDirect(uid, peer string) (*Chat, error) {
+	if c.Direct {
+		return nil, errDirectFromDirect
+	}
+	if uid == peer {
+		return nil, errDirectSelf
+	}
+	u, ok := c.Members[uid]
+	if !ok {
+		return nil, errNotRegistered
+	}
+	p, ok := c.Members[peer]
+	if !ok {
+		return nil, errPeerNotRegistered
+	}
+
+	uc, pc := u.public(), p.public()
+	uc.Role, pc.Role = MemberRole, MemberRole
+
+	return &Chat{
+		Name:      DirectID(uid, peer),
+		Direct:    true,
+		CreatedAt: time.Now().UnixNano(),
+		CreatedBy: uid,
+		Members: map[string]*User{
+			uid:  uc,
+			peer: pc,
+		},
+	}, nil
+}
+
+// Peer returns the other member of private chat
+func (c *Chat) Peer(uid string) *User {
+	if !c.Direct {
+		return nil
+	}
+	for id, u := range c.Members {
+		if id != uid {
+			return u
+		}
+	}
+	return nil
+}
+
+// DirectID returns private chat name for provided pair of uids.
+// The result does not depend on the order of uids.
+func DirectID(uid, peer string) string {
+	if uid > peer {
+		uid, peer = peer, uid
+	}
+	sum := sha1.Sum([]byte(uid + ":" + peer))
+	return directPrefix + hex.EncodeToString(sum[:])
+}
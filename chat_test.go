@@ -59,19 +59,24 @@ func TestRegister(t *testing.T) {
 			if tc.c == nil {
 				t.Error("Chat has to be instantiated")
 			}
+			reqSecret := tc.req.Secret
 			secret, err := tc.c.Register(tc.req)
 			if err != nil && tc.wantErr != err.Error() {
 				t.Errorf("expected err %s but got %s", tc.wantErr, err.Error())
 			}
 
 			if tc.wantErr == "" {
-				if tc.req.Secret != "" {
-					if secret != tc.req.Secret {
-						t.Errorf("expected secret %s but got %s", tc.req.Secret, secret)
+				if reqSecret != "" {
+					if secret != reqSecret {
+						t.Errorf("expected secret %s but got %s", reqSecret, secret)
 					}
 				} else if len(secret) != 20 {
 					t.Errorf("expected len to be 20 but got %v", len(secret))
 				}
+				u := tc.c.Members[tc.req.UID]
+				if u.Secret != "" || !u.VerifySecret(secret) {
+					t.Error("expected only hashed secret to be stored")
+				}
 			}
 
 		})
@@ -108,6 +113,18 @@ func TestJoin(t *testing.T) {
 			secret:  "secret1",
 			wantErr: "chat: invalid secret",
 		},
+		{
+			name: "Private chat",
+			c: &goch.Chat{
+				Direct: true,
+				Members: map[string]*goch.User{
+					"ABC": &goch.User{Secret: "secret1"},
+				},
+			},
+			uid:     "ABC",
+			secret:  "secret1",
+			wantErr: "chat: private chat can only be opened from a channel",
+		},
 		{
 			name: "Success",
 			c: &goch.Chat{
@@ -137,6 +154,54 @@ func TestJoin(t *testing.T) {
 	}
 }
 
+func TestJoinMigratesSecret(t *testing.T) {
+	c := &goch.Chat{
+		Members: map[string]*goch.User{
+			"ABC": &goch.User{UID: "ABC", Secret: "secret1"},
+		},
+	}
+	if _, err := c.Join("ABC", "secret2"); err == nil || c.Migrated() {
+		t.Fatal("expected invalid secret not to be migrated")
+	}
+	if _, err := c.Join("ABC", "secret1"); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Migrated() {
+		t.Error("expected chat to be migrated")
+	}
+	u := c.Members["ABC"]
+	if u.Secret != "" || len(u.SecretHash) == 0 {
+		t.Errorf("expected plaintext secret to be replaced by hash, got %+v", u)
+	}
+	if _, err := c.Join("ABC", "secret1"); err != nil {
+		t.Errorf("expected join with hashed secret to succeed, got %v", err)
+	}
+}
+
+func TestRotateSecret(t *testing.T) {
+	c := goch.NewChannel("channelName", false)
+	old, err := c.Register(&goch.User{UID: "ABC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.RotateSecret("ABC", "invalid", ""); err == nil {
+		t.Error("expected rotation with invalid secret to fail")
+	}
+	next, err := c.RotateSecret("ABC", old, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == old || len(next) != 20 {
+		t.Errorf("expected new generated secret, got %s", next)
+	}
+	if _, err := c.Join("ABC", old); err == nil {
+		t.Error("expected old secret to be rejected")
+	}
+	if _, err := c.Join("ABC", next); err != nil {
+		t.Errorf("expected new secret to be accepted, got %v", err)
+	}
+}
+
 func TestLeave(t *testing.T) {
 	c := &goch.Chat{
 		Members: map[string]*goch.User{
@@ -192,3 +257,136 @@ func TestChatEncode(t *testing.T) {
 		t.Error("expected error but received nil")
 	}
 }
+
+func TestNewDirect(t *testing.T) {
+	cases := []struct {
+		name    string
+		c       *goch.Chat
+		uid     string
+		peer    string
+		wantErr string
+	}{
+		{
+			name:    "Direct chat from direct chat",
+			c:       &goch.Chat{Direct: true},
+			uid:     "ABC",
+			peer:    "DEF",
+			wantErr: "chat: private chat can only be started from a channel",
+		},
+		{
+			name:    "Chat with yourself",
+			c:       &goch.Chat{},
+			uid:     "ABC",
+			peer:    "ABC",
+			wantErr: "chat: cannot start private chat with yourself",
+		},
+		{
+			name: "User not registered",
+			c: &goch.Chat{
+				Members: map[string]*goch.User{
+					"DEF": &goch.User{UID: "DEF"},
+				},
+			},
+			uid:     "ABC",
+			peer:    "DEF",
+			wantErr: "chat: not a member of this channel",
+		},
+		{
+			name: "Peer not registered",
+			c: &goch.Chat{
+				Members: map[string]*goch.User{
+					"ABC": &goch.User{UID: "ABC"},
+				},
+			},
+			uid:     "ABC",
+			peer:    "DEF",
+			wantErr: "chat: peer is not a member of this channel",
+		},
+		{
+			name: "Success",
+			c: &goch.Chat{
+				Members: map[string]*goch.User{
+					"ABC": &goch.User{UID: "ABC", DisplayName: "John", Secret: "secret1"},
+					"DEF": &goch.User{UID: "DEF", DisplayName: "Jane", SecretHash: []byte("hash")},
+					"GHI": &goch.User{UID: "GHI"},
+				},
+			},
+			uid:  "ABC",
+			peer: "DEF",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dm, err := tc.c.NewDirect(tc.uid, tc.peer)
+			if err != nil {
+				if tc.wantErr != err.Error() {
+					t.Errorf("expected err %s but got %s", tc.wantErr, err.Error())
+				}
+				return
+			}
+			if tc.wantErr != "" {
+				t.Fatalf("expected err %s but got nil", tc.wantErr)
+			}
+			if !dm.Direct || dm.Secret != "" {
+				t.Error("expected private chat without secret")
+			}
+			for _, u := range dm.Members {
+				if u.Secret != "" || u.SecretHash != nil {
+					t.Errorf("expected members' secrets not to be copied, got %v", u)
+				}
+			}
+			if dm.Name != goch.DirectID(tc.peer, tc.uid) {
+				t.Errorf("unexpected chat name %s", dm.Name)
+			}
+			if len(dm.Members) != 2 {
+				t.Errorf("expected 2 members but got %v", len(dm.Members))
+			}
+			if p := dm.Peer(tc.uid); p == nil || p.UID != tc.peer {
+				t.Errorf("expected peer %s but got %v", tc.peer, p)
+			}
+		})
+	}
+}
+
+func TestDirectID(t *testing.T) {
+	if goch.DirectID("ABC", "DEF") != goch.DirectID("DEF", "ABC") {
+		t.Error("expected direct id to be independent of uid order")
+	}
+	if goch.DirectID("ABC", "DEF") == goch.DirectID("ABC", "DEG") {
+		t.Error("expected different direct ids for different peers")
+	}
+}
+
+func TestMentions(t *testing.T) {
+	c := &goch.Chat{
+		Members: map[string]*goch.User{
+			"john": {UID: "john"},
+			"jane": {UID: "jane"},
+		},
+	}
+	got := c.Mentions("@john hey, @stranger and @jane! cc @john, mail john@jane.com")
+	want := []string{"john", "jane"}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("expected mentions %v but got %v", want, got)
+	}
+	if m := c.Mentions("no mentions here"); m != nil {
+		t.Errorf("expected no mentions but got %v", m)
+	}
+}
+
+func TestMentionedBy(t *testing.T) {
+	c := &goch.Chat{
+		Members: map[string]*goch.User{
+			"john": {UID: "john"},
+			"jane": {UID: "jane"},
+		},
+	}
+	got := c.MentionedBy("john", "@john and @jane")
+	want := []string{"jane"}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("expected mentions %v but got %v", want, got)
+	}
+	if m := c.MentionedBy("john", "note to self @john"); m != nil {
+		t.Errorf("expected author not to be mentioned but got %v", m)
+	}
+}
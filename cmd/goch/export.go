@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/ribice/goch/internal/export"
+	"github.com/ribice/goch/pkg/config"
+	"github.com/ribice/goch/pkg/nats"
+	"github.com/ribice/goch/pkg/redis"
+)
+
+// runExport exports channel history to a file or stdout, e.g.
+// goch -config ./conf.yaml export -channel general -format md -out general.md
+func runExport(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	chanName := fs.String("channel", "", "Name of channel to export")
+	formatName := fs.String("format", string(export.JSONLines), "Export format: jsonl, md or html")
+	out := fs.String("out", "", "Path to output file, defaults to stdout")
+	fs.Parse(args)
+
+	if *chanName == "" {
+		return errors.New("export: channel must be provided")
+	}
+
+	format, err := export.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+
+	// Separate client id avoids clashing with a running server's connection
+	mq, err := nats.New(cfg.NATS.ClusterID, cfg.NATS.ClientID+"-export", cfg.NATS.URL)
+	if err != nil {
+		return err
+	}
+
+	store, err := redis.New(cfg.Redis.Address, cfg.Redis.Password, cfg.Redis.Port)
+	if err != nil {
+		return err
+	}
+
+	f := os.Stdout
+	if *out != "" {
+		if f, err = os.Create(*out); err != nil {
+			return err
+		}
+		defer f.Close()
+	}
+
+	w := bufio.NewWriter(f)
+	if err = export.New(mq, store).Export(w, *chanName, format); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
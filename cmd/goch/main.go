@@ -6,17 +6,25 @@ import (
 
 	"github.com/ribice/msv/middleware/bauth"
 
+	"github.com/ribice/goch"
+
 	"github.com/ribice/goch/internal/chat"
 
 	"github.com/ribice/goch/internal/agent"
 
 	"github.com/ribice/goch/internal/broker"
+	"github.com/ribice/goch/internal/export"
 	"github.com/ribice/goch/internal/ingest"
+	"github.com/ribice/goch/internal/moderation"
+	"github.com/ribice/goch/internal/scheduler"
+	"github.com/ribice/goch/internal/webhook"
 
+	"github.com/ribice/goch/pkg/blob"
 	"github.com/ribice/goch/pkg/config"
 
 	"github.com/ribice/goch/pkg/nats"
 	"github.com/ribice/goch/pkg/redis"
+	"github.com/ribice/goch/pkg/search"
 	"github.com/ribice/msv"
 )
 
@@ -25,6 +33,15 @@ func main() {
 	flag.Parse()
 	cfg, err := config.Load(*cfgPath)
 	checkErr(err)
+	if cfg.Codec != "" {
+		goch.DefaultCodec, _ = goch.CodecByName(cfg.Codec)
+	}
+
+	if flag.Arg(0) == "export" {
+		checkErr(runExport(cfg, flag.Args()[1:]))
+		return
+	}
+
 	mq, err := nats.New(cfg.NATS.ClusterID, cfg.NATS.ClientID, cfg.NATS.URL)
 	checkErr(err)
 	store, err := redis.New(cfg.Redis.Address, cfg.Redis.Password, cfg.Redis.Port)
@@ -33,12 +50,53 @@ func main() {
 	srv, mux := msv.New("goch")
 	aMW := bauth.New(cfg.Admin.Username, cfg.Admin.Password, "GOCH")
 
-	agent.NewAPI(mux, broker.New(mq, store, ingest.New(mq, store)), store, cfg)
-	chat.New(mux, store, cfg, aMW.MWFunc)
+	var idx searchIndex = redis.NewSearchIndex(store)
+	if cfg.Search == "memory" {
+		idx = search.NewMemory()
+	}
+
+	mod, err := moderation.New(cfg.Moderation)
+	checkErr(err)
+
+	var blobs ingest.BlobStore
+	if cfg.Blob != nil {
+		bs, err := blob.NewLocal(cfg.Blob.Dir)
+		checkErr(err)
+		chat.NewAttachmentAPI(mux, store, bs, cfg.AttachmentLimit)
+		blobs = bs
+	}
+
+	ig := ingest.New(mq, store, idx, blobs)
+	br := broker.New(mq, store, ig)
+
+	agent.NewAPI(mux, br, store, cfg, mod)
+	chat.New(mux, store, br, cfg, aMW.MWFunc)
+	chat.NewSearchAPI(mux, store, idx)
+	chat.NewExportAPI(mux, export.New(mq, store), cfg, aMW.MWFunc)
+	chat.NewBotAPI(mux, store, br, mod, cfg, cfg.BotRateLimit, aMW.MWFunc)
+	chat.NewScheduleAPI(mux, store, mod)
+
+	stop := webhook.New(mq, store, cfg.Webhooks).Run()
+	defer stop()
+
+	stopScheduler := scheduler.New(store, br).Run()
+	defer stopScheduler()
+
+	stopIngest := ig.Run()
+	defer stopIngest()
+
+	stopExpiry := ig.RunExpiry()
+	defer stopExpiry()
 
 	srv.Start()
 }
 
+// searchIndex represents message search index, used both by ingest and search api
+type searchIndex interface {
+	ingest.Indexer
+	chat.Searcher
+}
+
 func checkErr(err error) {
 	if err != nil {
 		log.Fatal(err)
@@ -0,0 +1,125 @@
+package goch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+// Codec represents wire and storage format of messages and chats
+type Codec interface {
+	ID() byte
+	Name() string
+	Marshal(interface{}) ([]byte, error)
+	Unmarshal([]byte, interface{}) error
+}
+
+// Codec IDs written to envelope header
+const (
+	MsgpackCodecID byte = iota + 1
+	JSONCodecID
+	ProtobufCodecID // Reserved
+)
+
+// Encoded data is wrapped in an envelope: magic byte, envelope version and codec ID,
+// followed by the payload. 0xc1 is never used by msgpack, so enveloped data can't be
+// mistaken for legacy (unversioned msgpack) data.
+const (
+	envelopeMagic   byte = 0xc1
+	envelopeVersion byte = 1
+	envelopeSize         = 3
+)
+
+// Codec errors
+var (
+	errUnknownCodec        = errors.New("codec: unknown codec")
+	errUnsupportedEnvelope = errors.New("codec: unsupported envelope version")
+)
+
+var codecs = map[byte]Codec{
+	MsgpackCodecID: MsgpackCodec{},
+	JSONCodecID:    JSONCodec{},
+}
+
+// DefaultCodec is used for encoding messages and chats.
+// Decoding supports all registered codecs regardless of DefaultCodec.
+var DefaultCodec Codec = MsgpackCodec{}
+
+// RegisterCodec registers codec for decoding. It should be called on init.
+func RegisterCodec(c Codec) {
+	codecs[c.ID()] = c
+}
+
+// CodecByName returns registered codec with provided name
+func CodecByName(name string) (Codec, error) {
+	for _, c := range codecs {
+		if c.Name() == name {
+			return c, nil
+		}
+	}
+	return nil, errUnknownCodec
+}
+
+// MsgpackCodec encodes data using msgpack
+type MsgpackCodec struct{}
+
+// ID returns codec's ID
+func (MsgpackCodec) ID() byte { return MsgpackCodecID }
+
+// Name returns codec's name
+func (MsgpackCodec) Name() string { return "msgpack" }
+
+// Marshal encodes v in msgpack format
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error) { return msgpack.Marshal(v) }
+
+// Unmarshal decodes msgpack formatted b into v
+func (MsgpackCodec) Unmarshal(b []byte, v interface{}) error { return msgpack.Unmarshal(b, v) }
+
+// JSONCodec encodes data using JSON
+type JSONCodec struct{}
+
+// ID returns codec's ID
+func (JSONCodec) ID() byte { return JSONCodecID }
+
+// Name returns codec's name
+func (JSONCodec) Name() string { return "json" }
+
+// Marshal encodes v in JSON format
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+// Unmarshal decodes JSON formatted b into v
+func (JSONCodec) Unmarshal(b []byte, v interface{}) error { return json.Unmarshal(b, v) }
+
+// encode encodes v with DefaultCodec and wraps it in an envelope
+func encode(v interface{}) ([]byte, error) {
+	c := DefaultCodec
+	data, err := c.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, envelopeSize, envelopeSize+len(data))
+	b[0], b[1], b[2] = envelopeMagic, envelopeVersion, c.ID()
+
+	return append(b, data...), nil
+}
+
+// decode decodes enveloped or legacy msgpack formatted b into v
+func decode(b []byte, v interface{}) error {
+	if len(b) == 0 || b[0] != envelopeMagic {
+		return msgpack.Unmarshal(b, v)
+	}
+
+	if len(b) < envelopeSize || b[1] != envelopeVersion {
+		return errUnsupportedEnvelope
+	}
+
+	c, ok := codecs[b[2]]
+	if !ok {
+		return fmt.Errorf("%v: %d", errUnknownCodec, b[2])
+	}
+
+	return c.Unmarshal(b[envelopeSize:], v)
+}
@@ -0,0 +1,94 @@
+package goch_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ribice/goch"
+	"github.com/vmihailenco/msgpack"
+)
+
+func TestDecodeLegacy(t *testing.T) {
+	m := &goch.Message{Time: 123, Seq: 1, Text: "Hello World", FromUID: "ABC", FromName: "User1"}
+	bts, err := msgpack.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := goch.DecodeMsg(bts)
+	if err != nil {
+		t.Errorf("did not expect error but received: %v", err)
+	}
+	if !reflect.DeepEqual(m, msg) {
+		t.Errorf("expected msg %v but got %v", m, msg)
+	}
+
+	c := &goch.Chat{Name: "legacy", Secret: "secret", Members: map[string]*goch.User{"ABC": {UID: "ABC"}}}
+	bts, err = msgpack.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := goch.DecodeChat(string(bts))
+	if err != nil {
+		t.Errorf("did not expect error but received: %v", err)
+	}
+	if !reflect.DeepEqual(c, ch) {
+		t.Errorf("expected chat %v but got %v", c, ch)
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	defer func(c goch.Codec) { goch.DefaultCodec = c }(goch.DefaultCodec)
+
+	m := &goch.Message{Time: 123, Seq: 1, Text: "Hello World", FromUID: "ABC", FromName: "User1", Meta: map[string]string{"foo": "bar"}}
+
+	for _, name := range []string{"msgpack", "json"} {
+		t.Run(name, func(t *testing.T) {
+			c, err := goch.CodecByName(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			goch.DefaultCodec = c
+
+			bts, err := m.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bts[2] != c.ID() {
+				t.Errorf("expected codec id %d but got %d", c.ID(), bts[2])
+			}
+
+			// Decoding does not depend on the default codec
+			goch.DefaultCodec = goch.MsgpackCodec{}
+
+			msg, err := goch.DecodeMsg(bts)
+			if err != nil {
+				t.Errorf("did not expect error but received: %v", err)
+			}
+			if !reflect.DeepEqual(m, msg) {
+				t.Errorf("expected msg %v but got %v", m, msg)
+			}
+		})
+	}
+
+	if _, err := goch.CodecByName("xml"); err == nil {
+		t.Error("expected error but received nil")
+	}
+}
+
+func TestDecodeEnvelopeErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{name: "Truncated envelope", data: []byte{0xc1}},
+		{name: "Unsupported version", data: []byte{0xc1, 9, goch.MsgpackCodecID}},
+		{name: "Unknown codec", data: []byte{0xc1, 1, goch.ProtobufCodecID}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := goch.DecodeMsg(tc.data); err == nil {
+				t.Error("expected error but received nil")
+			}
+		})
+	}
+}
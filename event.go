@@ -0,0 +1,56 @@
+package goch
+
+import "fmt"
+
+// EventType represents type of ephemeral chat event
+type EventType int
+
+// Event types
+const (
+	PresenceEvent EventType = iota + 1
+	TypingEvent
+	ReceiptEvent
+	ChatUpdateEvent // Chat membership or settings changed, and should be reloaded
+)
+
+// Status represents member's presence status
+type Status string
+
+// Presence statuses
+const (
+	OnlineStatus  Status = "online"
+	AwayStatus    Status = "away"
+	OfflineStatus Status = "offline"
+)
+
+// Valid checks whether s is a known presence status
+func (s Status) Valid() bool {
+	return s == OnlineStatus || s == AwayStatus || s == OfflineStatus
+}
+
+// Event represents ephemeral chat event. Unlike messages, events
+// are delivered only to currently connected clients and are not
+// stored in chat history.
+type Event struct {
+	Type   EventType `json:"type"`
+	UID    string    `json:"uid"`
+	Status Status    `json:"status,omitempty"`
+	Typing bool      `json:"typing,omitempty"`
+	Until  int64     `json:"until,omitempty"` // Typing indicator expiration, if not refreshed
+	Seq    uint64    `json:"seq,omitempty"`   // Last message read by UID
+	Time   int64     `json:"time"`
+}
+
+// DecodeEvent tries to decode binary formatted event in b to Event
+func DecodeEvent(b []byte) (*Event, error) {
+	var e Event
+	if err := decode(b, &e); err != nil {
+		return nil, fmt.Errorf("event: unable to unmarshal event: %v", err)
+	}
+	return &e, nil
+}
+
+// Encode encodes provided event in binary format using DefaultCodec
+func (e *Event) Encode() ([]byte, error) {
+	return encode(e)
+}
@@ -2,21 +2,26 @@ package agent
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ribice/goch"
-
-	"github.com/gorilla/websocket"
 )
 
 // New creates new connection agent instance
-func New(mb MessageBroker, store ChatStore) *Agent {
+func New(mb MessageBroker, store ChatStore, mod Moderator, clock Clock) *Agent {
 	return &Agent{
-		mb:    mb,
-		store: store,
-		done:  make(chan struct{}, 1),
+		mb:     mb,
+		store:  store,
+		mod:    mod,
+		clock:  clock,
+		done:   make(chan struct{}, 1),
+		status: make(chan goch.Status, 1),
+		typing: make(chan bool, 1),
 	}
 }
 
@@ -26,20 +31,80 @@ type Agent struct {
 	uid         string
 	displayName string
 	done        chan struct{}
+	status      chan goch.Status
+	typing      chan bool
 	closeSub    func()
-	closed      bool
+	closeEvents func()
+
+	// Kept up to date on chat update events, unlike chat
+	disableReceipts bool
 
-	conn *websocket.Conn
-	mb   MessageBroker
+	conn  Conn
+	mb    MessageBroker
+	clock Clock
 
 	store ChatStore
+	mod   Moderator
+}
+
+// Conn represents client connection, such as *websocket.Conn
+type Conn interface {
+	NextReader() (int, io.Reader, error)
+	WriteJSON(interface{}) error
+	Close() error
+}
+
+// syncConn serializes writes to Conn, which is written to both by
+// the goroutine reading client messages and the one pushing updates
+type syncConn struct {
+	Conn
+	mu sync.Mutex
 }
 
+func (c *syncConn) WriteJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Conn.WriteJSON(v)
+}
+
+// Clock represents time source used for throttling and expiring
+// connection state, such as typing indicators and read receipts
+type Clock interface {
+	Now() time.Time
+	After(time.Duration) <-chan time.Time
+}
+
+// SystemClock is Clock reading system time
+type SystemClock struct{}
+
+// Now returns current system time
+func (SystemClock) Now() time.Time { return time.Now() }
+
+// After waits for d to elapse, see time.After
+func (SystemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
 // ChatStore represents chat store interface
 type ChatStore interface {
 	Get(string) (*goch.Chat, error)
+	Save(*goch.Chat) error
 	GetRecent(string, int64) ([]goch.Message, uint64, error)
+	GetThread(string, uint64) ([]goch.Message, error)
+	GetPinned(string) ([]goch.Message, error)
+	ReplyCounts(string, []uint64) (map[uint64]uint64, error)
+	Reactions(string, []uint64) (map[uint64][]goch.Reaction, error)
+	GetAttachment(string, string) (*goch.Attachment, error)
+	GetAccount(string) (*goch.Account, error)
+	RemoveAccountChannel(string, string) error
+	SaveInvite(*goch.Invite) error
+	Presence(string, []string) (map[string]goch.Status, error)
 	UpdateLastClientSeq(string, string, uint64)
+	SetPresence(string, string, goch.Status, time.Duration) error
+	AddPresence(string, string, goch.Status, time.Duration) error
+	ClearPresence(string, string) (bool, error)
+	ScheduleMessage(*goch.Scheduled) error
+	GetScheduled(string, string) (*goch.Scheduled, error)
+	ListScheduled(string, string) ([]*goch.Scheduled, error)
+	CancelScheduled(string, string) error
 }
 
 // MessageBroker represents broker interface
@@ -47,6 +112,13 @@ type MessageBroker interface {
 	Subscribe(string, string, uint64, chan *goch.Message) (func(), error)
 	SubscribeNew(string, string, chan *goch.Message) (func(), error)
 	Send(string, *goch.Message) error
+	SendEvent(string, *goch.Event) error
+	SubscribeEvents(string, string, chan *goch.Event) (func(), error)
+}
+
+// Moderator represents outgoing message moderation interface
+type Moderator interface {
+	Moderate(string, *goch.Message) error
 }
 
 type msgT int
@@ -57,12 +129,36 @@ const (
 	errorMsg
 	infoMsg
 	historyReqMsg
+	editMsg
+	deleteMsg
+	threadReqMsg
+	threadMsg
+	reactionMsg
+	presenceMsg
+	typingMsg
+	receiptMsg
+	pinMsg
+	pinnedMsg
+	scheduledReqMsg
+	scheduledMsg
+	cancelScheduledMsg
+	expireMsg
 )
 
 const (
-	maxHistoryCount uint64 = 512
+	maxHistoryCount   uint64 = 512
+	maxEmojiLength           = 32
+	maxAttachments           = 10
+	fetchTimeout             = 5 * time.Second
+	heartbeatInterval        = 30 * time.Second
+	presenceTTL              = 3 * heartbeatInterval
+	typingThrottle           = 2 * time.Second
+	typingTTL                = 5 * time.Second
+	receiptThrottle          = time.Second
 )
 
+var errMsgNotFound = errors.New("message not found")
+
 type msg struct {
 	Type  msgT        `json:"type"`
 	Data  interface{} `json:"data,omitempty"`
@@ -70,14 +166,9 @@ type msg struct {
 }
 
 // HandleConn handles websocket communication for requested chat/client
-func (a *Agent) HandleConn(conn *websocket.Conn, req *initConReq) {
-	a.conn = conn
-
-	a.conn.SetCloseHandler(func(code int, text string) error {
-		a.closed = true
-		a.done <- struct{}{}
-		return nil
-	})
+func (a *Agent) HandleConn(conn Conn, req *ConnReq) {
+	// Connection supports only one concurrent writer
+	a.conn = &syncConn{Conn: conn}
 
 	ct, err := a.store.Get(req.Channel)
 	if err != nil {
@@ -90,26 +181,45 @@ func (a *Agent) HandleConn(conn *websocket.Conn, req *initConReq) {
 	// 	return
 	// }
 
-	user, err := ct.Join(req.UID, req.Secret)
+	user, err := a.join(ct, req.UID, req.Secret)
 	if err != nil {
 		writeFatal(a.conn, fmt.Sprintf("agent: unable to join chat: %v", err))
 		return
 	}
 
+	if ct.Migrated() {
+		// Failing to persist hashed secret is not fatal, it will be retried on next join
+		if err = a.store.Save(ct); err != nil {
+			writeErr(a.conn, fmt.Sprintf("agent: unable to update chat membership: %v", err))
+		}
+	}
+
+	if req.Peer != "" {
+		if ct, err = a.openDirect(ct, user.UID, req.Peer); err != nil {
+			writeFatal(a.conn, fmt.Sprintf("agent: unable to open private chat: %v", err))
+			return
+		}
+	}
+
 	a.chat = ct
+	a.disableReceipts = ct.DisableReceipts
 	a.setUser(user)
 
+	if err = a.pushPinned(); err != nil {
+		writeErr(a.conn, fmt.Sprintf("agent: unable to fetch pinned messages: %v", err))
+	}
+
 	mc := make(chan *goch.Message)
 	{
 		var close func()
 
 		if req.LastSeq != nil {
-			close, err = a.mb.Subscribe(req.Channel, user.UID, *req.LastSeq, mc)
+			close, err = a.mb.Subscribe(ct.Name, user.UID, *req.LastSeq, mc)
 		} else if seq, err := a.pushRecent(); err != nil {
 			writeErr(a.conn, fmt.Sprintf("agent: unable to fetch chat history: %v", err))
-			close, err = a.mb.SubscribeNew(req.Channel, user.UID, mc)
+			close, err = a.mb.SubscribeNew(ct.Name, user.UID, mc)
 		} else {
-			close, err = a.mb.Subscribe(req.Channel, user.UID, seq, mc)
+			close, err = a.mb.Subscribe(ct.Name, user.UID, seq, mc)
 		}
 
 		if err != nil {
@@ -120,7 +230,76 @@ func (a *Agent) HandleConn(conn *websocket.Conn, req *initConReq) {
 		a.closeSub = close
 	}
 
-	a.loop(mc)
+	ec := make(chan *goch.Event)
+	if a.closeEvents, err = a.mb.SubscribeEvents(ct.Name, user.UID, ec); err != nil {
+		writeErr(a.conn, fmt.Sprintf("agent: unable to subscribe to chat events: %v", err))
+		a.closeEvents = func() {}
+	}
+
+	// Member stays online until their last connection closes
+	a.store.AddPresence(a.chat.Name, a.uid, goch.OnlineStatus, presenceTTL)
+	a.sendPresence(goch.OnlineStatus)
+
+	a.loop(mc, ec)
+}
+
+// setPresence stores member's presence status and notifies
+// other connected chat members about it
+func (a *Agent) setPresence(st goch.Status) {
+	if st == goch.OfflineStatus {
+		// Member is still online over their other connections
+		if offline, err := a.store.ClearPresence(a.chat.Name, a.uid); err == nil && !offline {
+			return
+		}
+	} else {
+		a.store.SetPresence(a.chat.Name, a.uid, st, presenceTTL)
+	}
+
+	a.sendPresence(st)
+}
+
+// sendPresence notifies other connected chat members about member's presence
+func (a *Agent) sendPresence(st goch.Status) {
+	a.mb.SendEvent(a.chat.Name, &goch.Event{
+		Type:   goch.PresenceEvent,
+		UID:    a.uid,
+		Status: st,
+		Time:   a.clock.Now().UnixNano(),
+	})
+}
+
+// join joins uid to chat, verifying secret against
+// user's account if they registered with one
+func (a *Agent) join(ct *goch.Chat, uid, secret string) (*goch.User, error) {
+	if !ct.IsAccount(uid) {
+		return ct.Join(uid, secret)
+	}
+	acc, err := a.store.GetAccount(uid)
+	if err != nil {
+		return nil, err
+	}
+	return ct.JoinAccount(acc, secret)
+}
+
+// openDirect returns private chat between uid and peer, creating it
+// if the two have never talked before. Both have to be members of
+// channel ch, which uid has joined.
+func (a *Agent) openDirect(ch *goch.Chat, uid, peer string) (*goch.Chat, error) {
+	dm, err := ch.NewDirect(uid, peer)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing, err := a.store.Get(dm.Name); err == nil {
+		return existing, nil
+	}
+
+	if err = a.store.Save(dm); err == goch.ErrChatConflict {
+		// Peer opened the chat at the same time
+		return a.store.Get(dm.Name)
+	}
+
+	return dm, err
 }
 
 func (a *Agent) pushRecent() (uint64, error) {
@@ -134,6 +313,9 @@ func (a *Agent) pushRecent() (uint64, error) {
 	}
 
 	a.store.UpdateLastClientSeq(a.uid, a.chat.Name, msgs[len(msgs)-1].Seq)
+	a.sendReceipt(msgs[len(msgs)-1].Seq)
+
+	expire(msgs, a.clock.Now())
 
 	return seq, a.conn.WriteJSON(msg{
 		Type: historyMsg,
@@ -142,17 +324,29 @@ func (a *Agent) pushRecent() (uint64, error) {
 
 }
 
-func (a *Agent) loop(mc chan *goch.Message) {
+func (a *Agent) pushPinned() error {
+	msgs, err := a.store.GetPinned(a.chat.Name)
+	if err != nil || msgs == nil {
+		return err
+	}
+
+	expire(msgs, a.clock.Now())
+
+	return a.conn.WriteJSON(msg{
+		Type: pinnedMsg,
+		Data: msgs,
+	})
+}
+
+func (a *Agent) loop(mc chan *goch.Message, ec chan *goch.Event) {
 	go func() {
 		for {
-			if a.closed {
-				return
-			}
-
+			// Connection can't be read from after an error,
+			// which is returned once client closes it as well
 			_, r, err := a.conn.NextReader()
 			if err != nil {
-				writeErr(a.conn, err.Error())
-				continue
+				a.done <- struct{}{}
+				return
 			}
 
 			a.handleClientMsg(r)
@@ -161,17 +355,94 @@ func (a *Agent) loop(mc chan *goch.Message) {
 
 	go func() {
 		defer a.closeSub()
+		defer a.closeEvents()
 		defer a.conn.Close()
+
+		hb := a.clock.After(heartbeatInterval)
+
+		status := goch.OnlineStatus
+
+		// Typing indicator is published at most once per typingThrottle,
+		// and stopped if not refreshed by client within typingTTL
+		var (
+			typingSent time.Time
+			typingExp  <-chan time.Time
+		)
+		// Read receipts are published at most once per receiptThrottle
+		var (
+			readSeq    uint64
+			receiptExp <-chan time.Time
+		)
+
+		stopTyping := func() {
+			if typingExp != nil {
+				typingSent, typingExp = time.Time{}, nil
+				a.sendTyping(false)
+			}
+		}
+
 		for {
 			select {
 			case m := <-mc:
+				if m.IsExpired(a.clock.Now()) {
+					m.Expire()
+				}
+
 				a.conn.WriteJSON(msg{
-					Type: chatMsg,
+					Type: msgType(m),
 					Data: m,
 				})
 
 				a.store.UpdateLastClientSeq(a.uid, a.chat.Name, m.Seq)
+
+				if m.Seq > readSeq {
+					readSeq = m.Seq
+					if receiptExp == nil {
+						receiptExp = a.clock.After(receiptThrottle)
+					}
+				}
+			case <-receiptExp:
+				receiptExp = nil
+				a.sendReceipt(readSeq)
+			case ev := <-ec:
+				if ev.Type == goch.ChatUpdateEvent {
+					if !a.refresh() {
+						writeFatal(a.conn, "agent: you were removed from the channel")
+						stopTyping()
+						a.setPresence(goch.OfflineStatus)
+						return
+					}
+					break
+				}
+				a.conn.WriteJSON(msg{
+					Type: eventType(ev),
+					Data: ev,
+				})
+			case typing := <-a.typing:
+				if !typing {
+					stopTyping()
+					break
+				}
+				if a.clock.Now().Sub(typingSent) < typingThrottle {
+					typingExp = a.clock.After(typingTTL)
+					break
+				}
+				// Only members allowed to post can be shown as typing
+				if _, err := a.authorize(goch.PostPerm); err != nil {
+					break
+				}
+				typingSent, typingExp = a.clock.Now(), a.clock.After(typingTTL)
+				a.sendTyping(true)
+			case <-typingExp:
+				stopTyping()
+			case status = <-a.status:
+				a.setPresence(status)
+			case <-hb:
+				hb = a.clock.After(heartbeatInterval)
+				a.store.SetPresence(a.chat.Name, a.uid, status, presenceTTL)
 			case <-a.done:
+				stopTyping()
+				a.setPresence(goch.OfflineStatus)
 				return
 			}
 		}
@@ -195,13 +466,63 @@ func (a *Agent) handleClientMsg(r io.Reader) {
 		a.handleChatMsg(message.Data)
 	case historyReqMsg:
 		a.handleHistoryReqMsg(message.Data)
+	case editMsg:
+		a.handleEditMsg(message.Data)
+	case deleteMsg:
+		a.handleDeleteMsg(message.Data)
+	case threadReqMsg:
+		a.handleThreadReqMsg(message.Data)
+	case reactionMsg:
+		a.handleReactionMsg(message.Data)
+	case presenceMsg:
+		a.handlePresenceMsg(message.Data)
+	case typingMsg:
+		a.handleTypingMsg(message.Data)
+	case pinMsg:
+		a.handlePinMsg(message.Data)
+	case scheduledReqMsg:
+		a.pushScheduled()
+	case cancelScheduledMsg:
+		a.handleCancelScheduledMsg(message.Data)
+	}
+}
+
+// msgType returns websocket message type for provided chat message
+func msgType(m *goch.Message) msgT {
+	switch m.Type {
+	case goch.EditMessage:
+		return editMsg
+	case goch.DeleteMessage:
+		return deleteMsg
+	case goch.ReactMessage, goch.UnreactMessage:
+		return reactionMsg
+	case goch.PinMessage, goch.UnpinMessage:
+		return pinMsg
+	case goch.ExpireMessage:
+		return expireMsg
+	}
+	return chatMsg
+}
+
+// eventType returns websocket message type for provided chat event
+func eventType(ev *goch.Event) msgT {
+	switch ev.Type {
+	case goch.TypingEvent:
+		return typingMsg
+	case goch.ReceiptEvent:
+		return receiptMsg
 	}
+	return presenceMsg
 }
 
 type message struct {
-	Meta map[string]string `json:"meta"`
-	Seq  uint64            `json:"seq"`
-	Text string            `json:"text"`
+	Meta        map[string]string `json:"meta"`
+	Seq         uint64            `json:"seq"`
+	Text        string            `json:"text"`
+	Parent      uint64            `json:"parent"`
+	Attachments []string          `json:"attachments"`
+	SendAt      int64             `json:"send_at"` // Schedules message to be sent at a later time (UnixNano)
+	TTL         int64             `json:"ttl"`     // Seconds after which message expires, chat's default if zero
 }
 
 func (a *Agent) handleChatMsg(raw json.RawMessage) {
@@ -213,27 +534,420 @@ func (a *Agent) handleChatMsg(raw json.RawMessage) {
 		return
 	}
 
-	if msg.Text == "" {
+	// Messages starting with a slash are commands, unless escaped with another one.
+	// Actions sent with /me are posted as regular messages.
+	var action bool
+	if strings.HasPrefix(msg.Text, "/") {
+		switch text, ok := parseAction(msg.Text); {
+		case strings.HasPrefix(msg.Text, "//"):
+			msg.Text = msg.Text[1:]
+		case ok:
+			if text == "" {
+				writeErr(a.conn, "usage: "+commands["me"].usage)
+				return
+			}
+			msg.Text, action = text, true
+		default:
+			if msg.SendAt != 0 {
+				writeErr(a.conn, "commands can not be scheduled")
+				return
+			}
+			a.handleCommand(msg.Text)
+			return
+		}
+	}
+
+	if msg.Text == "" && len(msg.Attachments) == 0 {
 		writeErr(a.conn, "sent empty message")
 		return
 	}
 
-	if len(msg.Text) > 1024 {
-		writeErr(a.conn, "exceeded max message length of 1024 characters")
+	if len(msg.Text) > goch.MaxTextLength {
+		writeErr(a.conn, fmt.Sprintf("exceeded max message length of %d characters", goch.MaxTextLength))
 		return
 	}
 
-	err = a.mb.Send(a.chat.Name, &goch.Message{
-		Meta:     msg.Meta,
-		Text:     msg.Text,
-		Seq:      msg.Seq,
-		FromName: a.displayName,
-		FromUID:  a.uid,
-		Time:     time.Now().UnixNano(),
-	})
+	if len(msg.Attachments) > maxAttachments {
+		writeErr(a.conn, fmt.Sprintf("exceeded max number of %d attachments", maxAttachments))
+		return
+	}
+
+	ch, err := a.authorize(goch.PostPerm)
 	if err != nil {
+		writeErr(a.conn, fmt.Sprintf("not allowed to post: %v", err))
+		return
+	}
+
+	var atts []goch.Attachment
+	for _, id := range msg.Attachments {
+		// Members can only attach files they uploaded themselves
+		att, err := a.store.GetAttachment(a.chat.Name, id)
+		if err != nil || att.UploadedBy != a.uid {
+			writeErr(a.conn, fmt.Sprintf("unknown attachment %s", id))
+			return
+		}
+		atts = append(atts, *att)
+	}
+
+	if msg.Parent != 0 {
+		root, err := a.fetchMsg(msg.Parent)
+		if err != nil {
+			writeErr(a.conn, fmt.Sprintf("could not reply to message: %v", err))
+			return
+		}
+		if root.IsEvent() || root.IsReply() {
+			writeErr(a.conn, "can only reply to root messages")
+			return
+		}
+	}
+
+	m := &goch.Message{
+		Meta:        msg.Meta,
+		Text:        msg.Text,
+		Seq:         msg.Seq,
+		Parent:      msg.Parent,
+		Attachments: atts,
+		Action:      action,
+		FromName:    a.displayName,
+		FromUID:     a.uid,
+		Time:        a.clock.Now().UnixNano(),
+	}
+
+	if err = m.SetTTL(ch.MessageTTL(msg.TTL)); err != nil {
+		writeErr(a.conn, err.Error())
+		return
+	}
+
+	if err = a.mod.Moderate(a.chat.Name, m); err != nil {
+		writeErr(a.conn, fmt.Sprintf("message rejected: %v", err))
+		return
+	}
+
+	m.Mentions = ch.MentionedBy(a.uid, m.Text)
+
+	if msg.SendAt != 0 {
+		a.schedule(m, msg.SendAt)
+		return
+	}
+
+	if err = a.mb.Send(a.chat.Name, m); err != nil {
 		writeErr(a.conn, fmt.Sprintf("could not forward your message. try again: %v", err))
+		return
+	}
+
+	a.setTyping(false)
+}
+
+func (a *Agent) handleEditMsg(raw json.RawMessage) {
+	var req struct {
+		Seq  uint64 `json:"seq"`
+		Text string `json:"text"`
+	}
+
+	err := json.Unmarshal(raw, &req)
+	if err != nil {
+		writeErr(a.conn, fmt.Sprintf("invalid edit message format: %v", err))
+		return
+	}
+
+	if req.Text == "" {
+		writeErr(a.conn, "sent empty message")
+		return
+	}
+
+	if len(req.Text) > goch.MaxTextLength {
+		writeErr(a.conn, fmt.Sprintf("exceeded max message length of %d characters", goch.MaxTextLength))
+		return
+	}
+
+	ch, err := a.authorize(goch.PostPerm)
+	if err != nil {
+		writeErr(a.conn, fmt.Sprintf("not allowed to edit message: %v", err))
+		return
+	}
+
+	orig, err := a.fetchMsg(req.Seq)
+	if err != nil {
+		writeErr(a.conn, fmt.Sprintf("could not edit message: %v", err))
+		return
+	}
+
+	if orig.FromUID != a.uid || orig.IsEvent() || orig.Deleted {
+		writeErr(a.conn, "can only edit your own messages")
+		return
 	}
+
+	ev := &goch.Message{Type: goch.EditMessage, Ref: req.Seq, Parent: orig.Parent, Text: req.Text, FromUID: a.uid, ExpiresAt: orig.ExpiresAt}
+	if err = a.mod.Moderate(a.chat.Name, ev); err != nil {
+		writeErr(a.conn, fmt.Sprintf("edit rejected: %v", err))
+		return
+	}
+
+	// Only members mentioned by the edit are notified,
+	// ones mentioned in edited text were already
+	ev.Mentions = excluding(ch.MentionedBy(a.uid, ev.Text), ch.MentionedBy(a.uid, orig.Text))
+
+	a.sendEvent(ev)
+}
+
+func (a *Agent) handleDeleteMsg(raw json.RawMessage) {
+	var req struct {
+		Seq uint64 `json:"seq"`
+	}
+
+	err := json.Unmarshal(raw, &req)
+	if err != nil {
+		writeErr(a.conn, fmt.Sprintf("invalid delete message format: %v", err))
+		return
+	}
+
+	orig, err := a.fetchMsg(req.Seq)
+	if err != nil {
+		writeErr(a.conn, fmt.Sprintf("could not delete message: %v", err))
+		return
+	}
+
+	if orig.IsEvent() || orig.Deleted {
+		writeErr(a.conn, "message can not be deleted")
+		return
+	}
+
+	perm := goch.PostPerm
+	if orig.FromUID != a.uid {
+		perm = goch.DeletePerm
+	}
+
+	if _, err = a.authorize(perm); err != nil {
+		writeErr(a.conn, fmt.Sprintf("not allowed to delete message: %v", err))
+		return
+	}
+
+	a.sendEvent(&goch.Message{Type: goch.DeleteMessage, Ref: req.Seq, Parent: orig.Parent})
+}
+
+func (a *Agent) handleReactionMsg(raw json.RawMessage) {
+	var req struct {
+		Seq    uint64 `json:"seq"`
+		Emoji  string `json:"emoji"`
+		Remove bool   `json:"remove"`
+	}
+
+	err := json.Unmarshal(raw, &req)
+	if err != nil {
+		writeErr(a.conn, fmt.Sprintf("invalid reaction message format: %v", err))
+		return
+	}
+
+	if req.Emoji == "" || len(req.Emoji) > maxEmojiLength || strings.ContainsAny(req.Emoji, " \t\n.") {
+		writeErr(a.conn, "invalid reaction emoji")
+		return
+	}
+
+	if _, err = a.authorize(goch.PostPerm); err != nil {
+		writeErr(a.conn, fmt.Sprintf("not allowed to react: %v", err))
+		return
+	}
+
+	orig, err := a.fetchMsg(req.Seq)
+	if err != nil {
+		writeErr(a.conn, fmt.Sprintf("could not react to message: %v", err))
+		return
+	}
+
+	if orig.IsEvent() {
+		writeErr(a.conn, "can only react to messages")
+		return
+	}
+
+	ev := &goch.Message{Type: goch.ReactMessage, Ref: req.Seq, Text: req.Emoji}
+	if req.Remove {
+		ev.Type = goch.UnreactMessage
+	}
+
+	a.sendEvent(ev)
+}
+
+func (a *Agent) handlePinMsg(raw json.RawMessage) {
+	var req struct {
+		Seq    uint64 `json:"seq"`
+		Remove bool   `json:"remove"`
+	}
+
+	err := json.Unmarshal(raw, &req)
+	if err != nil {
+		writeErr(a.conn, fmt.Sprintf("invalid pin message format: %v", err))
+		return
+	}
+
+	if _, err = a.authorize(goch.PinPerm); err != nil {
+		writeErr(a.conn, fmt.Sprintf("not allowed to pin messages: %v", err))
+		return
+	}
+
+	orig, err := a.fetchMsg(req.Seq)
+	if err != nil {
+		writeErr(a.conn, fmt.Sprintf("could not pin message: %v", err))
+		return
+	}
+
+	if orig.IsEvent() || orig.IsReply() {
+		writeErr(a.conn, "can only pin channel messages")
+		return
+	}
+
+	ev := &goch.Message{Type: goch.PinMessage, Ref: req.Seq}
+	if req.Remove {
+		ev.Type = goch.UnpinMessage
+	}
+
+	a.sendEvent(ev)
+}
+
+func (a *Agent) handlePresenceMsg(raw json.RawMessage) {
+	var req struct {
+		Status goch.Status `json:"status"`
+	}
+
+	err := json.Unmarshal(raw, &req)
+	if err != nil {
+		writeErr(a.conn, fmt.Sprintf("invalid presence message format: %v", err))
+		return
+	}
+
+	// Going offline is done by closing the connection
+	if req.Status != goch.OnlineStatus && req.Status != goch.AwayStatus {
+		writeErr(a.conn, "presence status must be online or away")
+		return
+	}
+
+	select {
+	case a.status <- req.Status:
+	default:
+		writeErr(a.conn, "presence update already in progress")
+	}
+}
+
+func (a *Agent) handleTypingMsg(raw json.RawMessage) {
+	var req struct {
+		Stop bool `json:"stop"`
+	}
+
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &req); err != nil {
+			writeErr(a.conn, fmt.Sprintf("invalid typing message format: %v", err))
+			return
+		}
+	}
+
+	a.setTyping(!req.Stop)
+}
+
+// setTyping forwards typing state to connection's writer. Starting to type
+// while previous update is still pending is dropped, stopping supersedes it.
+func (a *Agent) setTyping(typing bool) {
+	if !typing {
+		select {
+		case <-a.typing:
+		default:
+		}
+	}
+	select {
+	case a.typing <- typing:
+	default:
+	}
+}
+
+// sendTyping publishes typing indicator to other chat members
+func (a *Agent) sendTyping(typing bool) {
+	ev := &goch.Event{
+		Type:   goch.TypingEvent,
+		UID:    a.uid,
+		Typing: typing,
+		Time:   a.clock.Now().UnixNano(),
+	}
+	if typing {
+		ev.Until = a.clock.Now().Add(typingTTL).UnixNano()
+	}
+	a.mb.SendEvent(a.chat.Name, ev)
+}
+
+// sendReceipt notifies other chat members that connected user has read
+// messages up to seq, unless chat has read receipts disabled
+func (a *Agent) sendReceipt(seq uint64) {
+	if a.disableReceipts {
+		return
+	}
+	a.mb.SendEvent(a.chat.Name, &goch.Event{
+		Type: goch.ReceiptEvent,
+		UID:  a.uid,
+		Seq:  seq,
+		Time: a.clock.Now().UnixNano(),
+	})
+}
+
+// sendEvent publishes event referencing existing message on behalf of connected user
+func (a *Agent) sendEvent(ev *goch.Message) {
+	ev.FromUID = a.uid
+	ev.FromName = a.displayName
+	ev.Time = a.clock.Now().UnixNano()
+
+	if err := a.mb.Send(a.chat.Name, ev); err != nil {
+		writeErr(a.conn, fmt.Sprintf("could not forward your message. try again: %v", err))
+	}
+}
+
+// fetchMsg fetches a single message from chat log
+func (a *Agent) fetchMsg(seq uint64) (*goch.Message, error) {
+	mc := make(chan *goch.Message)
+
+	close, err := a.mb.Subscribe(a.chat.Name, "", seq, mc)
+	if err != nil {
+		return nil, err
+	}
+
+	defer close()
+
+	select {
+	case m := <-mc:
+		if m.Seq != seq {
+			return nil, errMsgNotFound
+		}
+		return m, nil
+	case <-a.clock.After(fetchTimeout):
+		return nil, errMsgNotFound
+	}
+}
+
+func (a *Agent) handleThreadReqMsg(raw json.RawMessage) {
+	var req struct {
+		Parent uint64 `json:"parent"`
+	}
+
+	err := json.Unmarshal(raw, &req)
+	if err != nil {
+		writeErr(a.conn, fmt.Sprintf("invalid thread request message format: %v", err))
+		return
+	}
+
+	msgs, err := a.store.GetThread(a.chat.Name, req.Parent)
+	if err != nil {
+		writeErr(a.conn, fmt.Sprintf("could not fetch thread: %v", err))
+		return
+	}
+
+	expire(msgs, a.clock.Now())
+
+	// Failed write leaves connection unusable,
+	// so no error is written after it
+	a.conn.WriteJSON(msg{
+		Type: threadMsg,
+		Data: thread{Parent: req.Parent, Messages: msgs},
+	})
+}
+
+type thread struct {
+	Parent   uint64         `json:"parent"`
+	Messages []goch.Message `json:"messages"`
 }
 
 func (a *Agent) handleHistoryReqMsg(raw json.RawMessage) {
@@ -291,14 +1005,103 @@ func (a *Agent) buildHistoryBatch(to uint64) ([]*goch.Message, error) {
 		msgs = append(msgs, msg)
 	}
 
+	msgs = fold(msgs)
+
+	// Replayed messages may have expired since they were sent
+	now := a.clock.Now()
+	seqs := make([]uint64, len(msgs))
+	for i, m := range msgs {
+		if m.IsExpired(now) {
+			m.Expire()
+		}
+		seqs[i] = m.Seq
+	}
+
+	if counts, err := a.store.ReplyCounts(a.chat.Name, seqs); err == nil {
+		for _, m := range msgs {
+			m.Replies = counts[m.Seq]
+		}
+	}
+
+	if reactions, err := a.store.Reactions(a.chat.Name, seqs); err == nil {
+		for _, m := range msgs {
+			m.Reactions = reactions[m.Seq]
+		}
+	}
+
 	return msgs, nil
 }
 
-func writeErr(conn *websocket.Conn, err string) {
+// fold applies events to messages they reference within the batch.
+// Reactions are dropped as messages get annotated with current reaction summary.
+// Events referencing messages outside of the batch are kept.
+func fold(msgs []*goch.Message) []*goch.Message {
+	idx := make(map[uint64]*goch.Message)
+	folded := msgs[:0]
+
+	for _, m := range msgs {
+		if !m.IsEvent() {
+			idx[m.Seq] = m
+			folded = append(folded, m)
+			continue
+		}
+
+		if orig, ok := idx[m.Ref]; ok {
+			orig.Apply(m)
+			continue
+		}
+
+		folded = append(folded, m)
+	}
+
+	return folded
+}
+
+// authorize fetches current state of the chat and checks
+// whether connected user is allowed to perform p
+func (a *Agent) authorize(p goch.Permission) (*goch.Chat, error) {
+	ch, err := a.store.Get(a.chat.Name)
+	if err != nil {
+		return nil, err
+	}
+	return ch, ch.Authorize(a.uid, p)
+}
+
+// refresh reloads chat settings after chat was updated, and reports
+// whether connected user is still its member
+func (a *Agent) refresh() bool {
+	ch, err := a.store.Get(a.chat.Name)
+	if err != nil {
+		return true
+	}
+	a.disableReceipts = ch.DisableReceipts
+	_, ok := ch.Members[a.uid]
+	return ok
+}
+
+// excluding returns uids which are not in excluded
+func excluding(uids, excluded []string) []string {
+	var res []string
+	for _, uid := range uids {
+		found := false
+		for _, e := range excluded {
+			if e == uid {
+				found = true
+				break
+			}
+		}
+		if !found {
+			res = append(res, uid)
+		}
+	}
+	return res
+}
+
+func writeErr(conn Conn, err string) {
 	conn.WriteJSON(msg{Error: err, Type: errorMsg})
 }
 
-func writeFatal(conn *websocket.Conn, err string) {
+func writeFatal(conn Conn, err string) {
 	conn.WriteJSON(msg{Error: err, Type: errorMsg})
 	conn.Close()
 }
@@ -307,3 +1110,12 @@ func (a *Agent) setUser(u *goch.User) {
 	a.uid = u.UID
 	a.displayName = u.DisplayName
 }
+
+// expire tombstones stored messages which expired at now but were not yet replaced
+func expire(msgs []goch.Message, now time.Time) {
+	for i := range msgs {
+		if msgs[i].IsExpired(now) {
+			msgs[i].Expire()
+		}
+	}
+}
@@ -0,0 +1,617 @@
+package agent_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/ribice/goch"
+	"github.com/ribice/goch/internal/agent"
+	gochbroker "github.com/ribice/goch/internal/broker"
+)
+
+const (
+	chatMsg   = `{"type":0,"data":{"text":"hello"}}`
+	typingMsg = `{"type":11}`
+
+	historyMsg   = 1
+	errorMsg     = 2
+	infoMsg      = 3
+	threadMsg    = 8
+	scheduledMsg = 16
+
+	secret         = "12345678901234567890"
+	typingThrottle = 2 * time.Second
+	typingTTL      = 5 * time.Second
+)
+
+// secretHash is hash of secret, computed once as hashing is slow
+var secretHash = func() []byte {
+	u := &goch.User{}
+	if err := u.SetSecret(secret); err != nil {
+		panic(err)
+	}
+	return u.SecretHash
+}()
+
+func TestTypingThrottle(t *testing.T) {
+	c, mb, clk := connect(t, newChat(), "john")
+	defer c.close()
+	start := clk.Now()
+
+	c.send(typingMsg)
+	if ev := mb.nextTyping(t); !ev.Typing || ev.Time != start.UnixNano() {
+		t.Fatalf("expected typing to be sent, got %+v", ev)
+	}
+	clk.waitAfter(t, typingTTL)
+
+	// Refreshing within typingThrottle only extends the indicator
+	clk.Advance(time.Second)
+	c.send(typingMsg)
+	clk.waitAfter(t, typingTTL)
+
+	clk.Advance(typingThrottle)
+	c.send(typingMsg)
+	if ev := mb.nextTyping(t); !ev.Typing || ev.Time != start.Add(3*time.Second).UnixNano() {
+		t.Errorf("expected typing to be sent once throttle passed, got %+v", ev)
+	}
+}
+
+func TestTypingExpiry(t *testing.T) {
+	c, mb, clk := connect(t, newChat(), "john")
+	defer c.close()
+
+	c.send(typingMsg)
+	if ev := mb.nextTyping(t); !ev.Typing {
+		t.Fatalf("expected typing to be sent, got %+v", ev)
+	}
+	clk.waitAfter(t, typingTTL)
+
+	// Refreshing extends typing from the time of refresh
+	clk.Advance(typingThrottle)
+	c.send(typingMsg)
+	if ev := mb.nextTyping(t); !ev.Typing {
+		t.Fatalf("expected typing to be refreshed, got %+v", ev)
+	}
+	clk.waitAfter(t, typingTTL)
+
+	clk.Advance(typingTTL)
+	if ev := mb.nextTyping(t); ev.Typing || ev.Time != clk.Now().UnixNano() {
+		t.Errorf("expected typing to be stopped once it expired, got %+v", ev)
+	}
+}
+
+func TestTypingStopsOnSend(t *testing.T) {
+	c, mb, _ := connect(t, newChat(), "john")
+	defer c.close()
+
+	c.send(typingMsg)
+	if ev := mb.nextTyping(t); !ev.Typing {
+		t.Fatalf("expected typing to be sent, got %+v", ev)
+	}
+
+	c.send(chatMsg)
+	if ev := mb.nextTyping(t); ev.Typing {
+		t.Errorf("expected typing to be stopped once message was sent, got %+v", ev)
+	}
+	if m := mb.nextMessage(t); m.Text != "hello" {
+		t.Errorf("expected message to be sent, got %+v", m)
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	cases := []struct {
+		name      string
+		req       string
+		replyType int
+	}{
+		{
+			name:      "Command reply",
+			req:       `{"type":0,"data":{"text":"/help"}}`,
+			replyType: infoMsg,
+		},
+		{
+			name:      "Thread",
+			req:       `{"type":7,"data":{"parent":1}}`,
+			replyType: threadMsg,
+		},
+		{
+			name:      "Scheduled messages",
+			req:       `{"type":15}`,
+			replyType: scheduledMsg,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, mb, _ := connect(t, newChat(), "john")
+			defer c.close()
+
+			// Replies are not read until all are written, so writes
+			// block once connection's buffer is full and overlap
+			const n = 32
+			go func() {
+				for i := 0; i < n; i++ {
+					mb.msgs <- &goch.Message{Seq: uint64(i + 1), FromUID: "bob", Text: "hello"}
+				}
+			}()
+			go func() {
+				for i := 0; i < n; i++ {
+					c.send(tc.req)
+				}
+			}()
+
+			var msgs, replies int
+			for msgs+replies < 2*n {
+				select {
+				case r := <-c.out:
+					switch r.Type {
+					case 0:
+						msgs++
+					case tc.replyType:
+						replies++
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("expected all replies to be written, got %d messages and %d replies", msgs, replies)
+				}
+			}
+		})
+	}
+}
+
+func TestEditMentions(t *testing.T) {
+	cases := []struct {
+		name     string
+		orig     string
+		edit     string
+		wantMent []string
+	}{
+		{
+			name:     "Mention added by edit",
+			orig:     "hello @bob",
+			edit:     "hello @bob and @alice",
+			wantMent: []string{"alice"},
+		},
+		{
+			name: "Mention kept from edited text",
+			orig: "hello @bob",
+			edit: "hi @bob",
+		},
+		{
+			name: "Self mention",
+			orig: "hello",
+			edit: "hello @john",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, mb, _ := connect(t, newChat(), "john")
+			defer c.close()
+			mb.log = []goch.Message{{Seq: 1, FromUID: "john", Text: tc.orig}}
+
+			c.send(`{"type":5,"data":{"seq":1,"text":"` + tc.edit + `"}}`)
+
+			ev := mb.nextMessage(t)
+			if ev.Type != goch.EditMessage || ev.Ref != 1 || ev.Text != tc.edit {
+				t.Fatalf("expected edit event to be sent, got %+v", ev)
+			}
+			if !reflect.DeepEqual(ev.Mentions, tc.wantMent) {
+				t.Errorf("expected mentions %v, got %v", tc.wantMent, ev.Mentions)
+			}
+		})
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	cases := []struct {
+		name    string
+		att     string
+		wantErr string
+	}{
+		{
+			name:    "Unknown attachment",
+			att:     "unknown",
+			wantErr: "unknown attachment unknown",
+		},
+		{
+			name:    "Attachment uploaded by another member",
+			att:     "jane",
+			wantErr: "unknown attachment jane",
+		},
+		{
+			name: "Own attachment",
+			att:  "john",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, mb, _ := connect(t, newChat(), "john")
+			defer c.close()
+
+			c.send(`{"type":0,"data":{"text":"file","attachments":["` + tc.att + `"]}}`)
+
+			select {
+			case r := <-c.out:
+				if r.Type != errorMsg || r.Error != tc.wantErr {
+					t.Errorf("expected error %q, got %+v", tc.wantErr, r)
+				}
+			case m := <-mb.sent:
+				if tc.wantErr != "" || len(m.Attachments) != 1 || m.Attachments[0].ID != tc.att {
+					t.Errorf("unexpected message: %+v", m)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("expected message to be handled")
+			}
+		})
+	}
+}
+
+// newChat returns chat with a member of each role, and a member
+// who joined with their account
+func newChat() *goch.Chat {
+	return &goch.Chat{
+		Name:  "general",
+		Topic: "Old topic",
+		Members: map[string]*goch.User{
+			"alice": {UID: "alice", DisplayName: "Alice", Role: goch.OwnerRole, SecretHash: secretHash},
+			"bob":   {UID: "bob", DisplayName: "Bob", Role: goch.ModeratorRole, SecretHash: secretHash},
+			"john":  {UID: "john", DisplayName: "John", Role: goch.MemberRole, SecretHash: secretHash},
+			"jane":  {UID: "jane", Role: goch.MemberRole, Account: true},
+		},
+	}
+}
+
+// connect connects uid to chat over a fake connection
+func connect(t *testing.T, ch *goch.Chat, uid string) (*conn, *broker, *clock) {
+	c := &conn{in: make(chan []byte), out: make(chan reply, 16)}
+	mb := &broker{events: make(chan *goch.Event, 16), sent: make(chan *goch.Message, 16)}
+	clk := &clock{now: time.Unix(1500000000, 0), after: make(chan time.Duration, 64)}
+
+	agent.New(mb, &store{chat: ch}, moderator{}, clk).HandleConn(c, &agent.ConnReq{
+		Channel: ch.Name,
+		UID:     uid,
+		Secret:  secret,
+	})
+
+	return c, mb, clk
+}
+
+type conn struct {
+	in      chan []byte
+	out     chan reply
+	writing int32
+}
+
+// reply represents message written to the connection
+type reply struct {
+	Type  int             `json:"type"`
+	Data  json.RawMessage `json:"data"`
+	Error string          `json:"error"`
+}
+
+func (c *conn) send(data string) { c.in <- []byte(data) }
+
+func (c *conn) close() { close(c.in) }
+
+func (c *conn) NextReader() (int, io.Reader, error) {
+	data, ok := <-c.in
+	if !ok {
+		return 0, nil, errors.New("connection closed")
+	}
+	return websocket.TextMessage, bytes.NewReader(data), nil
+}
+
+// WriteJSON panics on concurrent writes, as *websocket.Conn does
+func (c *conn) WriteJSON(v interface{}) error {
+	if !atomic.CompareAndSwapInt32(&c.writing, 0, 1) {
+		panic("concurrent write to connection")
+	}
+	defer atomic.StoreInt32(&c.writing, 0)
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var r reply
+	if err = json.Unmarshal(data, &r); err != nil {
+		return err
+	}
+	c.out <- r
+	return nil
+}
+
+func (c *conn) Close() error { return nil }
+
+// clock is a fake clock, whose timers fire only once it is advanced
+type clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []timer
+	after  chan time.Duration // Receives durations After was called with
+}
+
+type timer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	t := timer{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.timers = append(c.timers, t)
+	c.mu.Unlock()
+
+	c.after <- d
+	return t.c
+}
+
+// Advance moves clock forward by d, firing timers which are due
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	var pending []timer
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.c <- c.now
+	}
+	c.timers = pending
+}
+
+// waitAfter waits for timer of duration d to be started,
+// which agent does once it handled typing update
+func (c *clock) waitAfter(t *testing.T, d time.Duration) {
+	for {
+		select {
+		case got := <-c.after:
+			if got == d {
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected timer of %v to be started", d)
+		}
+	}
+}
+
+type broker struct {
+	events chan *goch.Event
+	sent   chan *goch.Message
+	msgs   chan *goch.Message // Delivers chat messages to the agent
+	log    []goch.Message     // Messages fetched by the agent
+}
+
+// nextTyping returns next typing event sent by the agent
+func (b *broker) nextTyping(t *testing.T) *goch.Event {
+	for {
+		select {
+		case ev := <-b.events:
+			if ev.Type == goch.TypingEvent {
+				return ev
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected typing event to be sent")
+		}
+	}
+}
+
+// nextMessage returns next chat message sent by the agent
+func (b *broker) nextMessage(t *testing.T) *goch.Message {
+	select {
+	case m := <-b.sent:
+		return m
+	case <-time.After(time.Second):
+		t.Fatal("expected message to be sent")
+	}
+	return nil
+}
+
+func (b *broker) Subscribe(id, nick string, start uint64, mc chan *goch.Message) (func(), error) {
+	if nick != "" {
+		b.msgs = mc
+		return func() {}, nil
+	}
+
+	// Anonymous subscriptions fetch messages from log
+	done := make(chan struct{})
+	go func() {
+		for i := range b.log {
+			m := b.log[i]
+			if m.Seq < start {
+				continue
+			}
+			select {
+			case mc <- &m:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }, nil
+}
+
+func (b *broker) SubscribeNew(string, string, chan *goch.Message) (func(), error) {
+	return func() {}, nil
+}
+
+func (b *broker) Send(id string, m *goch.Message) error {
+	b.sent <- m
+	return nil
+}
+
+func (b *broker) SendEvent(id string, ev *goch.Event) error {
+	b.events <- ev
+	return nil
+}
+
+func (b *broker) SubscribeEvents(string, string, chan *goch.Event) (func(), error) {
+	return func() {}, nil
+}
+
+// moderator rejects spam and redacts darn
+type moderator struct{}
+
+func (moderator) Moderate(id string, m *goch.Message) error {
+	if strings.Contains(m.Text, "spam") {
+		return errors.New("spam is not allowed")
+	}
+	m.Text = strings.Replace(m.Text, "darn", "****", -1)
+	return nil
+}
+
+type store struct {
+	chat *goch.Chat
+}
+
+func (s *store) Get(id string) (*goch.Chat, error) {
+	if id != s.chat.Name {
+		return nil, errors.New("chat not found")
+	}
+	return s.chat, nil
+}
+
+func (s *store) Save(*goch.Chat) error { return nil }
+
+func (s *store) GetRecent(string, int64) ([]goch.Message, uint64, error) { return nil, 0, nil }
+
+func (s *store) GetThread(string, uint64) ([]goch.Message, error) { return nil, nil }
+
+func (s *store) GetPinned(string) ([]goch.Message, error) { return nil, nil }
+
+func (s *store) ReplyCounts(string, []uint64) (map[uint64]uint64, error) { return nil, nil }
+
+func (s *store) Reactions(string, []uint64) (map[uint64][]goch.Reaction, error) { return nil, nil }
+
+// GetAttachment returns attachment uploaded by member whose uid is attachment's id
+func (s *store) GetAttachment(id, attID string) (*goch.Attachment, error) {
+	if _, ok := s.chat.Members[attID]; !ok {
+		return nil, errors.New("attachment not found")
+	}
+	return &goch.Attachment{ID: attID, UploadedBy: attID}, nil
+}
+
+func (s *store) GetAccount(uid string) (*goch.Account, error) {
+	if uid != "jane" {
+		return nil, errors.New("account not found")
+	}
+	return &goch.Account{UID: uid, DisplayName: "Jane Doe", Email: "jane@example.com"}, nil
+}
+
+func (s *store) RemoveAccountChannel(string, string) error { return nil }
+
+func (s *store) SaveInvite(*goch.Invite) error { return nil }
+
+func (s *store) Presence(id string, uids []string) (map[string]goch.Status, error) {
+	return map[string]goch.Status{"john": goch.OnlineStatus}, nil
+}
+
+func (s *store) UpdateLastClientSeq(string, string, uint64) {}
+
+func (s *store) SetPresence(string, string, goch.Status, time.Duration) error { return nil }
+
+func (s *store) AddPresence(string, string, goch.Status, time.Duration) error { return nil }
+
+func (s *store) ClearPresence(string, string) (bool, error) { return true, nil }
+
+func (s *store) ScheduleMessage(*goch.Scheduled) error { return nil }
+
+func (s *store) GetScheduled(string, string) (*goch.Scheduled, error) {
+	return nil, errors.New("scheduled message not found")
+}
+
+func (s *store) ListScheduled(string, string) ([]*goch.Scheduled, error) { return nil, nil }
+
+func (s *store) CancelScheduled(string, string) error { return nil }
+
+func TestHistoryReplaysSystemMessages(t *testing.T) {
+	log := msgLog{
+		{FromUID: "john", Text: "hello"},
+		{System: true, Text: "Bob changed the topic to: News"},
+		{FromUID: "alice", Text: "welcome"},
+		{FromUID: "bob", Text: "latest"},
+	}
+
+	c := &conn{in: make(chan []byte), out: make(chan reply, 16)}
+	clk := &clock{now: time.Unix(1500000000, 0), after: make(chan time.Duration, 64)}
+	mb := gochbroker.New(log, &store{chat: newChat()}, nil)
+
+	agent.New(mb, &store{chat: newChat()}, moderator{}, clk).HandleConn(c, &agent.ConnReq{
+		Channel: "general",
+		UID:     "john",
+		Secret:  secret,
+	})
+	defer c.close()
+
+	c.send(`{"type":4,"data":{"to":4}}`)
+
+	for {
+		select {
+		case r := <-c.out:
+			if r.Type != historyMsg {
+				continue
+			}
+			var msgs []goch.Message
+			if err := json.Unmarshal(r.Data, &msgs); err != nil {
+				t.Fatal(err)
+			}
+			if len(msgs) != 3 {
+				t.Fatalf("expected 3 messages in history, got %+v", msgs)
+			}
+			if !msgs[1].System || msgs[1].Seq != 2 || msgs[1].Text != "Bob changed the topic to: News" {
+				t.Errorf("expected system message to be replayed, got %+v", msgs[1])
+			}
+			return
+		case <-time.After(time.Second):
+			t.Fatal("expected history to be sent")
+		}
+	}
+}
+
+// msgLog is an in-memory message log, whose sequences start at 1
+type msgLog []goch.Message
+
+func (l msgLog) SubscribeSeq(id, nick string, start uint64, f func(uint64, []byte)) (io.Closer, error) {
+	go func() {
+		for i, m := range l {
+			seq := uint64(i + 1)
+			if seq < start {
+				continue
+			}
+			data, _ := m.Encode()
+			f(seq, data)
+		}
+	}()
+	return ioutil.NopCloser(nil), nil
+}
+
+func (l msgLog) SubscribeTimestamp(string, string, time.Time, func(uint64, []byte)) (io.Closer, error) {
+	return ioutil.NopCloser(nil), nil
+}
+
+func (l msgLog) Send(string, []byte) error { return nil }
+
+func (l msgLog) Publish(string, []byte) error { return nil }
+
+func (l msgLog) Subscribe(string, func([]byte)) (io.Closer, error) {
+	return ioutil.NopCloser(nil), nil
+}
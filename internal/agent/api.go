@@ -20,10 +20,12 @@ var (
 )
 
 // NewAPI creates new websocket api
-func NewAPI(m *mux.Router, br *broker.Broker, store ChatStore, lim Limiter) *API {
+func NewAPI(m *mux.Router, br *broker.Broker, store ChatStore, lim Limiter, mod Moderator) *API {
 	api := API{
 		broker: br,
 		store:  store,
+		rlim:   lim,
+		mod:    mod,
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
@@ -43,10 +45,12 @@ type API struct {
 	store    ChatStore
 	upgrader websocket.Upgrader
 	rlim     Limiter
+	mod      Moderator
 }
 
 // Limiter represents chat service limit checker
 type Limiter interface {
+	Exceeds(string, goch.Limit) error
 	ExceedsAny(map[string]goch.Limit) error
 }
 
@@ -66,18 +70,21 @@ func (api *API) connect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	agent := New(api.broker, api.store)
+	agent := New(api.broker, api.store, api.mod, SystemClock{})
 	agent.HandleConn(conn, req)
 }
 
-type initConReq struct {
+// ConnReq represents connection initialization request,
+// sent by client as the first websocket message
+type ConnReq struct {
 	Channel string  `json:"channel"`
 	UID     string  `json:"uid"`
 	Secret  string  `json:"secret"` // User secret
+	Peer    string  `json:"peer"`   // Opens private chat with peer from Channel
 	LastSeq *uint64 `json:"last_seq"`
 }
 
-func (api *API) bindReq(r *initConReq) error {
+func (api *API) bindReq(r *ConnReq) error {
 	if !alfaRgx.MatchString(r.Secret) {
 		return errors.New("secret must contain only alphanumeric and underscores")
 	}
@@ -85,6 +92,12 @@ func (api *API) bindReq(r *initConReq) error {
 		return errors.New("channel must contain only alphanumeric and underscores")
 	}
 
+	if r.Peer != "" {
+		if err := api.rlim.Exceeds(r.Peer, goch.UIDLimit); err != nil {
+			return err
+		}
+	}
+
 	return api.rlim.ExceedsAny(map[string]goch.Limit{
 		r.UID:     goch.UIDLimit,
 		r.Secret:  goch.SecretLimit,
@@ -94,22 +107,22 @@ func (api *API) bindReq(r *initConReq) error {
 
 var errConnClosed = errors.New("connection closed")
 
-func (api *API) waitConnInit(conn *websocket.Conn) (*initConReq, error) {
+func (api *API) waitConnInit(conn *websocket.Conn) (*ConnReq, error) {
 	t, wsr, err := conn.NextReader()
 	if err != nil || t == websocket.CloseMessage {
 		return nil, errConnClosed
 	}
 
-	var req *initConReq
+	var req ConnReq
 
-	err = json.NewDecoder(wsr).Decode(req)
+	err = json.NewDecoder(wsr).Decode(&req)
 	if err != nil {
 		return nil, err
 	}
 
-	if err = api.bindReq(req); err != nil {
+	if err = api.bindReq(&req); err != nil {
 		return nil, err
 	}
 
-	return req, nil
+	return &req, nil
 }
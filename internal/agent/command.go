@@ -0,0 +1,318 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ribice/goch"
+)
+
+// command represents a slash command. Commands reply either to the caller
+// only, with an info message, or to the whole channel, with a system message.
+// Commands without run, such as /me, are sent as chat messages.
+type command struct {
+	perm  goch.Permission
+	usage string
+	help  string
+	run   func(a *Agent, ch *goch.Chat, args []string) error
+}
+
+var commands map[string]*command
+
+func init() {
+	commands = map[string]*command{
+		"me": {
+			perm:  goch.PostPerm,
+			usage: "/me <action>",
+			help:  "Describes what you are doing",
+		},
+		"topic": {
+			perm:  goch.ReadPerm,
+			usage: "/topic [topic]",
+			help:  "Shows channel topic, or changes it if provided",
+			run:   runTopic,
+		},
+		"kick": {
+			perm:  goch.KickPerm,
+			usage: "/kick <uid>",
+			help:  "Removes a member from the channel",
+			run:   runKick,
+		},
+		"mute": {
+			perm:  goch.MutePerm,
+			usage: "/mute <uid> <duration>",
+			help:  "Mutes a member for a duration such as 10m or 2h",
+			run:   runMute,
+		},
+		"invite": {
+			perm:  goch.InvitePerm,
+			usage: "/invite [ttl] [max uses]",
+			help:  "Creates an invite, optionally expiring after ttl such as 24h",
+			run:   runInvite,
+		},
+		"who": {
+			perm:  goch.ReadPerm,
+			usage: "/who",
+			help:  "Lists channel members and their status",
+			run:   runWho,
+		},
+		"help": {
+			perm:  goch.ReadPerm,
+			usage: "/help",
+			help:  "Lists commands available to you",
+			run:   runHelp,
+		},
+	}
+}
+
+var errUsage = errors.New("invalid command arguments")
+
+// handleCommand runs slash command in text on behalf of connected user
+func (a *Agent) handleCommand(text string) {
+	fields := strings.Fields(strings.TrimPrefix(text, "/"))
+	if len(fields) == 0 {
+		writeErr(a.conn, "missing command name, see /help")
+		return
+	}
+
+	name := strings.ToLower(fields[0])
+	cmd, ok := commands[name]
+	if !ok {
+		writeErr(a.conn, fmt.Sprintf("unknown command /%s, see /help", name))
+		return
+	}
+
+	ch, err := a.authorize(cmd.perm)
+	if err != nil {
+		writeErr(a.conn, fmt.Sprintf("not allowed to use /%s: %v", name, err))
+		return
+	}
+
+	if err = cmd.run(a, ch, fields[1:]); err != nil {
+		if err == errUsage {
+			writeErr(a.conn, "usage: "+cmd.usage)
+			return
+		}
+		writeErr(a.conn, fmt.Sprintf("/%s failed: %v", name, err))
+	}
+}
+
+// writeInfo sends info message to connected user only
+func (a *Agent) writeInfo(text string) error {
+	return a.conn.WriteJSON(msg{Type: infoMsg, Data: text})
+}
+
+// sendSystem publishes system message to all chat members. System messages
+// have no author, so they are delivered to the connected user as well.
+func (a *Agent) sendSystem(text string) error {
+	return a.mb.Send(a.chat.Name, &goch.Message{
+		Text:   text,
+		System: true,
+		Time:   a.clock.Now().UnixNano(),
+	})
+}
+
+// parseAction returns action described by /me command in text,
+// and whether text is a /me command at all
+func parseAction(text string) (string, bool) {
+	fields := strings.Fields(strings.TrimPrefix(text, "/"))
+	if len(fields) == 0 || strings.ToLower(fields[0]) != "me" {
+		return "", false
+	}
+	text = strings.TrimSpace(strings.TrimPrefix(text, "/"))
+	return strings.TrimSpace(text[len(fields[0]):]), true
+}
+
+func runTopic(a *Agent, ch *goch.Chat, args []string) error {
+	if len(args) == 0 {
+		return a.writeInfo(fmt.Sprintf("Topic: %s", ch.Topic))
+	}
+
+	// Reading topic is allowed to all members, changing it is not
+	if err := ch.Authorize(a.uid, goch.TopicPerm); err != nil {
+		return err
+	}
+
+	m := &goch.Message{Text: strings.Join(args, " "), FromUID: a.uid}
+	if err := a.mod.Moderate(a.chat.Name, m); err != nil {
+		return err
+	}
+
+	// Checked after moderation, which may rewrite the topic
+	topic := m.Text
+	if len(topic) > goch.MaxTopicLength {
+		return fmt.Errorf("topic must be at most %d characters long", goch.MaxTopicLength)
+	}
+
+	ch.Topic = topic
+	if err := a.store.Save(ch); err != nil {
+		return err
+	}
+
+	return a.sendSystem(fmt.Sprintf("%s changed the topic to: %s", a.displayName, topic))
+}
+
+func runKick(a *Agent, ch *goch.Chat, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	target := args[0]
+	if err := ch.AuthorizeOn(a.uid, target, goch.KickPerm); err != nil {
+		return err
+	}
+
+	name := a.displayNameOf(ch, target)
+	account := ch.IsAccount(target)
+	ch.Leave(target)
+
+	if err := a.store.Save(ch); err != nil {
+		return err
+	}
+
+	if account {
+		a.store.RemoveAccountChannel(target, ch.Name)
+	}
+
+	a.mb.SendEvent(ch.Name, &goch.Event{Type: goch.ChatUpdateEvent, Time: a.clock.Now().UnixNano()})
+
+	return a.sendSystem(fmt.Sprintf("%s removed %s from the channel", a.displayName, name))
+}
+
+func runMute(a *Agent, ch *goch.Chat, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+
+	target := args[0]
+	d, err := time.ParseDuration(args[1])
+	if err != nil || d <= 0 || d > goch.MaxMuteDuration {
+		return errors.New("duration must be positive and at most a year, e.g. 10m or 2h")
+	}
+
+	if err = ch.AuthorizeOn(a.uid, target, goch.MutePerm); err != nil {
+		return err
+	}
+
+	if err = ch.Mute(target, a.uid, d); err != nil {
+		return err
+	}
+
+	if err = a.store.Save(ch); err != nil {
+		return err
+	}
+
+	return a.sendSystem(fmt.Sprintf("%s muted %s for %s", a.displayName, a.displayNameOf(ch, target), d))
+}
+
+func runInvite(a *Agent, ch *goch.Chat, args []string) error {
+	if len(args) > 2 {
+		return errUsage
+	}
+
+	var (
+		ttl     time.Duration
+		maxUses int
+		err     error
+	)
+
+	if len(args) > 0 {
+		if ttl, err = time.ParseDuration(args[0]); err != nil || ttl < 0 {
+			return errUsage
+		}
+	}
+
+	if len(args) > 1 {
+		if maxUses, err = strconv.Atoi(args[1]); err != nil || maxUses < 0 {
+			return errUsage
+		}
+	}
+
+	inv, err := goch.NewInvite(ch.Name, a.uid, ttl, maxUses)
+	if err != nil {
+		return err
+	}
+
+	if err = a.store.SaveInvite(inv); err != nil {
+		return err
+	}
+
+	info := fmt.Sprintf("Invite token: %s", inv.Token)
+	if inv.ExpiresAt != 0 {
+		info += fmt.Sprintf(", expires at %s", time.Unix(0, inv.ExpiresAt).UTC().Format(time.RFC3339))
+	}
+	if inv.MaxUses != 0 {
+		info += fmt.Sprintf(", can be used %d times", inv.MaxUses)
+	}
+
+	return a.writeInfo(info)
+}
+
+func runWho(a *Agent, ch *goch.Chat, args []string) error {
+	members := ch.ListMembers()
+	a.profiles(members)
+	sort.Slice(members, func(i, j int) bool { return members[i].UID < members[j].UID })
+
+	uids := make([]string, len(members))
+	for i, u := range members {
+		uids[i] = u.UID
+	}
+
+	statuses, err := a.store.Presence(ch.Name, uids)
+	if err != nil {
+		return err
+	}
+
+	lines := make([]string, len(members))
+	for i, u := range members {
+		st, ok := statuses[u.UID]
+		if !ok {
+			st = goch.OfflineStatus
+		}
+		lines[i] = fmt.Sprintf("%s (%s) - %s, %s", u.DisplayName, u.UID, u.Role, st)
+	}
+
+	return a.writeInfo(fmt.Sprintf("%d members:\n%s", len(members), strings.Join(lines, "\n")))
+}
+
+func runHelp(a *Agent, ch *goch.Chat, args []string) error {
+	var lines []string
+	for _, cmd := range commands {
+		if ch.Authorize(a.uid, cmd.perm) == nil {
+			lines = append(lines, fmt.Sprintf("%s - %s", cmd.usage, cmd.help))
+		}
+	}
+	sort.Strings(lines)
+	return a.writeInfo(strings.Join(lines, "\n"))
+}
+
+// profiles fills in profiles of account-registered members
+func (a *Agent) profiles(users []*goch.User) {
+	for _, u := range users {
+		if !u.Account {
+			continue
+		}
+		if acc, err := a.store.GetAccount(u.UID); err == nil {
+			u.Profile(acc)
+		}
+	}
+}
+
+// displayNameOf returns display name of chat member uid,
+// read from their account if they joined with one
+func (a *Agent) displayNameOf(ch *goch.Chat, uid string) string {
+	u, ok := ch.Members[uid]
+	if !ok {
+		return uid
+	}
+	if u.Account {
+		if acc, err := a.store.GetAccount(uid); err == nil {
+			return acc.DisplayName
+		}
+	}
+	return u.DisplayName
+}
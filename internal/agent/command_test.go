@@ -0,0 +1,213 @@
+package agent_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ribice/goch"
+)
+
+func TestCommands(t *testing.T) {
+	cases := []struct {
+		name       string
+		uid        string
+		text       string
+		wantErr    string
+		wantInfo   string
+		wantSystem string
+		wantMsg    string
+		wantAction string
+		setup      func(*goch.Chat)
+		check      func(*testing.T, *goch.Chat)
+	}{
+		{
+			name:    "Missing command name",
+			uid:     "john",
+			text:    "/ ",
+			wantErr: "missing command name, see /help",
+		},
+		{
+			name:    "Unknown command",
+			uid:     "john",
+			text:    "/dance",
+			wantErr: "unknown command /dance, see /help",
+		},
+		{
+			name:    "Escaped slash is sent as a message",
+			uid:     "john",
+			text:    "//shrug",
+			wantMsg: "/shrug",
+		},
+		{
+			name:       "Command names are case insensitive",
+			uid:        "john",
+			text:       "/ME waves",
+			wantAction: "waves",
+		},
+		{
+			name:    "Action is required",
+			uid:     "john",
+			text:    "/me  ",
+			wantErr: "usage: /me <action>",
+		},
+		{
+			name:    "Action is moderated",
+			uid:     "john",
+			text:    "/me sends spam",
+			wantErr: "message rejected: spam is not allowed",
+		},
+		{
+			name: "Muted member cannot send action",
+			uid:  "john",
+			text: "/me waves",
+			setup: func(ch *goch.Chat) {
+				ch.Mutes = map[string]*goch.Mute{"john": {UID: "john", Until: time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano()}}
+			},
+			wantErr: "not allowed to post: chat: you are muted until 2100-01-01T00:00:00Z",
+		},
+		{
+			name:    "Invalid arguments",
+			uid:     "bob",
+			text:    "/kick",
+			wantErr: "usage: /kick <uid>",
+		},
+		{
+			name:    "Member cannot kick",
+			uid:     "john",
+			text:    "/kick jane",
+			wantErr: "not allowed to use /kick: chat: insufficient permissions",
+		},
+		{
+			name:    "Moderator cannot kick owner",
+			uid:     "bob",
+			text:    "/kick alice",
+			wantErr: "/kick failed: chat: insufficient permissions",
+		},
+		{
+			name:       "Moderator kicks account member",
+			uid:        "bob",
+			text:       "/kick jane",
+			wantSystem: "Bob removed Jane Doe from the channel",
+			check: func(t *testing.T, ch *goch.Chat) {
+				if _, ok := ch.Members["jane"]; ok {
+					t.Error("expected kicked member to be removed")
+				}
+			},
+		},
+		{
+			name:    "Invalid mute duration",
+			uid:     "bob",
+			text:    "/mute john forever",
+			wantErr: "/mute failed: duration must be positive and at most a year, e.g. 10m or 2h",
+		},
+		{
+			name:       "Moderator mutes account member",
+			uid:        "bob",
+			text:       "/mute jane 10m",
+			wantSystem: "Bob muted Jane Doe for 10m0s",
+			check: func(t *testing.T, ch *goch.Chat) {
+				if err := ch.Authorize("jane", goch.PostPerm); err == nil {
+					t.Error("expected muted member not to be able to post")
+				}
+			},
+		},
+		{
+			name:     "Member reads topic",
+			uid:      "john",
+			text:     "/topic",
+			wantInfo: "Topic: Old topic",
+		},
+		{
+			name:    "Member cannot change topic",
+			uid:     "john",
+			text:    "/topic New topic",
+			wantErr: "/topic failed: chat: insufficient permissions",
+			check: func(t *testing.T, ch *goch.Chat) {
+				if ch.Topic != "Old topic" {
+					t.Errorf("expected topic not to change, got %s", ch.Topic)
+				}
+			},
+		},
+		{
+			name:       "Topic is moderated",
+			uid:        "bob",
+			text:       "/topic darn  good topic",
+			wantSystem: "Bob changed the topic to: **** good topic",
+			check: func(t *testing.T, ch *goch.Chat) {
+				if ch.Topic != "**** good topic" {
+					t.Errorf("expected redacted topic, got %s", ch.Topic)
+				}
+			},
+		},
+		{
+			name:    "Topic rejected by moderation",
+			uid:     "bob",
+			text:    "/topic buy spam",
+			wantErr: "/topic failed: spam is not allowed",
+		},
+		{
+			name:     "Who lists account profiles",
+			uid:      "john",
+			text:     "/who",
+			wantInfo: "4 members:\nAlice (alice) - owner, offline\nBob (bob) - moderator, offline\nJane Doe (jane) - member, offline\nJohn (john) - member, online",
+		},
+		{
+			name:     "Help lists permitted commands",
+			uid:      "john",
+			text:     "/help",
+			wantInfo: "/help - Lists commands available to you\n/me <action> - Describes what you are doing\n/topic [topic] - Shows channel topic, or changes it if provided\n/who - Lists channel members and their status",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := newChat()
+			if tc.setup != nil {
+				tc.setup(ch)
+			}
+			c, mb, _ := connect(t, ch, tc.uid)
+			defer c.close()
+
+			data, err := json.Marshal(map[string]interface{}{
+				"type": 0,
+				"data": map[string]string{"text": tc.text},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.send(string(data))
+
+			select {
+			case r := <-c.out:
+				var info string
+				json.Unmarshal(r.Data, &info)
+				switch {
+				case tc.wantErr != "" && (r.Type != errorMsg || r.Error != tc.wantErr):
+					t.Errorf("expected error %q, got %+v", tc.wantErr, r)
+				case tc.wantInfo != "" && (r.Type != infoMsg || info != tc.wantInfo):
+					t.Errorf("expected info %q, got %+v", tc.wantInfo, r)
+				case tc.wantErr == "" && tc.wantInfo == "":
+					t.Errorf("unexpected reply: %+v", r)
+				}
+			case m := <-mb.sent:
+				switch {
+				case tc.wantSystem != "" && (!m.System || m.Text != tc.wantSystem):
+					t.Errorf("expected system message %q, got %+v", tc.wantSystem, m)
+				case tc.wantMsg != "" && (m.System || m.Action || m.Text != tc.wantMsg || m.FromUID != tc.uid):
+					t.Errorf("expected message %q, got %+v", tc.wantMsg, m)
+				case tc.wantAction != "" && (m.System || !m.Action || m.Text != tc.wantAction || m.FromUID != tc.uid):
+					t.Errorf("expected action %q, got %+v", tc.wantAction, m)
+				case tc.wantSystem == "" && tc.wantMsg == "" && tc.wantAction == "":
+					t.Errorf("unexpected message: %+v", m)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("expected command to reply")
+			}
+
+			if tc.check != nil {
+				tc.check(t, ch)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ribice/goch"
+)
+
+// schedule stores message to be sent at sendAt, and
+// pushes connected user's scheduled messages to them
+func (a *Agent) schedule(m *goch.Message, sendAt int64) {
+	sm, err := goch.NewScheduled(a.chat.Name, m, sendAt)
+	if err != nil {
+		writeErr(a.conn, err.Error())
+		return
+	}
+
+	if err = a.store.ScheduleMessage(sm); err != nil {
+		writeErr(a.conn, fmt.Sprintf("could not schedule your message. try again: %v", err))
+		return
+	}
+
+	a.pushScheduled()
+}
+
+func (a *Agent) handleCancelScheduledMsg(raw json.RawMessage) {
+	var req struct {
+		ID string `json:"id"`
+	}
+
+	err := json.Unmarshal(raw, &req)
+	if err != nil {
+		writeErr(a.conn, fmt.Sprintf("invalid cancel scheduled message format: %v", err))
+		return
+	}
+
+	sm, err := a.store.GetScheduled(a.chat.Name, req.ID)
+	if err != nil || sm.Message.FromUID != a.uid {
+		writeErr(a.conn, "can only cancel your own scheduled messages")
+		return
+	}
+
+	if err = a.store.CancelScheduled(a.chat.Name, req.ID); err != nil {
+		writeErr(a.conn, fmt.Sprintf("could not cancel scheduled message: %v", err))
+		return
+	}
+
+	a.pushScheduled()
+}
+
+// pushScheduled sends messages connected user has scheduled in the chat
+func (a *Agent) pushScheduled() {
+	sms, err := a.store.ListScheduled(a.chat.Name, a.uid)
+	if err != nil {
+		writeErr(a.conn, fmt.Sprintf("could not fetch scheduled messages: %v", err))
+		return
+	}
+
+	if sms == nil {
+		sms = []*goch.Scheduled{}
+	}
+
+	a.conn.WriteJSON(msg{Type: scheduledMsg, Data: sms})
+}
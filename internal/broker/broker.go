@@ -26,11 +26,13 @@ type MQ interface {
 	Send(string, []byte) error
 	SubscribeSeq(string, string, uint64, func(uint64, []byte)) (io.Closer, error)
 	SubscribeTimestamp(string, string, time.Time, func(uint64, []byte)) (io.Closer, error)
+	Publish(string, []byte) error
+	Subscribe(string, func([]byte)) (io.Closer, error)
 }
 
 // Ingester represents chat history read model ingester
 type Ingester interface {
-	Run(string) (func(), error)
+	Subscribe(string) error
 }
 
 // ChatStore represents chat store interface
@@ -38,9 +40,13 @@ type ChatStore interface {
 	UpdateLastClientSeq(string, string, uint64)
 }
 
-// Subscribe subscribes to provided chat id at start sequence
+// Subscribe subscribes to provided chat id at start sequence, skipping
+// messages sent by uid. Subscribing with empty uid delivers all messages,
+// including system ones which have no sender.
 // Returns close subscription func, or an error.
 func (b *Broker) Subscribe(chatID, uid string, start uint64, c chan *goch.Message) (func(), error) {
+	done := make(chan struct{})
+
 	closer, err := b.mq.SubscribeSeq("chat."+chatID, uid, start, func(seq uint64, data []byte) {
 		msg, err := goch.DecodeMsg(data)
 		if err != nil {
@@ -53,8 +59,8 @@ func (b *Broker) Subscribe(chatID, uid string, start uint64, c chan *goch.Messag
 
 		msg.Seq = seq
 
-		if msg.FromUID != uid {
-			c <- msg
+		if uid == "" || msg.FromUID != uid {
+			send(c, msg, done)
 		} else {
 			b.store.UpdateLastClientSeq(msg.FromUID, chatID, seq)
 		}
@@ -64,18 +70,27 @@ func (b *Broker) Subscribe(chatID, uid string, start uint64, c chan *goch.Messag
 		return nil, err
 	}
 
-	cleanup, err := b.ig.Run(chatID)
-	if err != nil {
+	return func() {
+		close(done)
 		closer.Close()
-		return nil, fmt.Errorf("broker: unable to run ingest for chat: %v", err)
-	}
+	}, nil
+}
 
-	return func() { closer.Close(); cleanup() }, nil
+// send passes msg to c, unless subscription is closed before it is received.
+// Subscribers stop reading c once they close the subscription, which would
+// otherwise block delivery of the next message forever.
+func send(c chan *goch.Message, msg *goch.Message, done chan struct{}) {
+	select {
+	case c <- msg:
+	case <-done:
+	}
 }
 
 // SubscribeNew subscribes to provided chat id subject starting from time.Now()
 // Returns close subscription func, or an error.
 func (b *Broker) SubscribeNew(chatID, uid string, c chan *goch.Message) (func(), error) {
+	done := make(chan struct{})
+
 	closer, err := b.mq.SubscribeTimestamp("chat."+chatID, uid, time.Now(), func(seq uint64, data []byte) {
 		msg, err := goch.DecodeMsg(data)
 		if err != nil {
@@ -89,7 +104,7 @@ func (b *Broker) SubscribeNew(chatID, uid string, c chan *goch.Message) (func(),
 		msg.Seq = seq
 
 		if msg.FromUID != uid {
-			c <- msg
+			send(c, msg, done)
 		}
 	})
 
@@ -97,21 +112,61 @@ func (b *Broker) SubscribeNew(chatID, uid string, c chan *goch.Message) (func(),
 		return nil, err
 	}
 
-	cleanup, err := b.ig.Run(chatID)
-	if err != nil {
+	return func() {
+		close(done)
 		closer.Close()
-		return nil, fmt.Errorf("broker: unable to run ingest for chat: %v", err)
-	}
-
-	return func() { closer.Close(); cleanup() }, nil
+	}, nil
 }
 
-// Send sends new message to a given chat
+// Send sends new message to a given chat. Chat is subscribed to
+// by ingest beforehand, so the message is ingested even if none
+// of chat's members is connected.
 func (b *Broker) Send(chatID string, msg *goch.Message) error {
 	data, err := msg.Encode()
 	if err != nil {
 		return err
 	}
 
+	if err = b.ig.Subscribe(chatID); err != nil {
+		return fmt.Errorf("broker: unable to run ingest for chat: %v", err)
+	}
+
 	return b.mq.Send("chat."+chatID, data)
 }
+
+// SendEvent publishes ephemeral event to a given chat
+func (b *Broker) SendEvent(chatID string, ev *goch.Event) error {
+	data, err := ev.Encode()
+	if err != nil {
+		return err
+	}
+
+	return b.mq.Publish("events."+chatID, data)
+}
+
+// SubscribeEvents subscribes to ephemeral events in provided chat id,
+// excluding ones originating from uid.
+// Returns close subscription func, or an error.
+func (b *Broker) SubscribeEvents(chatID, uid string, c chan *goch.Event) (func(), error) {
+	done := make(chan struct{})
+
+	closer, err := b.mq.Subscribe("events."+chatID, func(data []byte) {
+		ev, err := goch.DecodeEvent(data)
+		if err != nil || ev.UID == uid {
+			return
+		}
+		select {
+		case c <- ev:
+		case <-done:
+		}
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		close(done)
+		closer.Close()
+	}, nil
+}
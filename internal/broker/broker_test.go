@@ -20,7 +20,6 @@ func TestSubscribe(t *testing.T) {
 		start   uint64
 		n       int
 		queue   queue
-		ingest  ingest
 		want    []goch.Message
 		wantErr bool
 	}{
@@ -36,23 +35,6 @@ func TestSubscribe(t *testing.T) {
 			start:   0,
 			wantErr: true,
 		},
-		{
-			name: "ingest run error",
-			chat: "general",
-			nick: "me",
-			queue: queue{
-				SubscribeSeqFunc: func(c string, n string, s uint64, f func(uint64, []byte)) (io.Closer, error) {
-					return &cl{}, nil
-				},
-			},
-			ingest: ingest{
-				RunFn: func(string) (func(), error) {
-					return nil, errTest
-				},
-			},
-			start:   0,
-			wantErr: true,
-		},
 		{
 			name:  "dont send own messages",
 			chat:  "general",
@@ -79,9 +61,6 @@ func TestSubscribe(t *testing.T) {
 					return &cl{}, nil
 				},
 			},
-			ingest: ingest{
-				RunFn: func(string) (func(), error) { return func() {}, nil },
-			},
 			want: []goch.Message{
 				{FromUID: "john", Text: "foo msg", Seq: 0},
 				{FromUID: "john", Text: "foo msg", Seq: 2},
@@ -89,6 +68,36 @@ func TestSubscribe(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name:  "send system messages to anonymous subscriber",
+			chat:  "general",
+			start: 0,
+			n:     3,
+			queue: queue{
+				SubscribeSeqFunc: func(c string, n string, s uint64, f func(uint64, []byte)) (io.Closer, error) {
+					msgs := []goch.Message{
+						{FromUID: "john", Text: "foo msg"},
+						{System: true, Text: "john changed the topic"},
+						{FromUID: "jane", Text: "bar msg"},
+					}
+
+					go func() {
+						for i, m := range msgs {
+							bts, _ := m.Encode()
+							f(uint64(i), bts)
+						}
+					}()
+
+					return &cl{}, nil
+				},
+			},
+			want: []goch.Message{
+				{FromUID: "john", Text: "foo msg", Seq: 0},
+				{System: true, Text: "john changed the topic", Seq: 1},
+				{FromUID: "jane", Text: "bar msg", Seq: 2},
+			},
+			wantErr: false,
+		},
 		{
 			name: "decoding error",
 			chat: "general",
@@ -118,9 +127,6 @@ func TestSubscribe(t *testing.T) {
 					return &cl{}, nil
 				},
 			},
-			ingest: ingest{
-				RunFn: func(string) (func(), error) { return func() {}, nil },
-			},
 			want: []goch.Message{
 				{FromUID: "john", Text: "foo msg", Seq: 0},
 				{FromUID: "broker", Text: "broker: message unavailable: decoding error", Seq: 2},
@@ -132,7 +138,7 @@ func TestSubscribe(t *testing.T) {
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			b := broker.New(&tc.queue, store{}, &tc.ingest)
+			b := broker.New(&tc.queue, store{}, nil)
 
 			c := make(chan *goch.Message)
 
@@ -171,14 +177,44 @@ func TestSubscribe(t *testing.T) {
 					t.Errorf("unexpected response. want: %v, got: %v", tc.want, msgs)
 				}
 			}
-
-			if !tc.ingest.RunCalled {
-				t.Errorf("ingest run should have been called but was not")
-			}
 		})
 	}
 }
 
+func TestSubscribeClose(t *testing.T) {
+	delivered := make(chan struct{})
+	q := &queue{
+		SubscribeSeqFunc: func(c string, n string, s uint64, f func(uint64, []byte)) (io.Closer, error) {
+			go func() {
+				for i := 1; i <= 3; i++ {
+					bts, _ := (&goch.Message{FromUID: "john", Text: "foo msg"}).Encode()
+					f(uint64(i), bts)
+				}
+				close(delivered)
+			}()
+			return &cl{}, nil
+		},
+	}
+	b := broker.New(q, store{}, nil)
+
+	c := make(chan *goch.Message)
+	closeSub, err := b.Subscribe("general", "", 1, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg := <-c; msg.Seq != 1 {
+		t.Fatalf("expected first message, got %+v", msg)
+	}
+	closeSub()
+
+	select {
+	case <-delivered:
+	case <-time.After(time.Second):
+		t.Error("expected delivery not to block once subscription is closed")
+	}
+}
+
 func TestSubscribeNew(t *testing.T) {
 	cases := []struct {
 		name    string
@@ -186,7 +222,6 @@ func TestSubscribeNew(t *testing.T) {
 		nick    string
 		n       int
 		queue   queue
-		ingest  ingest
 		want    []goch.Message
 		wantErr bool
 	}{
@@ -201,22 +236,6 @@ func TestSubscribeNew(t *testing.T) {
 			},
 			wantErr: true,
 		},
-		{
-			name: "ingest run error",
-			chat: "general",
-			nick: "me",
-			queue: queue{
-				SubscribeTimestampFunc: func(c string, n string, t time.Time, f func(uint64, []byte)) (io.Closer, error) {
-					return &cl{}, nil
-				},
-			},
-			ingest: ingest{
-				RunFn: func(string) (func(), error) {
-					return nil, errTest
-				},
-			},
-			wantErr: true,
-		},
 		{
 			name: "dont send own messages",
 			chat: "general",
@@ -242,9 +261,6 @@ func TestSubscribeNew(t *testing.T) {
 					return &cl{}, nil
 				},
 			},
-			ingest: ingest{
-				RunFn: func(string) (func(), error) { return func() {}, nil },
-			},
 			want: []goch.Message{
 				{FromUID: "john", Text: "foo msg", Seq: 0},
 				{FromUID: "john", Text: "foo msg", Seq: 2},
@@ -281,9 +297,6 @@ func TestSubscribeNew(t *testing.T) {
 					return &cl{}, nil
 				},
 			},
-			ingest: ingest{
-				RunFn: func(string) (func(), error) { return func() {}, nil },
-			},
 			want: []goch.Message{
 				{FromUID: "john", Text: "foo msg", Seq: 0},
 				{FromUID: "broker", Text: "broker: message unavailable: decoding error", Seq: 2},
@@ -295,7 +308,7 @@ func TestSubscribeNew(t *testing.T) {
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			b := broker.New(&tc.queue, store{}, &tc.ingest)
+			b := broker.New(&tc.queue, store{}, nil)
 
 			c := make(chan *goch.Message)
 
@@ -334,10 +347,6 @@ func TestSubscribeNew(t *testing.T) {
 					t.Errorf("unexpected response. want: %v, got: %v", tc.want, msgs)
 				}
 			}
-
-			if !tc.ingest.RunCalled {
-				t.Errorf("ingest run should have been called but was not")
-			}
 		})
 	}
 }
@@ -347,33 +356,95 @@ func TestSend(t *testing.T) {
 		name    string
 		msg     *goch.Message
 		q       queue
+		ingest  ingest
 		wantErr bool
-	}{{
-		name: "Fail on sending message",
-		msg:  &goch.Message{FromUID: "123"},
-		q: queue{
-			SendFunc: func(string, []byte) error {
-				return errors.New("failed sending message")
+	}{
+		{
+			name: "Fail on running ingest",
+			msg:  &goch.Message{FromUID: "123"},
+			q: queue{
+				SendFunc: func(string, []byte) error { return nil },
 			},
+			ingest:  ingest{err: errTest},
+			wantErr: true,
 		},
-		wantErr: true,
-	}}
+		{
+			name: "Fail on sending message",
+			msg:  &goch.Message{FromUID: "123"},
+			q: queue{
+				SendFunc: func(string, []byte) error {
+					return errors.New("failed sending message")
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Success",
+			msg:  &goch.Message{FromUID: "123"},
+			q: queue{
+				SendFunc: func(string, []byte) error { return nil },
+			},
+		},
+	}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			b := broker.New(&tc.q, nil, nil)
+			b := broker.New(&tc.q, nil, &tc.ingest)
 			err := b.Send("chatID", tc.msg)
 			if tc.wantErr != (err != nil) {
 				t.Errorf("Expected err (%v), received %v", tc.wantErr, err)
 			}
-
+			if tc.ingest.subscribed != "chatID" {
+				t.Errorf("expected ingest to subscribe to chat before sending, got %q", tc.ingest.subscribed)
+			}
 		})
 	}
 }
 
+func TestSubscribeEvents(t *testing.T) {
+	var handler func([]byte)
+	q := &queue{
+		SubscribeFunc: func(subj string, f func([]byte)) (io.Closer, error) {
+			if subj != "events.general" {
+				t.Errorf("unexpected subject %s", subj)
+			}
+			handler = f
+			return &cl{}, nil
+		},
+		PublishFunc: func(subj string, b []byte) error {
+			handler(b)
+			return nil
+		},
+	}
+	b := broker.New(q, nil, nil)
+
+	c := make(chan *goch.Event, 2)
+	closeSub, err := b.SubscribeEvents("general", "me", c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeSub()
+
+	if err = b.SendEvent("general", &goch.Event{Type: goch.PresenceEvent, UID: "me", Status: goch.OnlineStatus}); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.SendEvent("general", &goch.Event{Type: goch.PresenceEvent, UID: "you", Status: goch.AwayStatus}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c) != 1 {
+		t.Fatalf("expected only events from others to be delivered, got %d", len(c))
+	}
+	if ev := <-c; ev.UID != "you" || ev.Status != goch.AwayStatus {
+		t.Errorf("unexpected event %+v", ev)
+	}
+}
+
 type queue struct {
 	SubscribeSeqFunc       func(string, string, uint64, func(uint64, []byte)) (io.Closer, error)
 	SubscribeTimestampFunc func(string, string, time.Time, func(uint64, []byte)) (io.Closer, error)
 	SendFunc               func(string, []byte) error
+	PublishFunc            func(string, []byte) error
+	SubscribeFunc          func(string, func([]byte)) (io.Closer, error)
 }
 
 func (q *queue) SubscribeSeq(id string, nick string, start uint64, f func(uint64, []byte)) (io.Closer, error) {
@@ -388,18 +459,26 @@ func (q *queue) Send(s string, b []byte) error {
 	return q.SendFunc(s, b)
 }
 
+func (q *queue) Publish(s string, b []byte) error {
+	return q.PublishFunc(s, b)
+}
+
+func (q *queue) Subscribe(s string, f func([]byte)) (io.Closer, error) {
+	return q.SubscribeFunc(s, f)
+}
+
 type cl struct{}
 
 func (c *cl) Close() error { return nil }
 
 type ingest struct {
-	RunFn     func(string) (func(), error)
-	RunCalled bool
+	subscribed string
+	err        error
 }
 
-func (i *ingest) Run(s string) (func(), error) {
-	i.RunCalled = true
-	return i.RunFn(s)
+func (i *ingest) Subscribe(id string) error {
+	i.subscribed = id
+	return i.err
 }
 
 type store struct{}
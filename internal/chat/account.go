@@ -0,0 +1,207 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/ribice/goch"
+	"github.com/ribice/msv/render"
+)
+
+type accountReq struct {
+	UID         string `json:"uid"`
+	DisplayName string `json:"display_name"`
+	Email       string `json:"email"`
+	Secret      string `json:"secret"`
+}
+
+func (r *accountReq) Bind() error {
+	if !alfaRgx.MatchString(r.UID) {
+		return errors.New("uid must contain only alphanumeric and underscores")
+	}
+	if !alfaRgx.MatchString(r.Secret) {
+		return errors.New("secret must contain only alphanumeric and underscores")
+	}
+	if !mailRgx.MatchString(r.Email) {
+		return errors.New("invalid email address")
+	}
+	lims := map[string]goch.Limit{
+		r.UID:         goch.UIDLimit,
+		r.DisplayName: goch.DisplayNameLimit,
+	}
+	if r.Secret != "" {
+		lims[r.Secret] = goch.SecretLimit
+	}
+	return exceedsAny(lims)
+}
+
+func (api *API) createAccount(w http.ResponseWriter, r *http.Request) {
+	var req accountReq
+	if err := render.Bind(w, r, &req); err != nil {
+		return
+	}
+
+	acc, secret, err := goch.NewAccount(req.UID, req.DisplayName, req.Email, req.Secret)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not create account: %v", err), 500)
+		return
+	}
+
+	if err = api.store.CreateAccount(acc); err != nil {
+		http.Error(w, fmt.Sprintf("could not create account: %v", err), 500)
+		return
+	}
+
+	render.JSON(w, registerResp{secret})
+}
+
+func (api *API) getAccount(w http.ResponseWriter, r *http.Request) {
+	acc, err := api.account(w, mux.Vars(r)["uid"], r.URL.Query().Get("secret"))
+	if err != nil {
+		return
+	}
+
+	render.JSON(w, acc.Public())
+}
+
+type updateAccountReq struct {
+	Secret      string  `json:"secret"`
+	DisplayName *string `json:"display_name"`
+	Email       *string `json:"email"`
+	NewSecret   string  `json:"new_secret"`
+}
+
+func (r *updateAccountReq) Bind() error {
+	if r.DisplayName != nil {
+		if err := exceeds(*r.DisplayName, goch.DisplayNameLimit); err != nil {
+			return err
+		}
+	}
+	if r.Email != nil && !mailRgx.MatchString(*r.Email) {
+		return errors.New("invalid email address")
+	}
+	if r.NewSecret == "" {
+		return nil
+	}
+	if !alfaRgx.MatchString(r.NewSecret) {
+		return errors.New("new_secret must contain only alphanumeric and underscores")
+	}
+	return exceeds(r.NewSecret, goch.SecretLimit)
+}
+
+func (api *API) updateAccount(w http.ResponseWriter, r *http.Request) {
+	var req updateAccountReq
+	if err := render.Bind(w, r, &req); err != nil {
+		return
+	}
+
+	acc, err := api.account(w, mux.Vars(r)["uid"], req.Secret)
+	if err != nil {
+		return
+	}
+
+	if req.DisplayName != nil {
+		acc.DisplayName = *req.DisplayName
+	}
+	if req.Email != nil {
+		acc.Email = *req.Email
+	}
+	if req.NewSecret != "" {
+		if err = acc.SetSecret(req.NewSecret); err != nil {
+			http.Error(w, fmt.Sprintf("could not update account: %v", err), 500)
+			return
+		}
+	}
+
+	if err = api.store.SaveAccount(acc); err != nil {
+		http.Error(w, fmt.Sprintf("could not update account: %v", err), 500)
+		return
+	}
+
+	render.JSON(w, acc.Public())
+}
+
+type joinChannelReq struct {
+	Secret string `json:"secret"`
+	accessReq
+}
+
+func (r *joinChannelReq) Bind() error {
+	return r.accessReq.Bind()
+}
+
+func (api *API) joinChannel(w http.ResponseWriter, r *http.Request) {
+	var req joinChannelReq
+	if err := render.Bind(w, r, &req); err != nil {
+		return
+	}
+
+	acc, err := api.account(w, mux.Vars(r)["uid"], req.Secret)
+	if err != nil {
+		return
+	}
+
+	ch, err := api.enter(w, req.accessReq)
+	if err != nil {
+		return
+	}
+
+	if err = ch.RegisterAccount(acc); err != nil {
+		http.Error(w, fmt.Sprintf("error registering to channel: %v", err), 500)
+		return
+	}
+
+	if err = api.useInvite(w, req.accessReq); err != nil {
+		return
+	}
+
+	if err = api.store.Save(ch); err != nil {
+		api.releaseInvite(req.accessReq)
+		http.Error(w, fmt.Sprintf("could not update channel membership: %v", err), 500)
+		return
+	}
+
+	if err = api.store.AddAccountChannel(acc.UID, ch.Name); err != nil {
+		http.Error(w, fmt.Sprintf("could not update account: %v", err), 500)
+	}
+}
+
+// account fetches account and verifies its secret.
+// On failure, an error is written to w.
+func (api *API) account(w http.ResponseWriter, uid, secret string) (*goch.Account, error) {
+	if err := exceedsAny(map[string]goch.Limit{
+		uid:    goch.UIDLimit,
+		secret: goch.SecretLimit,
+	}); err != nil {
+		http.Error(w, err.Error(), 400)
+		return nil, err
+	}
+
+	acc, err := api.store.GetAccount(uid)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid secret or unexisting account: %v", err), 500)
+		return nil, err
+	}
+
+	if !acc.VerifySecret(secret) {
+		err = errors.New("invalid secret")
+		http.Error(w, err.Error(), 500)
+		return nil, err
+	}
+
+	return acc, nil
+}
+
+// profiles fills in profiles of account-registered members
+func (api *API) profiles(users []*goch.User) {
+	for _, u := range users {
+		if !u.Account {
+			continue
+		}
+		if acc, err := api.store.GetAccount(u.UID); err == nil {
+			u.Profile(acc)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package chat_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/ribice/goch"
+	"github.com/ribice/goch/internal/chat"
+)
+
+const accUID = "ACCOUNT1234567890123"
+
+func TestAccounts(t *testing.T) {
+	accs := make(map[string]*goch.Account)
+	joined := make(map[string]string)
+	ch := &goch.Chat{Name: "1234567890", Secret: "ABCDEFGHIJDKLOMNSOPR", Members: map[string]*goch.User{}}
+
+	s := &store{
+		GetFunc:  func(string) (*goch.Chat, error) { return ch, nil },
+		SaveFunc: func(c *goch.Chat) error { ch = c; return nil },
+		CreateAccountFunc: func(a *goch.Account) error {
+			if _, ok := accs[a.UID]; ok {
+				return errors.New("account already exists")
+			}
+			accs[a.UID] = a
+			return nil
+		},
+		SaveAccountFunc: func(a *goch.Account) error { accs[a.UID] = a; return nil },
+		GetAccountFunc: func(uid string) (*goch.Account, error) {
+			a, ok := accs[uid]
+			if !ok {
+				return nil, errors.New("account not found")
+			}
+			ac := *a
+			ac.Channels = []string{joined[uid]}
+			return &ac, nil
+		},
+		AddAccountChanFunc: func(uid, chanName string) error { joined[uid] = chanName; return nil },
+	}
+	m := mux.NewRouter()
+	chat.New(m, s, &events{}, cfg, middleware)
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	do := func(method, path string, body interface{}, wantCode int, resp interface{}) {
+		t.Helper()
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest(method, srv.URL+path, bytes.NewBuffer(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != wantCode {
+			t.Fatalf("%s %s: unexpected response code. want: %d, got: %d", method, path, wantCode, res.StatusCode)
+		}
+		if resp != nil {
+			if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	do("POST", "/accounts", map[string]string{"uid": accUID, "display_name": "John", "email": "invalid"}, http.StatusBadRequest, nil)
+
+	var reg struct {
+		Secret string `json:"secret"`
+	}
+	do("POST", "/accounts", map[string]string{"uid": accUID, "display_name": "John", "email": "john@doe.com"}, http.StatusOK, &reg)
+	do("POST", "/accounts", map[string]string{"uid": accUID, "display_name": "John", "email": "john@doe.com"}, http.StatusInternalServerError, nil)
+
+	do("PATCH", "/accounts/"+accUID, map[string]string{"secret": "INVALID1234567890123", "display_name": "Johnny"}, http.StatusInternalServerError, nil)
+	do("PATCH", "/accounts/"+accUID, map[string]string{"secret": reg.Secret, "display_name": "Johnny"}, http.StatusOK, nil)
+
+	do("POST", "/accounts/"+accUID+"/channels", map[string]string{"secret": reg.Secret, "channel": ch.Name, "channel_secret": "INVALIDSECRET1234567"}, http.StatusInternalServerError, nil)
+	do("POST", "/accounts/"+accUID+"/channels", map[string]string{"secret": reg.Secret, "channel": ch.Name, "channel_secret": ch.Secret}, http.StatusOK, nil)
+
+	if m := ch.Members[accUID]; m == nil || !m.Account || m.DisplayName != "" {
+		t.Errorf("expected channel to reference account, got %+v", m)
+	}
+
+	var acc goch.Account
+	do("GET", "/accounts/"+accUID+"?secret="+reg.Secret, nil, http.StatusOK, &acc)
+	if acc.DisplayName != "Johnny" || len(acc.Channels) != 1 || acc.Channels[0] != ch.Name || acc.SecretHash != nil {
+		t.Errorf("unexpected account %+v", acc)
+	}
+
+	var members []goch.User
+	do("GET", "/channels/"+ch.Name+"?secret="+ch.Secret, nil, http.StatusOK, &members)
+	if len(members) != 1 || members[0].DisplayName != "Johnny" {
+		t.Errorf("expected member profile to be filled from account, got %+v", members)
+	}
+
+	// Channel endpoints authenticate account members with account secret
+	ch.Members[accUID].Role = goch.ModeratorRole
+	s.SaveInviteFunc = func(*goch.Invite) error { return nil }
+	do("POST", "/channels/"+ch.Name+"/invites", map[string]string{"uid": accUID, "secret": reg.Secret}, http.StatusOK, nil)
+}
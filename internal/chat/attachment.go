@@ -0,0 +1,164 @@
+package chat
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/ribice/goch"
+	"github.com/ribice/msv/render"
+)
+
+const maxFileNameLength = 255
+
+// NewAttachmentAPI creates new attachment upload/download api. Member
+// credentials are checked the same way as in api created with New.
+func NewAttachmentAPI(m *mux.Router, store AttachmentStore, bs BlobStore, maxSize int64) *AttachmentAPI {
+	api := AttachmentAPI{
+		API:     API{store: store},
+		store:   store,
+		blobs:   bs,
+		maxSize: maxSize,
+	}
+
+	sr := m.PathPrefix("/channels/{name}/attachments").Subrouter()
+	sr.HandleFunc("", api.upload).Methods("POST")
+	sr.HandleFunc("/{id}", api.download).Methods("GET")
+
+	return &api
+}
+
+// AttachmentAPI represents attachment api service
+type AttachmentAPI struct {
+	API
+	store   AttachmentStore
+	blobs   BlobStore
+	maxSize int64
+}
+
+// AttachmentStore represents attachment metadata store interface
+type AttachmentStore interface {
+	Store
+	SaveAttachment(string, *goch.Attachment) error
+	GetAttachment(string, string) (*goch.Attachment, error)
+	AttachmentReferenced(string, string) (bool, error)
+}
+
+// BlobStore represents attachment content store interface
+type BlobStore interface {
+	Put(string, io.Reader) error
+	Get(string) (io.ReadCloser, error)
+}
+
+func (api *AttachmentAPI) upload(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" || len(name) > maxFileNameLength || strings.ContainsAny(name, "/\\") {
+		http.Error(w, fmt.Sprintf("name must be between 1 and %d characters long and must not contain slashes", maxFileNameLength), 400)
+		return
+	}
+
+	if r.ContentLength > api.maxSize {
+		http.Error(w, fmt.Sprintf("attachment exceeds max size of %d bytes", api.maxSize), 413)
+		return
+	}
+
+	mr, err := queryMember(w, r)
+	if err != nil {
+		return
+	}
+
+	ch, err := api.authorize(w, mux.Vars(r)["name"], mr, goch.PostPerm)
+	if err != nil {
+		return
+	}
+
+	ct := r.Header.Get("Content-Type")
+	if _, _, err := mime.ParseMediaType(ct); err != nil {
+		ct = "application/octet-stream"
+	}
+
+	att, err := goch.NewAttachment(name, ct, mr.UID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	h := sha256.New()
+	cr := &countingReader{r: io.TeeReader(http.MaxBytesReader(w, r.Body, api.maxSize), h)}
+
+	if err = api.blobs.Put(goch.BlobKey(ch.Name, att.ID), cr); err != nil {
+		if cr.n >= api.maxSize {
+			http.Error(w, fmt.Sprintf("attachment exceeds max size of %d bytes", api.maxSize), 413)
+			return
+		}
+		http.Error(w, fmt.Sprintf("could not store attachment: %v", err), 500)
+		return
+	}
+
+	att.Size = cr.n
+	att.Digest = hex.EncodeToString(h.Sum(nil))
+
+	if err = api.store.SaveAttachment(ch.Name, att); err != nil {
+		http.Error(w, fmt.Sprintf("could not save attachment: %v", err), 500)
+		return
+	}
+
+	render.JSON(w, att)
+}
+
+func (api *AttachmentAPI) download(w http.ResponseWriter, r *http.Request) {
+	mr, err := queryMember(w, r)
+	if err != nil {
+		return
+	}
+
+	ch, err := api.authorize(w, mux.Vars(r)["name"], mr, goch.ReadPerm)
+	if err != nil {
+		return
+	}
+
+	att, err := api.store.GetAttachment(ch.Name, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "attachment not found", 404)
+		return
+	}
+
+	// Uploads not yet sent with any message are private to their uploader
+	if att.UploadedBy != mr.UID {
+		if ok, err := api.store.AttachmentReferenced(ch.Name, att.ID); err != nil || !ok {
+			http.Error(w, "attachment not found", 404)
+			return
+		}
+	}
+
+	rc, err := api.blobs.Get(goch.BlobKey(ch.Name, att.ID))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not read attachment: %v", err), 500)
+		return
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", att.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(att.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": att.Name}))
+	// Prevents browsers from rendering uploaded content as a different type
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	io.Copy(w, rc)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
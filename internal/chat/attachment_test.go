@@ -0,0 +1,200 @@
+package chat_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/ribice/goch"
+	"github.com/ribice/goch/internal/chat"
+)
+
+func TestAttachments(t *testing.T) {
+	s := &attStore{atts: make(map[string]*goch.Attachment), refs: make(map[string]bool)}
+	s.store = &store{GetFunc: s.Get, SaveFunc: func(*goch.Chat) error { return nil }}
+	bs := &blobs{data: make(map[string][]byte)}
+
+	m := mux.NewRouter()
+	chat.New(m, s.store, &events{}, cfg, middleware)
+	chat.NewAttachmentAPI(m, s, bs, 16)
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	creds := "uid=" + memberUID + "&secret=" + memSecret
+	upload := func(query, body string) *http.Response {
+		res, err := http.Post(srv.URL+"/channels/1234567890/attachments?"+query, "text/plain", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	cases := []struct {
+		name     string
+		query    string
+		body     string
+		wantCode int
+	}{
+		{name: "Missing file name", query: creds, body: "hello", wantCode: http.StatusBadRequest},
+		{name: "Invalid file name", query: creds + "&name=../a.txt", body: "hello", wantCode: http.StatusBadRequest},
+		{name: "Invalid secret", query: "uid=" + memberUID + "&secret=00000000000000000000&name=a.txt", body: "hello", wantCode: http.StatusInternalServerError},
+		{name: "Guest cannot upload", query: "uid=GUEST123456789012345&secret=" + memSecret + "&name=a.txt", body: "hello", wantCode: http.StatusForbidden},
+		{name: "Exceeds max size", query: creds + "&name=a.txt", body: "more than sixteen bytes", wantCode: http.StatusRequestEntityTooLarge},
+		{name: "Success", query: creds + "&name=a.txt", body: "hello", wantCode: http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := upload(tc.query, tc.body)
+			if res.StatusCode != tc.wantCode {
+				t.Errorf("unexpected response code. want: %d, got: %d", tc.wantCode, res.StatusCode)
+			}
+		})
+	}
+
+	if len(s.atts) != 1 {
+		t.Fatalf("expected 1 attachment to be saved but got %d", len(s.atts))
+	}
+
+	var att *goch.Attachment
+	for _, a := range s.atts {
+		att = a
+	}
+
+	if att.Size != 5 || att.ContentType != "text/plain" || att.UploadedBy != memberUID ||
+		att.Digest != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("unexpected attachment metadata: %v", att)
+	}
+
+	res, err := http.Get(srv.URL + "/channels/1234567890/attachments/unknown?" + creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("unexpected response code. want: %d, got: %d", http.StatusNotFound, res.StatusCode)
+	}
+
+	if len(att.ID) != 32 {
+		t.Errorf("expected random 128-bit attachment id, got %q", att.ID)
+	}
+
+	guest := "?uid=GUEST123456789012345&secret=" + memSecret
+	res, err = http.Get(srv.URL + "/channels/1234567890/attachments/" + att.ID + guest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected upload not sent with any message to be hidden from others, got %d", res.StatusCode)
+	}
+
+	res, err = http.Get(srv.URL + "/channels/1234567890/attachments/" + att.ID + "?" + creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected uploader to download their upload, got %d", res.StatusCode)
+	}
+
+	s.refs["1234567890."+att.ID] = true
+	res, err = http.Get(srv.URL + "/channels/1234567890/attachments/" + att.ID + guest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected response code. want: %d, got: %d", http.StatusOK, res.StatusCode)
+	}
+
+	bts, err := ioutil.ReadAll(res.Body)
+	if err != nil || string(bts) != "hello" {
+		t.Errorf("expected content %q but got %q (%v)", "hello", bts, err)
+	}
+
+	if cd := res.Header.Get("Content-Disposition"); cd != `attachment; filename=a.txt` {
+		t.Errorf("unexpected content disposition: %s", cd)
+	}
+
+	if nosniff := res.Header.Get("X-Content-Type-Options"); nosniff != "nosniff" {
+		t.Errorf("expected content type sniffing to be disabled, got %q", nosniff)
+	}
+	// Private chats keep no credentials, so they have no attachments
+	dm := srv.URL + "/channels/direct1234/attachments"
+	res, err = http.Post(dm+"?"+creds+"&name=a.txt", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("expected upload to private chat to be forbidden, got %d", res.StatusCode)
+	}
+
+	res, err = http.Get(dm + "/" + att.ID + "?" + creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("expected download from private chat to be forbidden, got %d", res.StatusCode)
+	}
+}
+
+type attStore struct {
+	*store
+	atts map[string]*goch.Attachment
+	refs map[string]bool
+}
+
+func (s *attStore) Get(name string) (*goch.Chat, error) {
+	if name == "direct1234" {
+		return &goch.Chat{Name: name, Direct: true, Members: map[string]*goch.User{
+			memberUID: {UID: memberUID, Role: goch.MemberRole},
+		}}, nil
+	}
+	ch := moderatedChan()
+	ch.Members["GUEST123456789012345"] = &goch.User{UID: "GUEST123456789012345", Secret: memSecret, Role: goch.GuestRole}
+	return ch, nil
+}
+
+func (s *attStore) GetAccount(uid string) (*goch.Account, error) {
+	return nil, errors.New("account not found")
+}
+
+func (s *attStore) SaveAttachment(id string, a *goch.Attachment) error {
+	s.atts[id+"."+a.ID] = a
+	return nil
+}
+
+func (s *attStore) GetAttachment(id, attID string) (*goch.Attachment, error) {
+	a, ok := s.atts[id+"."+attID]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return a, nil
+}
+
+func (s *attStore) AttachmentReferenced(id, attID string) (bool, error) {
+	return s.refs[id+"."+attID], nil
+}
+
+type blobs struct {
+	data map[string][]byte
+}
+
+func (b *blobs) Put(key string, r io.Reader) error {
+	bts, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	b.data[key] = bts
+	return nil
+}
+
+func (b *blobs) Get(key string) (io.ReadCloser, error) {
+	bts, ok := b.data[key]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return ioutil.NopCloser(bytes.NewReader(bts)), nil
+}
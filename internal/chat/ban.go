@@ -0,0 +1,156 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ribice/goch"
+	"github.com/ribice/msv/render"
+)
+
+const maxReasonLength = 256
+
+type banReq struct {
+	kickReq
+	Reason string `json:"reason"`
+}
+
+func (r *banReq) Bind() error {
+	if err := r.kickReq.Bind(); err != nil {
+		return err
+	}
+	if len(r.Reason) > maxReasonLength {
+		return fmt.Errorf("reason must be at most %d characters long", maxReasonLength)
+	}
+	return nil
+}
+
+func (api *API) ban(w http.ResponseWriter, r *http.Request) {
+	var req banReq
+	if err := render.Bind(w, r, &req); err != nil {
+		return
+	}
+
+	ch, err := api.authorize(w, mux.Vars(r)["name"], req.memberReq, goch.BanPerm)
+	if err != nil {
+		return
+	}
+
+	// Users who are not members can be banned preemptively
+	if _, ok := ch.Members[req.Target]; ok {
+		if err = ch.AuthorizeOn(req.UID, req.Target, goch.BanPerm); err != nil {
+			http.Error(w, err.Error(), 403)
+			return
+		}
+	}
+
+	account := ch.IsAccount(req.Target)
+	if err = ch.Ban(req.Target, req.UID, req.Reason); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	if err = api.saveMembership(w, ch); err != nil {
+		return
+	}
+
+	api.notifyUpdate(ch.Name)
+
+	if account {
+		api.store.RemoveAccountChannel(req.Target, ch.Name)
+	}
+}
+
+func (api *API) unban(w http.ResponseWriter, r *http.Request) {
+	var req kickReq
+	if err := render.Bind(w, r, &req); err != nil {
+		return
+	}
+
+	ch, err := api.authorize(w, mux.Vars(r)["name"], req.memberReq, goch.BanPerm)
+	if err != nil {
+		return
+	}
+
+	if err = ch.Unban(req.Target); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	api.saveMembership(w, ch)
+}
+
+func (api *API) listBans(w http.ResponseWriter, r *http.Request) {
+	mr, err := queryMember(w, r)
+	if err != nil {
+		return
+	}
+
+	ch, err := api.authorize(w, mux.Vars(r)["name"], mr, goch.BanPerm)
+	if err != nil {
+		return
+	}
+
+	render.JSON(w, ch.ListBans())
+}
+
+type muteReq struct {
+	kickReq
+	Duration int64 `json:"duration"` // Seconds
+}
+
+func (r *muteReq) Bind() error {
+	if err := r.kickReq.Bind(); err != nil {
+		return err
+	}
+	if r.Duration <= 0 || r.Duration > int64(goch.MaxMuteDuration/time.Second) {
+		return errors.New("duration must be between 1 second and 1 year")
+	}
+	return nil
+}
+
+func (api *API) mute(w http.ResponseWriter, r *http.Request) {
+	var req muteReq
+	if err := render.Bind(w, r, &req); err != nil {
+		return
+	}
+
+	ch, err := api.authorize(w, mux.Vars(r)["name"], req.memberReq, goch.MutePerm)
+	if err != nil {
+		return
+	}
+
+	if err = ch.AuthorizeOn(req.UID, req.Target, goch.MutePerm); err != nil {
+		http.Error(w, err.Error(), 403)
+		return
+	}
+
+	if err = ch.Mute(req.Target, req.UID, time.Duration(req.Duration)*time.Second); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	api.saveMembership(w, ch)
+}
+
+func (api *API) unmute(w http.ResponseWriter, r *http.Request) {
+	var req kickReq
+	if err := render.Bind(w, r, &req); err != nil {
+		return
+	}
+
+	ch, err := api.authorize(w, mux.Vars(r)["name"], req.memberReq, goch.MutePerm)
+	if err != nil {
+		return
+	}
+
+	if err = ch.Unmute(req.Target); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	api.saveMembership(w, ch)
+}
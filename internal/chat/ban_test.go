@@ -0,0 +1,141 @@
+package chat_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/ribice/goch"
+	"github.com/ribice/goch/internal/chat"
+)
+
+func TestBanAndMute(t *testing.T) {
+	const outsider = "OUTSIDER123456789012"
+	cases := []struct {
+		name       string
+		path       string
+		req        map[string]interface{}
+		saveErr    error
+		wantCode   int
+		wantUpdate bool
+		check      func(*testing.T, *goch.Chat)
+	}{
+		{
+			name:     "Member cannot ban",
+			path:     "/ban",
+			req:      map[string]interface{}{"uid": memberUID, "secret": memSecret, "target": modUID},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Moderator cannot ban owner",
+			path:     "/ban",
+			req:      map[string]interface{}{"uid": modUID, "secret": memSecret, "target": ownerUID},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:       "Moderator bans member",
+			path:       "/ban",
+			req:        map[string]interface{}{"uid": modUID, "secret": memSecret, "target": memberUID, "reason": "spam"},
+			wantCode:   http.StatusOK,
+			wantUpdate: true,
+			check: func(t *testing.T, c *goch.Chat) {
+				if !c.IsBanned(memberUID) || c.Bans[memberUID].Reason != "spam" {
+					t.Error("expected member to be banned")
+				}
+				if _, ok := c.Members[memberUID]; ok {
+					t.Error("expected banned member to be removed")
+				}
+			},
+		},
+		{
+			name:     "Concurrently modified channel",
+			path:     "/ban",
+			req:      map[string]interface{}{"uid": modUID, "secret": memSecret, "target": memberUID},
+			saveErr:  goch.ErrChatConflict,
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:       "Moderator bans non-member",
+			path:       "/ban",
+			req:        map[string]interface{}{"uid": modUID, "secret": memSecret, "target": outsider},
+			wantCode:   http.StatusOK,
+			wantUpdate: true,
+			check: func(t *testing.T, c *goch.Chat) {
+				if !c.IsBanned(outsider) {
+					t.Error("expected outsider to be banned")
+				}
+			},
+		},
+		{
+			name:     "Unban user who is not banned",
+			path:     "/unban",
+			req:      map[string]interface{}{"uid": modUID, "secret": memSecret, "target": memberUID},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Invalid mute duration",
+			path:     "/mute",
+			req:      map[string]interface{}{"uid": modUID, "secret": memSecret, "target": memberUID},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Moderator mutes member",
+			path:     "/mute",
+			req:      map[string]interface{}{"uid": modUID, "secret": memSecret, "target": memberUID, "duration": 60},
+			wantCode: http.StatusOK,
+			check: func(t *testing.T, c *goch.Chat) {
+				if err := c.Authorize(memberUID, goch.PostPerm); err == nil {
+					t.Error("expected muted member not to be able to post")
+				}
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var saved *goch.Chat
+			s := &store{
+				GetFunc: func(string) (*goch.Chat, error) { return moderatedChan(), nil },
+				SaveFunc: func(c *goch.Chat) error {
+					if tc.saveErr != nil {
+						return tc.saveErr
+					}
+					saved = c
+					return nil
+				},
+			}
+			ev := &events{}
+			m := mux.NewRouter()
+			chat.New(m, s, ev, cfg, middleware)
+			srv := httptest.NewServer(m)
+			defer srv.Close()
+
+			req, err := json.Marshal(tc.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := http.Post(srv.URL+"/channels/1234567890"+tc.path, "application/json", bytes.NewBuffer(req))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.StatusCode != tc.wantCode {
+				t.Errorf("unexpected response code. want: %d, got: %d", tc.wantCode, res.StatusCode)
+			}
+
+			if updated := len(ev.sent) == 1 && ev.sent[0].Type == goch.ChatUpdateEvent; updated != tc.wantUpdate {
+				t.Errorf("expected chat update event to be sent: %v, got %v", tc.wantUpdate, ev.sent)
+			}
+
+			if tc.check != nil {
+				if saved == nil {
+					t.Fatal("expected channel to be saved")
+				}
+				tc.check(t, saved)
+			}
+		})
+	}
+}
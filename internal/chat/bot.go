@@ -0,0 +1,283 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ribice/goch"
+	"github.com/ribice/msv/render"
+)
+
+const botRateWindow = time.Minute
+
+// NewBotAPI creates new bot api. Bots are managed by admins, and post
+// messages over HTTP using their token, at most rate messages per minute.
+func NewBotAPI(m *mux.Router, store BotStore, mb MessageBroker, mod Moderator, l Limiter, rate int, authMW mux.MiddlewareFunc) *BotAPI {
+	api := BotAPI{
+		store: store,
+		mb:    mb,
+		mod:   mod,
+		lim:   l,
+		rate:  int64(rate),
+	}
+
+	ar := m.PathPrefix("/admin/channels/{chanName}/bots").Subrouter()
+	ar.Use(authMW)
+	ar.HandleFunc("", api.createBot).Methods("POST")
+	ar.HandleFunc("/{uid}", api.deleteBot).Methods("DELETE")
+
+	m.HandleFunc("/channels/{name}/bots/{uid}/messages", api.postMessage).Methods("POST")
+	// Token is part of the URL for tools supporting only Slack-style incoming webhooks
+	m.HandleFunc("/hooks/{name}/{uid}/{token}", api.postHook).Methods("POST")
+
+	return &api
+}
+
+// BotAPI represents bot api service
+type BotAPI struct {
+	store BotStore
+	mb    MessageBroker
+	mod   Moderator
+	lim   Limiter
+	rate  int64
+}
+
+// BotStore represents bot api store interface
+type BotStore interface {
+	Get(string) (*goch.Chat, error)
+	Save(*goch.Chat) error
+	AllowPost(string, string, int64, time.Duration) (bool, error)
+}
+
+// MessageBroker represents message broker interface
+type MessageBroker interface {
+	Send(string, *goch.Message) error
+}
+
+// Moderator represents outgoing message moderation interface
+type Moderator interface {
+	Moderate(string, *goch.Message) error
+}
+
+type botReq struct {
+	UID         string `json:"uid"`
+	DisplayName string `json:"display_name"`
+}
+
+func (r *botReq) Bind() error {
+	if !alfaRgx.MatchString(r.UID) {
+		return errors.New("uid must contain only alphanumeric and underscores")
+	}
+	return nil
+}
+
+type botResp struct {
+	UID         string `json:"uid"`
+	DisplayName string `json:"display_name"`
+	Token       string `json:"token"`
+}
+
+func (api *BotAPI) createBot(w http.ResponseWriter, r *http.Request) {
+	var req botReq
+	if err := render.Bind(w, r, &req); err != nil {
+		return
+	}
+
+	chanName := mux.Vars(r)["chanName"]
+	if err := api.lim.ExceedsAny(map[string]goch.Limit{
+		chanName:        goch.ChanLimit,
+		req.UID:         goch.UIDLimit,
+		req.DisplayName: goch.DisplayNameLimit,
+	}); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	ch, err := api.store.Get(chanName)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unexisting channel: %v", err), 500)
+		return
+	}
+
+	token, err := ch.RegisterBot(req.UID, req.DisplayName)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error registering bot: %v", err), 500)
+		return
+	}
+
+	if err = api.store.Save(ch); err != nil {
+		http.Error(w, fmt.Sprintf("could not create bot: %v", err), 500)
+		return
+	}
+
+	// Token is returned only on creation
+	render.JSON(w, &botResp{UID: req.UID, DisplayName: req.DisplayName, Token: token})
+}
+
+func (api *BotAPI) deleteBot(w http.ResponseWriter, r *http.Request) {
+	chanName := mux.Vars(r)["chanName"]
+	if err := api.lim.Exceeds(chanName, goch.ChanLimit); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	ch, err := api.store.Get(chanName)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unexisting channel: %v", err), 500)
+		return
+	}
+
+	if err = ch.RemoveBot(mux.Vars(r)["uid"]); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	if err = api.store.Save(ch); err != nil {
+		http.Error(w, fmt.Sprintf("could not delete bot: %v", err), 500)
+	}
+}
+
+// botMsgReq represents message posted by a bot. Fields of Slack's incoming
+// webhook payload other than text and attachments, e.g. username or
+// icon_emoji, are ignored, as messages are always shown as posted by the bot.
+type botMsgReq struct {
+	Text        string            `json:"text"`
+	Meta        map[string]string `json:"meta"`
+	Attachments []slackAttachment `json:"attachments"`
+	TTL         int64             `json:"ttl"` // Seconds after which message expires, channel's default if zero
+}
+
+type slackAttachment struct {
+	Fallback string `json:"fallback"`
+	Pretext  string `json:"pretext"`
+	Title    string `json:"title"`
+	Text     string `json:"text"`
+}
+
+// Bind joins text of Slack attachments to message text
+func (r *botMsgReq) Bind() error {
+	lines := []string{r.Text}
+	for _, a := range r.Attachments {
+		lines = append(lines, a.Pretext, a.Title, a.Text)
+		if a.Title == "" && a.Text == "" {
+			lines = append(lines, a.Fallback)
+		}
+	}
+
+	var text []string
+	for _, l := range lines {
+		if l = strings.TrimSpace(l); l != "" {
+			text = append(text, l)
+		}
+	}
+	r.Text = strings.Join(text, "\n")
+
+	if r.Text == "" {
+		return errors.New("sent empty message")
+	}
+	if len(r.Text) > goch.MaxTextLength {
+		return fmt.Errorf("exceeded max message length of %d characters", goch.MaxTextLength)
+	}
+	return nil
+}
+
+func (api *BotAPI) postMessage(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		http.Error(w, "bot token must be provided as bearer token", 401)
+		return
+	}
+
+	api.post(w, r, strings.TrimPrefix(auth, "Bearer "))
+}
+
+func (api *BotAPI) postHook(w http.ResponseWriter, r *http.Request) {
+	if api.post(w, r, mux.Vars(r)["token"]) {
+		// Slack responds with plain ok, which some tools expect
+		w.Write([]byte("ok"))
+	}
+}
+
+// post sends message in request body on behalf of the bot, and reports
+// whether it succeeded. On failure, an error is written to w.
+func (api *BotAPI) post(w http.ResponseWriter, r *http.Request, token string) bool {
+	var req botMsgReq
+	if err := render.Bind(w, r, &req); err != nil {
+		return false
+	}
+
+	chanName, uid := mux.Vars(r)["name"], mux.Vars(r)["uid"]
+	if err := api.lim.ExceedsAny(map[string]goch.Limit{
+		chanName: goch.ChanLimit,
+		uid:      goch.UIDLimit,
+	}); err != nil {
+		http.Error(w, err.Error(), 400)
+		return false
+	}
+
+	ch, err := api.store.Get(chanName)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid token or unexisting channel: %v", err), 500)
+		return false
+	}
+
+	if !ch.IsBot(uid) {
+		http.Error(w, "invalid bot token", 401)
+		return false
+	}
+
+	// Attempts count towards rate limit before token is verified,
+	// so guessing tokens is throttled like posting
+	ok, err := api.store.AllowPost(chanName, uid, api.rate, botRateWindow)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not check rate limit: %v", err), 500)
+		return false
+	}
+	if !ok {
+		w.Header().Set("Retry-After", fmt.Sprint(int(botRateWindow.Seconds())))
+		http.Error(w, fmt.Sprintf("exceeded limit of %d messages per minute", api.rate), 429)
+		return false
+	}
+
+	bot, err := ch.AuthenticateBot(uid, token)
+	if err != nil {
+		http.Error(w, err.Error(), 401)
+		return false
+	}
+
+	if err = ch.Authorize(uid, goch.PostPerm); err != nil {
+		http.Error(w, err.Error(), 403)
+		return false
+	}
+
+	m := &goch.Message{
+		Meta:     req.Meta,
+		Text:     req.Text,
+		FromUID:  bot.UID,
+		FromName: bot.DisplayName,
+		Time:     time.Now().UnixNano(),
+	}
+
+	if err = m.SetTTL(ch.MessageTTL(req.TTL)); err != nil {
+		http.Error(w, err.Error(), 400)
+		return false
+	}
+
+	if err = api.mod.Moderate(chanName, m); err != nil {
+		http.Error(w, fmt.Sprintf("message rejected: %v", err), 400)
+		return false
+	}
+
+	m.Mentions = ch.MentionedBy(uid, m.Text)
+
+	if err = api.mb.Send(chanName, m); err != nil {
+		http.Error(w, fmt.Sprintf("could not send message: %v", err), 500)
+		return false
+	}
+
+	return true
+}
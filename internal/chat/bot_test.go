@@ -0,0 +1,266 @@
+package chat_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ribice/goch"
+	"github.com/ribice/goch/internal/chat"
+)
+
+const botUID = "BOT12345678901234567"
+
+func TestCreateBot(t *testing.T) {
+	s := &botStore{ch: moderatedChan()}
+	m := mux.NewRouter()
+	chat.New(m, &store{}, &events{}, cfg, middleware)
+	chat.NewBotAPI(m, s, &sender{}, &moderator{}, cfg, 1, middleware)
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	req, err := json.Marshal(map[string]string{"uid": botUID, "display_name": "Deploy bot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := http.Post(srv.URL+"/admin/channels/1234567890/bots", "application/json", bytes.NewBuffer(req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected response code. want: %d, got: %d", http.StatusOK, res.StatusCode)
+	}
+
+	var resp struct {
+		UID   string `json:"uid"`
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.UID != botUID || s.saved == nil {
+		t.Fatalf("expected bot to be created, got %+v", resp)
+	}
+	if _, err := s.saved.AuthenticateBot(botUID, resp.Token); err != nil {
+		t.Errorf("expected returned token to authenticate bot: %v", err)
+	}
+
+	r, err := http.NewRequest("DELETE", srv.URL+"/admin/channels/1234567890/bots/"+memberUID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected deleting non-bot member to fail, got %d", res.StatusCode)
+	}
+}
+
+func TestPostBotMessage(t *testing.T) {
+	ch := moderatedChan()
+	token, err := ch.RegisterBot(botUID, "Deploy bot")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		path     string
+		token    string
+		req      string
+		muted    bool
+		limited  bool
+		wantCode int
+		wantText string
+		wantBody string
+		wantMent []string
+		wantTTL  int64
+	}{
+		{
+			name:     "Fail on missing token",
+			path:     "/channels/1234567890/bots/" + botUID + "/messages",
+			req:      `{"text":"hello"}`,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Fail on invalid token",
+			path:     "/channels/1234567890/bots/" + botUID + "/messages",
+			token:    "invalid",
+			req:      `{"text":"hello"}`,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Fail on unknown bot",
+			path:     "/channels/1234567890/bots/" + memberUID + "/messages",
+			token:    token,
+			req:      `{"text":"hello"}`,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Fail on exceeded rate limit before verifying token",
+			path:     "/hooks/1234567890/" + botUID + "/invalid",
+			req:      `{"text":"hello"}`,
+			limited:  true,
+			wantCode: http.StatusTooManyRequests,
+		},
+		{
+			name:     "Fail on empty message",
+			path:     "/channels/1234567890/bots/" + botUID + "/messages",
+			token:    token,
+			req:      `{"text":" "}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Fail on muted bot",
+			path:     "/channels/1234567890/bots/" + botUID + "/messages",
+			token:    token,
+			req:      `{"text":"hello"}`,
+			muted:    true,
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Fail on exceeded rate limit",
+			path:     "/channels/1234567890/bots/" + botUID + "/messages",
+			token:    token,
+			req:      `{"text":"hello"}`,
+			limited:  true,
+			wantCode: http.StatusTooManyRequests,
+		},
+		{
+			name:     "Fail on moderated message",
+			path:     "/channels/1234567890/bots/" + botUID + "/messages",
+			token:    token,
+			req:      `{"text":"spam"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Fail on invalid TTL",
+			path:     "/channels/1234567890/bots/" + botUID + "/messages",
+			token:    token,
+			req:      `{"text":"hello","ttl":-1}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Success",
+			path:     "/channels/1234567890/bots/" + botUID + "/messages",
+			token:    token,
+			req:      `{"text":"deployed, @` + memberUID + `","meta":{"env":"prod"},"ttl":60}`,
+			wantCode: http.StatusOK,
+			wantText: "deployed, @" + memberUID,
+			wantMent: []string{memberUID},
+			wantTTL:  60,
+		},
+		{
+			name:     "Slack-compatible payload",
+			path:     "/hooks/1234567890/" + botUID + "/" + token,
+			req:      `{"text":"Build finished","username":"ci","attachments":[{"title":"Build #12","text":"All tests passed"},{"fallback":"Coverage 80%"}]}`,
+			wantCode: http.StatusOK,
+			wantText: "Build finished\nBuild #12\nAll tests passed\nCoverage 80%",
+			wantBody: "ok",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := *ch
+			if tc.muted {
+				c.Mutes = map[string]*goch.Mute{botUID: {UID: botUID, Until: time.Now().Add(time.Hour).UnixNano()}}
+			}
+			s := &botStore{ch: &c, limited: tc.limited}
+			mb := &sender{}
+			m := mux.NewRouter()
+			chat.New(m, &store{}, &events{}, cfg, middleware)
+			chat.NewBotAPI(m, s, mb, &moderator{}, cfg, 1, middleware)
+			srv := httptest.NewServer(m)
+			defer srv.Close()
+
+			r, err := http.NewRequest("POST", srv.URL+tc.path, strings.NewReader(tc.req))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Header.Set("Content-Type", "application/json")
+			if tc.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+
+			res, err := http.DefaultClient.Do(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tc.wantCode {
+				t.Fatalf("unexpected response code. want: %d, got: %d", tc.wantCode, res.StatusCode)
+			}
+
+			if tc.wantCode != http.StatusOK {
+				if mb.msg != nil {
+					t.Error("expected message not to be sent")
+				}
+				return
+			}
+
+			body, _ := ioutil.ReadAll(res.Body)
+			if string(body) != tc.wantBody {
+				t.Errorf("expected response body %q, got %q", tc.wantBody, body)
+			}
+
+			if mb.chat != "1234567890" || mb.msg == nil {
+				t.Fatal("expected message to be sent to channel")
+			}
+			if mb.msg.Text != tc.wantText || mb.msg.FromUID != botUID || mb.msg.FromName != "Deploy bot" {
+				t.Errorf("unexpected message sent: %+v", mb.msg)
+			}
+			if mb.msg.TTL != tc.wantTTL || (tc.wantTTL != 0 && mb.msg.ExpiresAt != mb.msg.Time+tc.wantTTL*int64(time.Second)) {
+				t.Errorf("expected message to expire after %d seconds, got %+v", tc.wantTTL, mb.msg)
+			}
+			if !reflect.DeepEqual(mb.msg.Mentions, tc.wantMent) {
+				t.Errorf("expected mentions %v, got %v", tc.wantMent, mb.msg.Mentions)
+			}
+		})
+	}
+}
+
+type botStore struct {
+	ch      *goch.Chat
+	saved   *goch.Chat
+	limited bool
+}
+
+func (s *botStore) Get(string) (*goch.Chat, error) { return s.ch, nil }
+
+func (s *botStore) Save(ch *goch.Chat) error {
+	s.saved = ch
+	return nil
+}
+
+func (s *botStore) AllowPost(string, string, int64, time.Duration) (bool, error) {
+	return !s.limited, nil
+}
+
+type sender struct {
+	chat string
+	msg  *goch.Message
+}
+
+func (s *sender) Send(chat string, m *goch.Message) error {
+	s.chat, s.msg = chat, m
+	return nil
+}
+
+type moderator struct{}
+
+func (moderator) Moderate(_ string, m *goch.Message) error {
+	if m.Text == "spam" {
+		return errors.New("looks like spam")
+	}
+	return nil
+}
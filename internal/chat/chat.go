@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/ribice/goch"
@@ -25,9 +26,10 @@ type Limiter interface {
 }
 
 // New creates new websocket api
-func New(m *mux.Router, store Store, l Limiter, authMW mux.MiddlewareFunc) *API {
+func New(m *mux.Router, store Store, eb EventBroker, l Limiter, authMW mux.MiddlewareFunc) *API {
 	api := API{
-		store: store,
+		store:  store,
+		events: eb,
 	}
 
 	exceeds = l.Exceeds
@@ -38,18 +40,55 @@ func New(m *mux.Router, store Store, l Limiter, authMW mux.MiddlewareFunc) *API
 	sr := m.PathPrefix("/channels").Subrouter()
 	sr.HandleFunc("/register", api.register).Methods("POST")
 	sr.HandleFunc("/{name}", api.listMembers).Methods("GET").Queries("secret", "{[a-zA-Z0-9_]*$}")
+	sr.HandleFunc("/{name}/direct/{uid}", api.listDirect).Methods("GET").Queries("secret", "{[a-zA-Z0-9_]*$}")
+	sr.HandleFunc("/{name}/unread/{uid}", api.memberUnreadCount).Methods("GET").Queries("secret", "{[a-zA-Z0-9_]*$}")
+	sr.HandleFunc("/{name}", api.updateChannel).Methods("PATCH")
+	sr.HandleFunc("/{name}/invites", api.createInvite).Methods("POST")
+	sr.HandleFunc("/{name}/invites", api.listInvites).Methods("GET")
+	sr.HandleFunc("/{name}/invites/{token}", api.revokeInvite).Methods("DELETE")
+	sr.HandleFunc("/{name}/receipts", api.listReceipts).Methods("GET")
+	sr.HandleFunc("/{name}/kick", api.kick).Methods("POST")
+	sr.HandleFunc("/{name}/secret", api.rotateSecret).Methods("POST")
+	sr.HandleFunc("/{name}/bans", api.listBans).Methods("GET")
+	sr.HandleFunc("/{name}/ban", api.ban).Methods("POST")
+	sr.HandleFunc("/{name}/unban", api.unban).Methods("POST")
+	sr.HandleFunc("/{name}/mute", api.mute).Methods("POST")
+	sr.HandleFunc("/{name}/unmute", api.unmute).Methods("POST")
+	sr.HandleFunc("/{name}/role", api.changeRole).Methods("POST")
+
+	acr := m.PathPrefix("/accounts").Subrouter()
+	acr.HandleFunc("", api.createAccount).Methods("POST")
+	acr.HandleFunc("/{uid}", api.getAccount).Methods("GET").Queries("secret", "{[a-zA-Z0-9_]*$}")
+	acr.HandleFunc("/{uid}", api.updateAccount).Methods("PATCH")
+	acr.HandleFunc("/{uid}/channels", api.joinChannel).Methods("POST")
 
 	ar := m.PathPrefix("/admin/channels").Subrouter()
 	ar.Use(authMW)
 	ar.HandleFunc("", api.listChannels).Methods("GET")
 	ar.HandleFunc("", api.createChannel).Methods("POST")
+	ar.HandleFunc("/{chanName}", api.adminUpdateChannel).Methods("PATCH")
+	ar.HandleFunc("/{chanName}/secret", api.rotateChannelSecret).Methods("POST")
 	ar.HandleFunc("/{chanName}/user/{uid}", api.unreadCount).Methods("GET")
+	ar.HandleFunc("/{chanName}/user/{uid}/role", api.setRole).Methods("PUT")
+	ar.HandleFunc("/{chanName}/invites", api.adminCreateInvite).Methods("POST")
+	ar.HandleFunc("/{chanName}/invites", api.adminListInvites).Methods("GET")
+	ar.HandleFunc("/{chanName}/invites/{token}", api.adminRevokeInvite).Methods("DELETE")
+	ar.HandleFunc("/{chanName}/webhooks", api.createWebhook).Methods("POST")
+	ar.HandleFunc("/{chanName}/webhooks", api.listWebhooks).Methods("GET")
+	ar.HandleFunc("/{chanName}/webhooks/deadletters", api.listDeadLetters).Methods("GET")
+	ar.HandleFunc("/{chanName}/webhooks/{id}", api.deleteWebhook).Methods("DELETE")
 	return &api
 }
 
 // API represents websocket api service
 type API struct {
-	store Store
+	store  Store
+	events EventBroker
+}
+
+// EventBroker represents ephemeral chat event broker interface
+type EventBroker interface {
+	SendEvent(string, *goch.Event) error
 }
 
 // Store represents chat store interface
@@ -57,27 +96,63 @@ type Store interface {
 	Save(*goch.Chat) error
 	Get(string) (*goch.Chat, error)
 	ListChannels() ([]string, error)
+	ListDirect(string) ([]string, error)
 	GetUnreadCount(string, string) uint64
+	GetMentionCount(string, string) uint64
+	CreateAccount(*goch.Account) error
+	SaveAccount(*goch.Account) error
+	GetAccount(string) (*goch.Account, error)
+	AddAccountChannel(string, string) error
+	RemoveAccountChannel(string, string) error
+	SaveInvite(*goch.Invite) error
+	GetInvite(string, string) (*goch.Invite, error)
+	ListInvites(string) ([]*goch.Invite, error)
+	UseInvite(string, string) (*goch.Invite, error)
+	ReleaseInvite(string, string) error
+	RevokeInvite(string, string) error
+	Presence(string, []string) (map[string]goch.Status, error)
+	ReadReceipts(string, []string) (map[string]uint64, error)
+	SaveWebhook(*goch.Webhook) error
+	ListWebhooks(string) ([]*goch.Webhook, error)
+	DeleteWebhook(string, string) error
+	ListDeadLetters(string) ([]*goch.DeadLetter, error)
 }
 
 type createReq struct {
-	Name      string `json:"name"`
-	IsPrivate bool   `json:"is_private"`
+	Name        string `json:"name"`
+	IsPrivate   bool   `json:"is_private"`
+	Topic       string `json:"topic"`
+	Description string `json:"description"`
 }
 
 func (cr *createReq) Bind() error {
 	if !alfaRgx.MatchString(cr.Name) {
 		return errors.New("name must contain only alphanumeric and underscores")
 	}
+	if err := bindMeta(&cr.Topic, &cr.Description); err != nil {
+		return err
+	}
 	return exceeds(cr.Name, goch.ChanLimit)
 }
 
+func bindMeta(topic, description *string) error {
+	if topic != nil && len(*topic) > goch.MaxTopicLength {
+		return fmt.Errorf("topic must be at most %d characters long", goch.MaxTopicLength)
+	}
+	if description != nil && len(*description) > goch.MaxDescriptionLength {
+		return fmt.Errorf("description must be at most %d characters long", goch.MaxDescriptionLength)
+	}
+	return nil
+}
+
 func (api *API) createChannel(w http.ResponseWriter, r *http.Request) {
 	var req createReq
 	if err := render.Bind(w, r, &req); err != nil {
 		return
 	}
 	ch := goch.NewChannel(req.Name, req.IsPrivate)
+	ch.Topic, ch.Description = req.Topic, req.Description
+	ch.CreatedBy = adminName(r)
 	if err := api.store.Save(ch); err != nil {
 		http.Error(w, fmt.Sprintf("could not create channel: %v", err), 500)
 		return
@@ -86,12 +161,11 @@ func (api *API) createChannel(w http.ResponseWriter, r *http.Request) {
 }
 
 type registerReq struct {
-	UID           string `json:"uid"`
-	DisplayName   string `json:"display_name"`
-	Email         string `json:"email"`
-	Secret        string `json:"secret"`
-	Channel       string `json:"channel"`
-	ChannelSecret string `json:"channel_secret"`
+	UID         string `json:"uid"`
+	DisplayName string `json:"display_name"`
+	Email       string `json:"email"`
+	Secret      string `json:"secret"`
+	accessReq
 }
 
 type registerResp struct {
@@ -108,12 +182,13 @@ func (r *registerReq) Bind() error {
 	if !mailRgx.MatchString(r.Email) {
 		return errors.New("invalid email address")
 	}
+	if err := r.accessReq.Bind(); err != nil {
+		return err
+	}
 	return exceedsAny(map[string]goch.Limit{
-		r.UID:           goch.UIDLimit,
-		r.DisplayName:   goch.DisplayNameLimit,
-		r.ChannelSecret: goch.ChanSecretLimit,
-		r.Secret:        goch.SecretLimit,
-		r.Channel:       goch.ChanLimit,
+		r.UID:         goch.UIDLimit,
+		r.DisplayName: goch.DisplayNameLimit,
+		r.Secret:      goch.SecretLimit,
 	})
 }
 
@@ -122,9 +197,15 @@ func (api *API) register(w http.ResponseWriter, r *http.Request) {
 	if err := render.Bind(w, r, &req); err != nil {
 		return
 	}
-	ch, err := api.store.Get(req.Channel)
-	if err != nil || ch.Secret != req.ChannelSecret {
-		http.Error(w, fmt.Sprintf("invalid secret or unexisting channel: %v", err), 500)
+
+	ch, err := api.enter(w, req.accessReq)
+	if err != nil {
+		return
+	}
+
+	// Registering would shadow account's profile and secret in this channel
+	if _, err = api.store.GetAccount(req.UID); err == nil {
+		http.Error(w, fmt.Sprintf("uid belongs to an account, join with POST /accounts/%s/channels instead", req.UID), 409)
 		return
 	}
 
@@ -140,8 +221,13 @@ func (api *API) register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err = api.useInvite(w, req.accessReq); err != nil {
+		return
+	}
+
 	if err = api.store.Save(ch); err != nil {
 		ch.Leave(req.UID)
+		api.releaseInvite(req.accessReq)
 		http.Error(w, fmt.Sprintf("could not update channel membership: %v", err), 500)
 		return
 	}
@@ -150,8 +236,85 @@ func (api *API) register(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// accessReq holds credentials required for entering a channel
+type accessReq struct {
+	Channel       string `json:"channel"`
+	ChannelSecret string `json:"channel_secret"`
+	Invite        string `json:"invite"` // Used instead of ChannelSecret
+}
+
+func (r *accessReq) Bind() error {
+	if !alfaRgx.MatchString(r.Invite) {
+		return errors.New("invite must contain only alphanumeric and underscores")
+	}
+	lims := map[string]goch.Limit{
+		r.Channel: goch.ChanLimit,
+	}
+	if r.Invite != "" {
+		lims[r.Invite] = goch.ChanSecretLimit
+	} else {
+		lims[r.ChannelSecret] = goch.ChanSecretLimit
+	}
+	return exceedsAny(lims)
+}
+
+// enter fetches channel and checks whether provided channel secret or invite are valid.
+// On failure, an error is written to w.
+func (api *API) enter(w http.ResponseWriter, req accessReq) (*goch.Chat, error) {
+	ch, err := api.store.Get(req.Channel)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid secret or unexisting channel: %v", err), 500)
+		return nil, err
+	}
+
+	if req.Invite == "" {
+		if err = ch.VerifyChannelSecret(req.ChannelSecret); err == goch.ErrInviteOnly {
+			http.Error(w, err.Error(), 403)
+			return nil, err
+		} else if err != nil {
+			http.Error(w, fmt.Sprintf("invalid secret or unexisting channel: %v", err), 500)
+			return nil, err
+		}
+	}
+
+	if req.Invite != "" {
+		inv, err := api.store.GetInvite(req.Channel, req.Invite)
+		if err == nil {
+			err = inv.Valid(time.Now())
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid invite: %v", err), 500)
+			return nil, err
+		}
+	}
+
+	return ch, nil
+}
+
+// useInvite records use of invite the channel was entered with, if any.
+// On failure, an error is written to w.
+func (api *API) useInvite(w http.ResponseWriter, req accessReq) error {
+	if req.Invite == "" {
+		return nil
+	}
+	if _, err := api.store.UseInvite(req.Channel, req.Invite); err != nil {
+		http.Error(w, fmt.Sprintf("invalid invite: %v", err), 500)
+		return err
+	}
+	return nil
+}
+
+// releaseInvite reverts use of invite the channel was entered with,
+// if any, after joining the channel failed
+func (api *API) releaseInvite(req accessReq) {
+	if req.Invite != "" {
+		api.store.ReleaseInvite(req.Channel, req.Invite)
+	}
+}
+
 type unreadCountResp struct {
-	Count uint64 `json:"count"`
+	Count    uint64 `json:"count"`
+	Mentions uint64 `json:"mentions"`
 }
 
 func (api *API) unreadCount(w http.ResponseWriter, r *http.Request) {
@@ -165,11 +328,37 @@ func (api *API) unreadCount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	uc := api.store.GetUnreadCount(uid, chanName)
-	render.JSON(w, &unreadCountResp{uc})
+	render.JSON(w, &unreadCountResp{
+		Count:    api.store.GetUnreadCount(uid, chanName),
+		Mentions: api.store.GetMentionCount(uid, chanName),
+	})
 
 }
 
+func (api *API) memberUnreadCount(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chanName, uid := vars["name"], vars["uid"]
+	secret := r.URL.Query().Get("secret")
+
+	if err := exceedsAny(map[string]goch.Limit{
+		chanName: goch.ChanLimit,
+		uid:      goch.UIDLimit,
+		secret:   goch.SecretLimit,
+	}); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	if _, err := api.authorize(w, chanName, memberReq{UID: uid, Secret: secret}, goch.ReadPerm); err != nil {
+		return
+	}
+
+	render.JSON(w, &unreadCountResp{
+		Count:    api.store.GetUnreadCount(uid, chanName),
+		Mentions: api.store.GetMentionCount(uid, chanName),
+	})
+}
+
 func (api *API) listMembers(w http.ResponseWriter, r *http.Request) {
 
 	chanName := mux.Vars(r)["name"]
@@ -189,12 +378,71 @@ func (api *API) listMembers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if ch.Secret != secret {
+	if err = ch.VerifyChannelSecret(secret); err == goch.ErrInviteOnly {
+		http.Error(w, err.Error(), 403)
+		return
+	} else if err != nil {
 		http.Error(w, "invalid secret", 500)
 		return
 	}
 
-	render.JSON(w, ch.ListMembers())
+	members := ch.ListMembers()
+	api.profiles(members)
+
+	uids := make([]string, len(members))
+	for i, m := range members {
+		uids[i] = m.UID
+	}
+
+	ps, err := api.store.Presence(ch.Name, uids)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to fetch presence: %v", err), 500)
+		return
+	}
+
+	resp := make([]memberResp, len(members))
+	for i, m := range members {
+		resp[i] = memberResp{User: m, Status: ps[m.UID]}
+	}
+
+	render.JSON(w, resp)
+}
+
+type memberResp struct {
+	*goch.User
+	Status goch.Status `json:"status"`
+}
+
+type channelResp struct {
+	Name         string `json:"name"`
+	Topic        string `json:"topic"`
+	Description  string `json:"description"`
+	CreatedAt    int64  `json:"created_at"`
+	CreatedBy    string `json:"created_by"`
+	LastActivity int64  `json:"last_activity"`
+	Archived     bool   `json:"archived"`
+	Members      int    `json:"members"`
+
+	DisableReceipts bool  `json:"disable_receipts"`
+	DefaultTTL      int64 `json:"default_ttl"`
+	InviteOnly      bool  `json:"invite_only"`
+}
+
+func newChannelResp(ch *goch.Chat) channelResp {
+	return channelResp{
+		Name:         ch.Name,
+		Topic:        ch.Topic,
+		Description:  ch.Description,
+		CreatedAt:    ch.CreatedAt,
+		CreatedBy:    ch.CreatedBy,
+		LastActivity: ch.LastActivity,
+		Archived:     ch.Archived,
+		Members:      len(ch.Members),
+
+		DisableReceipts: ch.DisableReceipts,
+		DefaultTTL:      ch.DefaultTTL,
+		InviteOnly:      ch.InviteOnly,
+	}
 }
 
 func (api *API) listChannels(w http.ResponseWriter, r *http.Request) {
@@ -203,6 +451,227 @@ func (api *API) listChannels(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("unable to fetch channels: %v", err), 500)
 		return
 	}
-	render.JSON(w, chans)
 
+	resp := []channelResp{}
+	for _, name := range chans {
+		ch, err := api.store.Get(name)
+		if err != nil {
+			continue
+		}
+		resp = append(resp, newChannelResp(ch))
+	}
+
+	render.JSON(w, resp)
+
+}
+
+type updateChannelReq struct {
+	Topic       *string `json:"topic"`
+	Description *string `json:"description"`
+	Archived    *bool   `json:"archived"`
+
+	DisableReceipts *bool  `json:"disable_receipts"`
+	DefaultTTL      *int64 `json:"default_ttl"` // Seconds, zero disables expiry
+}
+
+func (r *updateChannelReq) Bind() error {
+	if r.DefaultTTL != nil && (*r.DefaultTTL < 0 || *r.DefaultTTL > int64(goch.MaxTTL/time.Second)) {
+		return fmt.Errorf("default_ttl must be between 0 and %d seconds", int64(goch.MaxTTL/time.Second))
+	}
+	return bindMeta(r.Topic, r.Description)
+}
+
+// apply applies requested changes to channel metadata
+func (r *updateChannelReq) apply(ch *goch.Chat) {
+	if r.Topic != nil {
+		ch.Topic = *r.Topic
+	}
+	if r.Description != nil {
+		ch.Description = *r.Description
+	}
+	if r.Archived != nil {
+		ch.Archived = *r.Archived
+	}
+	if r.DisableReceipts != nil {
+		ch.DisableReceipts = *r.DisableReceipts
+	}
+	if r.DefaultTTL != nil {
+		ch.DefaultTTL = *r.DefaultTTL
+	}
+}
+
+type adminUpdateChannelReq struct {
+	updateChannelReq
+	InviteOnly *bool `json:"invite_only"` // Rejects channel secret, so channel can only be entered with an invite
+}
+
+func (api *API) adminUpdateChannel(w http.ResponseWriter, r *http.Request) {
+	chanName := mux.Vars(r)["chanName"]
+	if err := exceeds(chanName, goch.ChanLimit); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	var req adminUpdateChannelReq
+	if err := render.Bind(w, r, &req); err != nil {
+		return
+	}
+
+	ch, err := api.store.Get(chanName)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unexisting channel: %v", err), 500)
+		return
+	}
+
+	if req.InviteOnly != nil {
+		ch.InviteOnly = *req.InviteOnly
+	}
+
+	api.saveChannel(w, ch, &req.updateChannelReq)
+}
+
+// rotateChannelSecret replaces channel's secret, so a leaked
+// one can no longer be used to enter the channel
+func (api *API) rotateChannelSecret(w http.ResponseWriter, r *http.Request) {
+	chanName := mux.Vars(r)["chanName"]
+	if err := exceeds(chanName, goch.ChanLimit); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	ch, err := api.store.Get(chanName)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unexisting channel: %v", err), 500)
+		return
+	}
+
+	secret, err := ch.RotateChannelSecret()
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	if err = api.store.Save(ch); err == goch.ErrChatConflict {
+		http.Error(w, err.Error(), 409)
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("could not rotate channel secret: %v", err), 500)
+		return
+	}
+
+	render.JSON(w, secret)
+}
+
+type memberUpdateChannelReq struct {
+	memberReq
+	updateChannelReq
+}
+
+func (r *memberUpdateChannelReq) Bind() error {
+	if err := r.memberReq.Bind(); err != nil {
+		return err
+	}
+	return r.updateChannelReq.Bind()
+}
+
+func (api *API) updateChannel(w http.ResponseWriter, r *http.Request) {
+	var req memberUpdateChannelReq
+	if err := render.Bind(w, r, &req); err != nil {
+		return
+	}
+
+	perm := goch.TopicPerm
+	if req.Archived != nil {
+		perm = goch.ArchivePerm
+	}
+
+	ch, err := api.authorize(w, mux.Vars(r)["name"], req.memberReq, perm)
+	if err != nil {
+		return
+	}
+
+	if req.Archived != nil && (req.Topic != nil || req.Description != nil || req.DisableReceipts != nil || req.DefaultTTL != nil) {
+		if err = ch.Authorize(req.UID, goch.TopicPerm); err != nil {
+			http.Error(w, err.Error(), 403)
+			return
+		}
+	}
+
+	api.saveChannel(w, ch, &req.updateChannelReq)
+}
+
+func (api *API) saveChannel(w http.ResponseWriter, ch *goch.Chat, req *updateChannelReq) {
+	req.apply(ch)
+
+	if err := api.store.Save(ch); err == goch.ErrChatConflict {
+		http.Error(w, err.Error(), 409)
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("could not update channel: %v", err), 500)
+		return
+	}
+
+	// Connected members reload settings such as DisableReceipts
+	api.notifyUpdate(ch.Name)
+
+	render.JSON(w, newChannelResp(ch))
+}
+
+// adminName returns name of the admin making the request
+func adminName(r *http.Request) string {
+	if user, _, ok := r.BasicAuth(); ok {
+		return user
+	}
+	return "admin"
+}
+
+type directResp struct {
+	Chat        string `json:"chat"`
+	UID         string `json:"uid"`
+	DisplayName string `json:"display_name"`
+}
+
+func (api *API) listDirect(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chanName, uid := vars["name"], vars["uid"]
+	secret := r.URL.Query().Get("secret")
+
+	if err := exceedsAny(map[string]goch.Limit{
+		chanName: goch.ChanLimit,
+		uid:      goch.UIDLimit,
+		secret:   goch.SecretLimit,
+	}); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	ch, err := api.store.Get(chanName)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid secret or unexisting channel: %v", err), 500)
+		return
+	}
+
+	if err = api.join(w, ch, uid, secret); err != nil {
+		return
+	}
+
+	ids, err := api.store.ListDirect(uid)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to fetch private chats: %v", err), 500)
+		return
+	}
+
+	resp := []directResp{}
+	for _, id := range ids {
+		dm, err := api.store.Get(id)
+		if err != nil {
+			continue
+		}
+		if p := dm.Peer(uid); p != nil {
+			api.profiles([]*goch.User{p})
+			resp = append(resp, directResp{Chat: dm.Name, UID: p.UID, DisplayName: p.DisplayName})
+		}
+	}
+
+	render.JSON(w, resp)
 }
@@ -104,7 +104,7 @@ func TestCreateChannel(t *testing.T) {
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			m := mux.NewRouter()
-			chat.New(m, tc.store, cfg, middleware)
+			chat.New(m, tc.store, &events{}, cfg, middleware)
 			srv := httptest.NewServer(m)
 			defer srv.Close()
 			path := srv.URL + "/admin/channels"
@@ -143,6 +143,7 @@ type registerReq struct {
 	Secret        string `json:"secret"`
 	Channel       string `json:"channel"`
 	ChannelSecret string `json:"channel_secret"`
+	Invite        string `json:"invite"`
 }
 
 type registerResp struct {
@@ -208,6 +209,18 @@ func TestRegister(t *testing.T) {
 			req:      registerReq{UID: "EmirABCDEF1234567890", Channel: "foo1234567", Email: "ribice@gmail.com", ChannelSecret: "ABCDEFGHIJDKLOMNSOPR", DisplayName: "Emir", Secret: "12345678901234567890ABC"},
 			wantCode: http.StatusInternalServerError,
 		},
+		{
+			store: &store{
+				GetFunc: func(id string) (*goch.Chat, error) {
+					return &goch.Chat{Secret: "ABCDEFGHIJDKLOMNSOPR", InviteOnly: true, Members: map[string]*goch.User{}}, nil
+				},
+				SaveFunc: func(ch *goch.Chat) error { return nil },
+			},
+			name:       "channel secret on invite-only channel",
+			req:        registerReq{UID: "EmirABCDEF1234567890", Channel: "foo1234567", Email: "ribice@gmail.com", ChannelSecret: "ABCDEFGHIJDKLOMNSOPR", DisplayName: "Emir", Secret: "12345678901234567890ABC"},
+			wantCode:   http.StatusForbidden,
+			wantErrMsg: "chat: channel can only be entered with an invite",
+		},
 		{
 			store: &store{
 				GetFunc: func(id string) (*goch.Chat, error) {
@@ -250,6 +263,21 @@ func TestRegister(t *testing.T) {
 			req:      registerReq{UID: "EmirABCDEF1234567890", Channel: "foo1234567", Email: "ribice@gmail.com", ChannelSecret: "ABCDEFGHIJDKLOMNSOPR", DisplayName: "Emir", Secret: "12345678901234567890ABC"},
 			wantCode: http.StatusOK,
 		},
+		{
+			store: &store{
+				GetFunc: func(id string) (*goch.Chat, error) {
+					return &goch.Chat{Secret: "ABCDEFGHIJDKLOMNSOPR", Members: map[string]*goch.User{}}, nil
+				},
+				GetAccountFunc: func(uid string) (*goch.Account, error) {
+					return &goch.Account{UID: uid}, nil
+				},
+				SaveFunc: func(ch *goch.Chat) error { return nil },
+			},
+			name:       "uid belongs to an account",
+			req:        registerReq{UID: "EmirABCDEF1234567890", Channel: "foo1234567", Email: "ribice@gmail.com", ChannelSecret: "ABCDEFGHIJDKLOMNSOPR", DisplayName: "Emir", Secret: "12345678901234567890ABC"},
+			wantCode:   http.StatusConflict,
+			wantErrMsg: "uid belongs to an account, join with POST /accounts/EmirABCDEF1234567890/channels instead",
+		},
 	}
 
 	type registerResp struct {
@@ -259,7 +287,7 @@ func TestRegister(t *testing.T) {
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			m := mux.NewRouter()
-			chat.New(m, tc.store, cfg, middleware)
+			chat.New(m, tc.store, &events{}, cfg, middleware)
 			srv := httptest.NewServer(m)
 			defer srv.Close()
 			path := srv.URL + "/channels/register"
@@ -304,7 +332,8 @@ func TestRegister(t *testing.T) {
 }
 
 type unreadCountResp struct {
-	Count uint64 `json:"count"`
+	Count    uint64 `json:"count"`
+	Mentions uint64 `json:"mentions"`
 }
 
 func TestUnreadCount(t *testing.T) {
@@ -314,7 +343,7 @@ func TestUnreadCount(t *testing.T) {
 		chanName string
 		uid      string
 		wantCode int
-		wantResp uint64
+		wantResp unreadCountResp
 	}{{
 		name:     "fail on limits",
 		chanName: "channel",
@@ -326,16 +355,17 @@ func TestUnreadCount(t *testing.T) {
 			chanName: "12345678901",
 			uid:      "1234567890ABCDEFGHIJ",
 			store: &store{
-				GetUnreadCountFunc: func(string, string) uint64 { return 12 },
+				GetUnreadCountFunc:  func(string, string) uint64 { return 12 },
+				GetMentionCountFunc: func(string, string) uint64 { return 2 },
 			},
 			wantCode: 200,
-			wantResp: 12,
+			wantResp: unreadCountResp{Count: 12, Mentions: 2},
 		},
 	}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			m := mux.NewRouter()
-			chat.New(m, tc.store, cfg, middleware)
+			chat.New(m, tc.store, &events{}, cfg, middleware)
 			srv := httptest.NewServer(m)
 			defer srv.Close()
 			path := srv.URL + "/admin/channels/" + tc.chanName + "/user/" + tc.uid
@@ -360,8 +390,69 @@ func TestUnreadCount(t *testing.T) {
 					t.Error(err)
 				}
 
-				if uc.Count != tc.wantResp {
-					t.Errorf("expected count: %v but got: %v", tc.wantResp, uc.Count)
+				if uc != tc.wantResp {
+					t.Errorf("expected count: %v but got: %v", tc.wantResp, uc)
+				}
+			}
+		})
+	}
+}
+
+func TestMemberUnreadCount(t *testing.T) {
+	cases := []struct {
+		name     string
+		store    *store
+		path     string
+		wantCode int
+		wantResp unreadCountResp
+	}{
+		{
+			name:     "Fail on limits",
+			path:     "/channels/channel/unread/uid?secret=123",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "Invalid secret",
+			store: &store{
+				GetFunc: func(string) (*goch.Chat, error) { return moderatedChan(), nil },
+			},
+			path:     "/channels/1234567890/unread/" + memberUID + "?secret=00000000000000000000",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name: "Success",
+			store: &store{
+				GetFunc:             func(string) (*goch.Chat, error) { return moderatedChan(), nil },
+				GetUnreadCountFunc:  func(string, string) uint64 { return 7 },
+				GetMentionCountFunc: func(string, string) uint64 { return 1 },
+			},
+			path:     "/channels/1234567890/unread/" + memberUID + "?secret=" + memSecret,
+			wantCode: http.StatusOK,
+			wantResp: unreadCountResp{Count: 7, Mentions: 1},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := mux.NewRouter()
+			chat.New(m, tc.store, &events{}, cfg, middleware)
+			srv := httptest.NewServer(m)
+			defer srv.Close()
+			res, err := http.Get(srv.URL + tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.StatusCode != tc.wantCode {
+				t.Errorf("unexpected response code. want: %d, got: %d", tc.wantCode, res.StatusCode)
+			}
+
+			if res.StatusCode == 200 {
+				var uc unreadCountResp
+				if err := json.NewDecoder(res.Body).Decode(&uc); err != nil {
+					t.Error(err)
+				}
+				if uc != tc.wantResp {
+					t.Errorf("expected count: %v but got: %v", tc.wantResp, uc)
 				}
 			}
 		})
@@ -427,7 +518,7 @@ func TestListMembers(t *testing.T) {
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			m := mux.NewRouter()
-			chat.New(m, tc.store, cfg, middleware)
+			chat.New(m, tc.store, &events{}, cfg, middleware)
 			srv := httptest.NewServer(m)
 			defer srv.Close()
 			path := srv.URL + "/channels/" + tc.chanName + tc.secret
@@ -460,12 +551,51 @@ func TestListMembers(t *testing.T) {
 	}
 }
 
+func TestListMembersPresence(t *testing.T) {
+	s := &store{
+		GetFunc: func(string) (*goch.Chat, error) {
+			return &goch.Chat{
+				Name: "1234567890", Secret: "12345678901234567890", Members: map[string]*goch.User{
+					"joe": {UID: "joe"},
+				},
+			}, nil
+		},
+		PresenceFunc: func(chanName string, uids []string) (map[string]goch.Status, error) {
+			if chanName != "1234567890" || len(uids) != 1 || uids[0] != "joe" {
+				t.Errorf("unexpected presence request for %s: %v", chanName, uids)
+			}
+			return map[string]goch.Status{"joe": goch.AwayStatus}, nil
+		},
+	}
+	m := mux.NewRouter()
+	chat.New(m, s, &events{}, cfg, middleware)
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/channels/1234567890?secret=12345678901234567890")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var members []struct {
+		UID    string      `json:"uid"`
+		Status goch.Status `json:"status"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&members); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(members) != 1 || members[0].UID != "joe" || members[0].Status != goch.AwayStatus {
+		t.Errorf("unexpected members: %+v", members)
+	}
+}
+
 func TestListChannels(t *testing.T) {
 	cases := []struct {
 		name     string
 		store    *store
 		wantCode int
-		want     []string
+		want     []channelResp
 	}{
 		{
 			store: &store{
@@ -479,18 +609,34 @@ func TestListChannels(t *testing.T) {
 		{
 			store: &store{
 				ListChansFunc: func() ([]string, error) {
-					return []string{"chan1", "chan2"}, nil
+					return []string{"chan1", "chan2", "chan3"}, nil
+				},
+				GetFunc: func(name string) (*goch.Chat, error) {
+					if name == "chan3" {
+						return nil, errors.New("err fetching chan")
+					}
+					return &goch.Chat{
+						Name:      name,
+						Topic:     "topic of " + name,
+						CreatedAt: 1,
+						CreatedBy: "admin",
+						Archived:  name == "chan2",
+						Members:   map[string]*goch.User{"joe": {UID: "joe"}},
+					}, nil
 				},
 			},
 			name:     "success",
 			wantCode: http.StatusOK,
-			want:     []string{"chan1", "chan2"},
+			want: []channelResp{
+				{Name: "chan1", Topic: "topic of chan1", CreatedAt: 1, CreatedBy: "admin", Members: 1},
+				{Name: "chan2", Topic: "topic of chan2", CreatedAt: 1, CreatedBy: "admin", Archived: true, Members: 1},
+			},
 		},
 	}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			m := mux.NewRouter()
-			chat.New(m, tc.store, cfg, middleware)
+			chat.New(m, tc.store, &events{}, cfg, middleware)
 			srv := httptest.NewServer(m)
 			defer srv.Close()
 			path := srv.URL + "/admin/channels"
@@ -509,7 +655,7 @@ func TestListChannels(t *testing.T) {
 					t.Error(err)
 				}
 
-				var chans []string
+				var chans []channelResp
 
 				if err := json.Unmarshal(bts, &chans); err != nil {
 					t.Error(err)
@@ -524,16 +670,304 @@ func TestListChannels(t *testing.T) {
 	}
 }
 
+type channelResp struct {
+	Name         string `json:"name"`
+	Topic        string `json:"topic"`
+	Description  string `json:"description"`
+	CreatedAt    int64  `json:"created_at"`
+	CreatedBy    string `json:"created_by"`
+	LastActivity int64  `json:"last_activity"`
+	Archived     bool   `json:"archived"`
+	Members      int    `json:"members"`
+}
+
+func TestUpdateChannel(t *testing.T) {
+	cases := []struct {
+		name      string
+		path      string
+		req       map[string]interface{}
+		archived  bool
+		wantCode  int
+		wantTopic string
+		wantArch  bool
+		wantTTL   int64
+		wantInv   bool
+	}{
+		{
+			name:     "Topic too long",
+			path:     "/admin/channels/1234567890",
+			req:      map[string]interface{}{"topic": strings.Repeat("a", 257)},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:      "Admin archives channel",
+			path:      "/admin/channels/1234567890",
+			req:       map[string]interface{}{"topic": "new topic", "archived": true},
+			wantCode:  http.StatusOK,
+			wantTopic: "new topic",
+			wantArch:  true,
+		},
+		{
+			name:     "Member cannot change topic",
+			path:     "/channels/1234567890",
+			req:      map[string]interface{}{"uid": memberUID, "secret": memSecret, "topic": "new topic"},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:      "Moderator changes topic",
+			path:      "/channels/1234567890",
+			req:       map[string]interface{}{"uid": modUID, "secret": memSecret, "topic": "new topic"},
+			wantCode:  http.StatusOK,
+			wantTopic: "new topic",
+		},
+		{
+			name:     "Moderator cannot archive",
+			path:     "/channels/1234567890",
+			req:      map[string]interface{}{"uid": modUID, "secret": memSecret, "archived": true},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Moderator cannot change topic of archived channel",
+			path:     "/channels/1234567890",
+			req:      map[string]interface{}{"uid": modUID, "secret": memSecret, "topic": "new topic"},
+			archived: true,
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Default TTL out of range",
+			path:     "/admin/channels/1234567890",
+			req:      map[string]interface{}{"default_ttl": 31 * 24 * 60 * 60},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Moderator sets default TTL",
+			path:     "/channels/1234567890",
+			req:      map[string]interface{}{"uid": modUID, "secret": memSecret, "default_ttl": 3600},
+			wantCode: http.StatusOK,
+			wantTTL:  3600,
+		},
+		{
+			name:     "Admin makes channel invite-only",
+			path:     "/admin/channels/1234567890",
+			req:      map[string]interface{}{"invite_only": true},
+			wantCode: http.StatusOK,
+			wantInv:  true,
+		},
+		{
+			name:     "Owner cannot make channel invite-only",
+			path:     "/channels/1234567890",
+			req:      map[string]interface{}{"uid": ownerUID, "secret": memSecret, "invite_only": true},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Owner unarchives channel",
+			path:     "/channels/1234567890",
+			req:      map[string]interface{}{"uid": ownerUID, "secret": memSecret, "archived": false},
+			archived: true,
+			wantCode: http.StatusOK,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var saved *goch.Chat
+			s := &store{
+				GetFunc: func(string) (*goch.Chat, error) {
+					ch := moderatedChan()
+					ch.Archived = tc.archived
+					return ch, nil
+				},
+				SaveFunc: func(c *goch.Chat) error { saved = c; return nil },
+			}
+			m := mux.NewRouter()
+			ev := &events{}
+			chat.New(m, s, ev, cfg, middleware)
+			srv := httptest.NewServer(m)
+			defer srv.Close()
+
+			req, err := json.Marshal(tc.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := http.NewRequest("PATCH", srv.URL+tc.path, bytes.NewBuffer(req))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := http.DefaultClient.Do(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.StatusCode != tc.wantCode {
+				t.Errorf("unexpected response code. want: %d, got: %d", tc.wantCode, res.StatusCode)
+			}
+
+			if tc.wantCode == http.StatusOK {
+				if saved.Topic != tc.wantTopic || saved.Archived != tc.wantArch || saved.DefaultTTL != tc.wantTTL || saved.InviteOnly != tc.wantInv {
+					t.Errorf("unexpected channel metadata. topic: %s, archived: %v, default ttl: %d, invite only: %v", saved.Topic, saved.Archived, saved.DefaultTTL, saved.InviteOnly)
+				}
+				if len(ev.sent) != 1 || ev.sent[0].Type != goch.ChatUpdateEvent {
+					t.Errorf("expected chat update event to be sent, got %v", ev.sent)
+				}
+			}
+		})
+	}
+}
+
+func TestRotateChannelSecret(t *testing.T) {
+	cases := []struct {
+		name     string
+		ch       *goch.Chat
+		saveErr  error
+		wantCode int
+	}{
+		{
+			name:     "Public channel has no secret",
+			ch:       &goch.Chat{Name: "1234567890"},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Conflicting save",
+			ch:       &goch.Chat{Name: "1234567890", Secret: "ABCDEFGHIJDKLOMNSOPR"},
+			saveErr:  goch.ErrChatConflict,
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "Success",
+			ch:       &goch.Chat{Name: "1234567890", Secret: "ABCDEFGHIJDKLOMNSOPR"},
+			wantCode: http.StatusOK,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var saved *goch.Chat
+			s := &store{
+				GetFunc:  func(string) (*goch.Chat, error) { return tc.ch, nil },
+				SaveFunc: func(c *goch.Chat) error { saved = c; return tc.saveErr },
+			}
+			m := mux.NewRouter()
+			chat.New(m, s, &events{}, cfg, middleware)
+			srv := httptest.NewServer(m)
+			defer srv.Close()
+
+			res, err := http.Post(srv.URL+"/admin/channels/1234567890/secret", "application/json", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.StatusCode != tc.wantCode {
+				t.Errorf("unexpected response code. want: %d, got: %d", tc.wantCode, res.StatusCode)
+			}
+
+			if tc.wantCode != http.StatusOK {
+				return
+			}
+
+			var secret string
+			if err := json.NewDecoder(res.Body).Decode(&secret); err != nil {
+				t.Fatal(err)
+			}
+			if secret == "ABCDEFGHIJDKLOMNSOPR" || secret != saved.Secret {
+				t.Errorf("expected channel secret to be replaced with returned one, returned %s, saved %s", secret, saved.Secret)
+			}
+		})
+	}
+}
+
+type events struct {
+	sent []*goch.Event
+}
+
+func (e *events) SendEvent(id string, ev *goch.Event) error {
+	e.sent = append(e.sent, ev)
+	return nil
+}
+
 type store struct {
-	SaveFunc           func(*goch.Chat) error
-	GetFunc            func(string) (*goch.Chat, error)
-	ListChansFunc      func() ([]string, error)
-	GetUnreadCountFunc func(string, string) uint64
+	SaveFunc            func(*goch.Chat) error
+	GetFunc             func(string) (*goch.Chat, error)
+	ListChansFunc       func() ([]string, error)
+	ListDirectFunc      func(string) ([]string, error)
+	GetUnreadCountFunc  func(string, string) uint64
+	GetMentionCountFunc func(string, string) uint64
+	SaveInviteFunc      func(*goch.Invite) error
+	GetInviteFunc       func(string, string) (*goch.Invite, error)
+	ListInvitesFunc     func(string) ([]*goch.Invite, error)
+	UseInviteFunc       func(string, string) (*goch.Invite, error)
+	ReleaseInviteFunc   func(string, string) error
+	RevokeInviteFunc    func(string, string) error
+	CreateAccountFunc   func(*goch.Account) error
+	SaveAccountFunc     func(*goch.Account) error
+	GetAccountFunc      func(string) (*goch.Account, error)
+	AddAccountChanFunc  func(string, string) error
+	RemAccountChanFunc  func(string, string) error
+	PresenceFunc        func(string, []string) (map[string]goch.Status, error)
+	ReadReceiptsFunc    func(string, []string) (map[string]uint64, error)
+	SaveWebhookFunc     func(*goch.Webhook) error
+	ListWebhooksFunc    func(string) ([]*goch.Webhook, error)
+	DeleteWebhookFunc   func(string, string) error
+	ListDeadLettersFunc func(string) ([]*goch.DeadLetter, error)
 }
 
 func (s *store) Save(c *goch.Chat) error           { return s.SaveFunc(c) }
 func (s *store) Get(id string) (*goch.Chat, error) { return s.GetFunc(id) }
 func (s *store) ListChannels() ([]string, error)   { return s.ListChansFunc() }
+func (s *store) ListDirect(uid string) ([]string, error) {
+	return s.ListDirectFunc(uid)
+}
 func (s *store) GetUnreadCount(uid, chanName string) uint64 {
 	return s.GetUnreadCountFunc(uid, chanName)
 }
+func (s *store) GetMentionCount(uid, chanName string) uint64 {
+	return s.GetMentionCountFunc(uid, chanName)
+}
+func (s *store) SaveInvite(inv *goch.Invite) error { return s.SaveInviteFunc(inv) }
+func (s *store) GetInvite(chanName, token string) (*goch.Invite, error) {
+	return s.GetInviteFunc(chanName, token)
+}
+func (s *store) ListInvites(chanName string) ([]*goch.Invite, error) {
+	return s.ListInvitesFunc(chanName)
+}
+func (s *store) UseInvite(chanName, token string) (*goch.Invite, error) {
+	return s.UseInviteFunc(chanName, token)
+}
+func (s *store) ReleaseInvite(chanName, token string) error {
+	return s.ReleaseInviteFunc(chanName, token)
+}
+func (s *store) RevokeInvite(chanName, token string) error {
+	return s.RevokeInviteFunc(chanName, token)
+}
+func (s *store) CreateAccount(a *goch.Account) error { return s.CreateAccountFunc(a) }
+func (s *store) SaveAccount(a *goch.Account) error   { return s.SaveAccountFunc(a) }
+func (s *store) GetAccount(uid string) (*goch.Account, error) {
+	if s.GetAccountFunc == nil {
+		return nil, errors.New("account not found")
+	}
+	return s.GetAccountFunc(uid)
+}
+func (s *store) AddAccountChannel(uid, chanName string) error {
+	return s.AddAccountChanFunc(uid, chanName)
+}
+func (s *store) RemoveAccountChannel(uid, chanName string) error {
+	return s.RemAccountChanFunc(uid, chanName)
+}
+func (s *store) Presence(chanName string, uids []string) (map[string]goch.Status, error) {
+	if s.PresenceFunc == nil {
+		return map[string]goch.Status{}, nil
+	}
+	return s.PresenceFunc(chanName, uids)
+}
+func (s *store) ReadReceipts(chanName string, uids []string) (map[string]uint64, error) {
+	return s.ReadReceiptsFunc(chanName, uids)
+}
+func (s *store) SaveWebhook(wh *goch.Webhook) error { return s.SaveWebhookFunc(wh) }
+func (s *store) ListWebhooks(chanName string) ([]*goch.Webhook, error) {
+	return s.ListWebhooksFunc(chanName)
+}
+func (s *store) DeleteWebhook(chanName, id string) error {
+	return s.DeleteWebhookFunc(chanName, id)
+}
+func (s *store) ListDeadLetters(chanName string) ([]*goch.DeadLetter, error) {
+	return s.ListDeadLettersFunc(chanName)
+}
@@ -0,0 +1,88 @@
+package chat
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/ribice/goch"
+	"github.com/ribice/goch/internal/export"
+)
+
+// NewExportAPI creates new channel export api
+func NewExportAPI(m *mux.Router, exp Exporter, l Limiter, authMW mux.MiddlewareFunc) *ExportAPI {
+	api := ExportAPI{
+		exp: exp,
+		lim: l,
+	}
+
+	ar := m.PathPrefix("/admin/channels/{chanName}/export").Subrouter()
+	ar.Use(authMW)
+	ar.HandleFunc("", api.export).Methods("GET")
+
+	return &api
+}
+
+// ExportAPI represents channel export api service
+type ExportAPI struct {
+	exp Exporter
+	lim Limiter
+}
+
+// Exporter represents chat history exporter interface
+type Exporter interface {
+	Export(io.Writer, string, export.Format) error
+}
+
+func (api *ExportAPI) export(w http.ResponseWriter, r *http.Request) {
+	chanName := mux.Vars(r)["chanName"]
+	if err := api.lim.Exceeds(chanName, goch.ChanLimit); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	format := export.JSONLines
+	if name := r.URL.Query().Get("format"); name != "" {
+		f, err := export.ParseFormat(name)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		format = f
+	}
+
+	ew := &exportWriter{
+		ResponseWriter: w,
+		contentType:    format.ContentType(),
+		fileName:       fmt.Sprintf("%s.%s", chanName, format),
+	}
+
+	if err := api.exp.Export(ew, chanName, format); err != nil {
+		if !ew.started {
+			http.Error(w, fmt.Sprintf("could not export channel: %v", err), 500)
+			return
+		}
+		// Headers are already sent, so the only way to signal
+		// failure is to abort the truncated response
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// exportWriter sets export headers on first write, so that errors
+// occurring before anything is exported can still be reported
+type exportWriter struct {
+	http.ResponseWriter
+	contentType string
+	fileName    string
+	started     bool
+}
+
+func (w *exportWriter) Write(b []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		w.Header().Set("Content-Type", w.contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", w.fileName))
+	}
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,109 @@
+package chat_test
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/ribice/goch/internal/chat"
+	"github.com/ribice/goch/internal/export"
+)
+
+func TestExport(t *testing.T) {
+	cases := []struct {
+		name      string
+		path      string
+		exp       *exporter
+		wantCode  int
+		wantType  string
+		wantBody  string
+		wantError bool
+	}{
+		{
+			name:     "Invalid format",
+			path:     "/admin/channels/1234567890/export?format=pdf",
+			exp:      &exporter{},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "Unexisting channel",
+			path: "/admin/channels/1234567890/export",
+			exp: &exporter{ExportFunc: func(io.Writer, string, export.Format) error {
+				return errors.New("redis: nil")
+			}},
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name: "Success",
+			path: "/admin/channels/1234567890/export?format=md",
+			exp: &exporter{ExportFunc: func(w io.Writer, id string, f export.Format) error {
+				if id != "1234567890" || f != export.Markdown {
+					return errors.New("unexpected export")
+				}
+				_, err := io.WriteString(w, "# 1234567890\n")
+				return err
+			}},
+			wantCode: http.StatusOK,
+			wantType: "text/markdown; charset=utf-8",
+			wantBody: "# 1234567890\n",
+		},
+		{
+			name: "Failure while streaming",
+			path: "/admin/channels/1234567890/export",
+			exp: &exporter{ExportFunc: func(w io.Writer, id string, f export.Format) error {
+				io.WriteString(w, "{}\n")
+				return errors.New("export: timed out waiting for message log")
+			}},
+			wantError: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := mux.NewRouter()
+			chat.NewExportAPI(m, tc.exp, cfg, middleware)
+			srv := httptest.NewServer(m)
+			defer srv.Close()
+
+			res, err := http.Get(srv.URL + tc.path)
+			if err == nil && tc.wantError {
+				// Aborted responses fail while reading body
+				_, err = ioutil.ReadAll(res.Body)
+			}
+			if (err != nil) != tc.wantError {
+				t.Fatalf("error = %v, wantError %v", err, tc.wantError)
+			}
+			if tc.wantError {
+				return
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tc.wantCode {
+				t.Errorf("unexpected response code. want: %d, got: %d", tc.wantCode, res.StatusCode)
+			}
+
+			if tc.wantType != "" && res.Header.Get("Content-Type") != tc.wantType {
+				t.Errorf("expected content type %s, got %s", tc.wantType, res.Header.Get("Content-Type"))
+			}
+
+			if tc.wantBody != "" {
+				body, _ := ioutil.ReadAll(res.Body)
+				if string(body) != tc.wantBody {
+					t.Errorf("expected body %q, got %q", tc.wantBody, body)
+				}
+			}
+		})
+	}
+}
+
+type exporter struct {
+	ExportFunc func(io.Writer, string, export.Format) error
+}
+
+func (e *exporter) Export(w io.Writer, id string, f export.Format) error {
+	return e.ExportFunc(w, id, f)
+}
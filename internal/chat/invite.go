@@ -0,0 +1,178 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ribice/goch"
+	"github.com/ribice/msv/render"
+)
+
+type inviteReq struct {
+	TTL     int64 `json:"ttl"` // Seconds until invite expires, zero for no expiration
+	MaxUses int   `json:"max_uses"`
+}
+
+func (r *inviteReq) Bind() error {
+	if r.TTL < 0 {
+		return errors.New("ttl must not be negative")
+	}
+	if r.MaxUses < 0 {
+		return errors.New("max_uses must not be negative")
+	}
+	return nil
+}
+
+type memberInviteReq struct {
+	memberReq
+	inviteReq
+}
+
+func (r *memberInviteReq) Bind() error {
+	if err := r.memberReq.Bind(); err != nil {
+		return err
+	}
+	return r.inviteReq.Bind()
+}
+
+func (api *API) createInvite(w http.ResponseWriter, r *http.Request) {
+	var req memberInviteReq
+	if err := render.Bind(w, r, &req); err != nil {
+		return
+	}
+
+	ch, err := api.authorize(w, mux.Vars(r)["name"], req.memberReq, goch.InvitePerm)
+	if err != nil {
+		return
+	}
+
+	api.saveInvite(w, ch.Name, req.UID, &req.inviteReq)
+}
+
+func (api *API) adminCreateInvite(w http.ResponseWriter, r *http.Request) {
+	chanName := mux.Vars(r)["chanName"]
+	if err := exceeds(chanName, goch.ChanLimit); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	var req inviteReq
+	if err := render.Bind(w, r, &req); err != nil {
+		return
+	}
+
+	if _, err := api.store.Get(chanName); err != nil {
+		http.Error(w, fmt.Sprintf("unexisting channel: %v", err), 500)
+		return
+	}
+
+	api.saveInvite(w, chanName, adminName(r), &req)
+}
+
+func (api *API) saveInvite(w http.ResponseWriter, chanName, createdBy string, req *inviteReq) {
+	inv, err := goch.NewInvite(chanName, createdBy, time.Duration(req.TTL)*time.Second, req.MaxUses)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not create invite: %v", err), 500)
+		return
+	}
+
+	if err = api.store.SaveInvite(inv); err != nil {
+		http.Error(w, fmt.Sprintf("could not create invite: %v", err), 500)
+		return
+	}
+	render.JSON(w, inv)
+}
+
+func (api *API) listInvites(w http.ResponseWriter, r *http.Request) {
+	mr, err := queryMember(w, r)
+	if err != nil {
+		return
+	}
+
+	ch, err := api.authorize(w, mux.Vars(r)["name"], mr, goch.InvitePerm)
+	if err != nil {
+		return
+	}
+
+	api.renderInvites(w, ch.Name)
+}
+
+func (api *API) adminListInvites(w http.ResponseWriter, r *http.Request) {
+	chanName := mux.Vars(r)["chanName"]
+	if err := exceeds(chanName, goch.ChanLimit); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	api.renderInvites(w, chanName)
+}
+
+// renderInvites writes channel invites which can still be used
+func (api *API) renderInvites(w http.ResponseWriter, chanName string) {
+	invs, err := api.store.ListInvites(chanName)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to fetch invites: %v", err), 500)
+		return
+	}
+
+	now := time.Now()
+	active := []*goch.Invite{}
+	for _, inv := range invs {
+		if inv.Valid(now) == nil {
+			active = append(active, inv)
+		}
+	}
+
+	render.JSON(w, active)
+}
+
+func (api *API) revokeInvite(w http.ResponseWriter, r *http.Request) {
+	mr, err := queryMember(w, r)
+	if err != nil {
+		return
+	}
+
+	ch, err := api.authorize(w, mux.Vars(r)["name"], mr, goch.InvitePerm)
+	if err != nil {
+		return
+	}
+
+	api.deleteInvite(w, ch.Name, mux.Vars(r)["token"])
+}
+
+func (api *API) adminRevokeInvite(w http.ResponseWriter, r *http.Request) {
+	chanName := mux.Vars(r)["chanName"]
+	if err := exceeds(chanName, goch.ChanLimit); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	api.deleteInvite(w, chanName, mux.Vars(r)["token"])
+}
+
+func (api *API) deleteInvite(w http.ResponseWriter, chanName, token string) {
+	err := api.store.RevokeInvite(chanName, token)
+	switch {
+	case err == goch.ErrInviteNotFound:
+		http.Error(w, err.Error(), 404)
+	case err != nil:
+		http.Error(w, fmt.Sprintf("could not revoke invite: %v", err), 500)
+	}
+}
+
+// queryMember reads member credentials from query params.
+// On failure, an error is written to w.
+func queryMember(w http.ResponseWriter, r *http.Request) (memberReq, error) {
+	mr := memberReq{
+		UID:    r.URL.Query().Get("uid"),
+		Secret: r.URL.Query().Get("secret"),
+	}
+	if err := mr.Bind(); err != nil {
+		http.Error(w, err.Error(), 400)
+		return mr, err
+	}
+	return mr, nil
+}
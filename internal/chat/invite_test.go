@@ -0,0 +1,254 @@
+package chat_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ribice/goch"
+	"github.com/ribice/goch/internal/chat"
+)
+
+const invToken = "INVITE12345678901234"
+
+func TestCreateInvite(t *testing.T) {
+	cases := []struct {
+		name      string
+		path      string
+		req       map[string]interface{}
+		wantCode  int
+		wantBy    string
+		wantLimit int
+	}{
+		{
+			name:     "Fail on negative ttl",
+			path:     "/admin/channels/1234567890/invites",
+			req:      map[string]interface{}{"ttl": -1},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Member cannot invite",
+			path:     "/channels/1234567890/invites",
+			req:      map[string]interface{}{"uid": memberUID, "secret": memSecret},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:      "Moderator invites",
+			path:      "/channels/1234567890/invites",
+			req:       map[string]interface{}{"uid": modUID, "secret": memSecret, "ttl": 3600, "max_uses": 5},
+			wantCode:  http.StatusOK,
+			wantBy:    modUID,
+			wantLimit: 5,
+		},
+		{
+			name:     "Admin invites",
+			path:     "/admin/channels/1234567890/invites",
+			req:      map[string]interface{}{"ttl": 3600},
+			wantCode: http.StatusOK,
+			wantBy:   "admin",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var saved *goch.Invite
+			s := &store{
+				GetFunc:        func(string) (*goch.Chat, error) { return moderatedChan(), nil },
+				SaveInviteFunc: func(inv *goch.Invite) error { saved = inv; return nil },
+			}
+			m := mux.NewRouter()
+			chat.New(m, s, &events{}, cfg, middleware)
+			srv := httptest.NewServer(m)
+			defer srv.Close()
+
+			req, err := json.Marshal(tc.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := http.Post(srv.URL+tc.path, "application/json", bytes.NewBuffer(req))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.StatusCode != tc.wantCode {
+				t.Errorf("unexpected response code. want: %d, got: %d", tc.wantCode, res.StatusCode)
+			}
+
+			if tc.wantBy != "" {
+				if saved == nil {
+					t.Fatal("expected invite to be saved")
+				}
+				if saved.CreatedBy != tc.wantBy || saved.Channel != "1234567890" || saved.MaxUses != tc.wantLimit {
+					t.Errorf("unexpected invite saved: %+v", saved)
+				}
+				if saved.ExpiresAt <= time.Now().UnixNano() {
+					t.Error("expected invite to expire in the future")
+				}
+			}
+		})
+	}
+}
+
+func TestListInvites(t *testing.T) {
+	s := &store{
+		GetFunc: func(string) (*goch.Chat, error) { return moderatedChan(), nil },
+		ListInvitesFunc: func(string) ([]*goch.Invite, error) {
+			return []*goch.Invite{
+				{Token: "active"},
+				{Token: "revoked", Revoked: true},
+				{Token: "used", MaxUses: 1, Uses: 1},
+			}, nil
+		},
+	}
+	m := mux.NewRouter()
+	chat.New(m, s, &events{}, cfg, middleware)
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/channels/1234567890/invites?uid=" + memberUID + "&secret=" + memSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("unexpected response code. want: %d, got: %d", http.StatusForbidden, res.StatusCode)
+	}
+
+	res, err = http.Get(srv.URL + "/channels/1234567890/invites?uid=" + modUID + "&secret=" + memSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected response code. want: %d, got: %d", http.StatusOK, res.StatusCode)
+	}
+
+	var invs []goch.Invite
+	if err := json.NewDecoder(res.Body).Decode(&invs); err != nil {
+		t.Fatal(err)
+	}
+	if len(invs) != 1 || invs[0].Token != "active" {
+		t.Errorf("expected only active invite to be listed, got %+v", invs)
+	}
+}
+
+func TestRevokeInvite(t *testing.T) {
+	var revoked string
+	s := &store{
+		GetFunc: func(string) (*goch.Chat, error) { return moderatedChan(), nil },
+		RevokeInviteFunc: func(_, token string) error {
+			revoked = token
+			return nil
+		},
+	}
+	m := mux.NewRouter()
+	chat.New(m, s, &events{}, cfg, middleware)
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	req, err := http.NewRequest("DELETE", srv.URL+"/channels/1234567890/invites/"+invToken+"?uid="+modUID+"&secret="+memSecret, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("unexpected response code. want: %d, got: %d", http.StatusOK, res.StatusCode)
+	}
+	if revoked != invToken {
+		t.Errorf("expected invite %s to be revoked, got %q", invToken, revoked)
+	}
+
+	s.RevokeInviteFunc = func(string, string) error { return goch.ErrInviteNotFound }
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("unexpected response code for unknown invite. want: %d, got: %d", http.StatusNotFound, res.StatusCode)
+	}
+}
+
+func TestRegisterWithInvite(t *testing.T) {
+	reg := registerReq{UID: "EmirABCDEF1234567890", Channel: "1234567890", Email: "ribice@gmail.com", Invite: invToken, DisplayName: "Emir", Secret: "12345678901234567890ABC"}
+	cases := []struct {
+		name     string
+		inv      *goch.Invite
+		useErr   error
+		saveErr  error
+		wantCode int
+		wantSave bool
+		wantRel  bool
+	}{
+		{
+			name:     "Expired invite",
+			inv:      &goch.Invite{Token: invToken, ExpiresAt: 1},
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Invite used up concurrently",
+			inv:      &goch.Invite{Token: invToken, MaxUses: 1},
+			useErr:   errors.New("invite: invite has no uses left"),
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Saving channel fails",
+			inv:      &goch.Invite{Token: invToken, MaxUses: 1},
+			saveErr:  errors.New("error saving to redis"),
+			wantCode: http.StatusInternalServerError,
+			wantSave: true,
+			wantRel:  true,
+		},
+		{
+			name:     "Success",
+			inv:      &goch.Invite{Token: invToken},
+			wantCode: http.StatusOK,
+			wantSave: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var saved, released bool
+			s := &store{
+				GetFunc: func(string) (*goch.Chat, error) {
+					return &goch.Chat{Name: "1234567890", Secret: "ABCDEFGHIJDKLOMNSOPR", Members: map[string]*goch.User{}}, nil
+				},
+				GetInviteFunc:     func(string, string) (*goch.Invite, error) { return tc.inv, nil },
+				UseInviteFunc:     func(string, string) (*goch.Invite, error) { return tc.inv, tc.useErr },
+				ReleaseInviteFunc: func(string, string) error { released = true; return nil },
+				SaveFunc:          func(*goch.Chat) error { saved = true; return tc.saveErr },
+			}
+			m := mux.NewRouter()
+			chat.New(m, s, &events{}, cfg, middleware)
+			srv := httptest.NewServer(m)
+			defer srv.Close()
+
+			req, err := json.Marshal(reg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := http.Post(srv.URL+"/channels/register", "application/json", bytes.NewBuffer(req))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.StatusCode != tc.wantCode {
+				t.Errorf("unexpected response code. want: %d, got: %d", tc.wantCode, res.StatusCode)
+			}
+
+			if saved != tc.wantSave {
+				t.Errorf("unexpected channel save. want: %v, got: %v", tc.wantSave, saved)
+			}
+
+			if released != tc.wantRel {
+				t.Errorf("unexpected invite release. want: %v, got: %v", tc.wantRel, released)
+			}
+		})
+	}
+}
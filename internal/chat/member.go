@@ -0,0 +1,301 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ribice/goch"
+	"github.com/ribice/msv/render"
+)
+
+// memberReq holds credentials of a channel member making the request
+type memberReq struct {
+	UID    string `json:"uid"`
+	Secret string `json:"secret"`
+}
+
+func (r *memberReq) Bind() error {
+	if !alfaRgx.MatchString(r.UID) {
+		return errors.New("uid must contain only alphanumeric and underscores")
+	}
+	if !alfaRgx.MatchString(r.Secret) {
+		return errors.New("secret must contain only alphanumeric and underscores")
+	}
+	return exceedsAny(map[string]goch.Limit{
+		r.UID:    goch.UIDLimit,
+		r.Secret: goch.SecretLimit,
+	})
+}
+
+// authorize fetches channel and checks whether member is allowed to perform p.
+// On failure, an error is written to w.
+func (api *API) authorize(w http.ResponseWriter, chanName string, mr memberReq, p goch.Permission) (*goch.Chat, error) {
+	if err := exceeds(chanName, goch.ChanLimit); err != nil {
+		http.Error(w, err.Error(), 400)
+		return nil, err
+	}
+
+	ch, err := api.store.Get(chanName)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid secret or unexisting channel: %v", err), 500)
+		return nil, err
+	}
+
+	if err = api.join(w, ch, mr.UID, mr.Secret); err != nil {
+		return nil, err
+	}
+
+	if err = ch.Authorize(mr.UID, p); err != nil {
+		http.Error(w, err.Error(), 403)
+		return nil, err
+	}
+
+	return ch, nil
+}
+
+// joinErrCode returns status code of failed join. Private chats
+// can't be joined directly, so they have no member endpoints.
+func joinErrCode(err error) int {
+	if err == goch.ErrDirectJoin {
+		return 403
+	}
+	return 500
+}
+
+// join verifies member's secret, persisting it in hashed form if it was
+// stored as plaintext. Secrets of account-registered members are verified
+// against their account. On failure, an error is written to w.
+func (api *API) join(w http.ResponseWriter, ch *goch.Chat, uid, secret string) error {
+	if ch.IsAccount(uid) {
+		acc, err := api.store.GetAccount(uid)
+		if err == nil {
+			_, err = ch.JoinAccount(acc, secret)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), joinErrCode(err))
+		}
+		return err
+	}
+
+	if _, err := ch.Join(uid, secret); err != nil {
+		http.Error(w, err.Error(), joinErrCode(err))
+		return err
+	}
+
+	if ch.Migrated() {
+		if err := api.store.Save(ch); err != nil {
+			http.Error(w, fmt.Sprintf("could not update channel membership: %v", err), 500)
+			return err
+		}
+	}
+
+	return nil
+}
+
+type kickReq struct {
+	memberReq
+	Target string `json:"target"`
+}
+
+func (r *kickReq) Bind() error {
+	if err := r.memberReq.Bind(); err != nil {
+		return err
+	}
+	return exceeds(r.Target, goch.UIDLimit)
+}
+
+func (api *API) kick(w http.ResponseWriter, r *http.Request) {
+	var req kickReq
+	if err := render.Bind(w, r, &req); err != nil {
+		return
+	}
+
+	ch, err := api.authorize(w, mux.Vars(r)["name"], req.memberReq, goch.KickPerm)
+	if err != nil {
+		return
+	}
+
+	if err = ch.AuthorizeOn(req.UID, req.Target, goch.KickPerm); err != nil {
+		http.Error(w, err.Error(), 403)
+		return
+	}
+
+	account := ch.IsAccount(req.Target)
+	ch.Leave(req.Target)
+
+	if err = api.saveMembership(w, ch); err != nil {
+		return
+	}
+
+	api.notifyUpdate(ch.Name)
+
+	if account {
+		api.store.RemoveAccountChannel(req.Target, ch.Name)
+	}
+}
+
+// saveMembership saves channel after its membership changed. Responds with
+// 409 if channel was modified concurrently, so the change can be retried.
+func (api *API) saveMembership(w http.ResponseWriter, ch *goch.Chat) error {
+	err := api.store.Save(ch)
+	switch {
+	case err == goch.ErrChatConflict:
+		http.Error(w, err.Error(), 409)
+	case err != nil:
+		http.Error(w, fmt.Sprintf("could not update channel membership: %v", err), 500)
+	}
+	return err
+}
+
+// notifyUpdate tells agents connected to chat id to reload it,
+// closing sessions of members who were removed from it
+func (api *API) notifyUpdate(id string) {
+	api.events.SendEvent(id, &goch.Event{Type: goch.ChatUpdateEvent, Time: time.Now().UnixNano()})
+}
+
+type roleReq struct {
+	memberReq
+	Target string `json:"target"`
+	Role   string `json:"role"`
+}
+
+func (r *roleReq) Bind() error {
+	if err := r.memberReq.Bind(); err != nil {
+		return err
+	}
+	return exceeds(r.Target, goch.UIDLimit)
+}
+
+func (api *API) changeRole(w http.ResponseWriter, r *http.Request) {
+	var req roleReq
+	if err := render.Bind(w, r, &req); err != nil {
+		return
+	}
+
+	role, err := goch.ParseRole(req.Role)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	ch, err := api.authorize(w, mux.Vars(r)["name"], req.memberReq, goch.RolePerm)
+	if err != nil {
+		return
+	}
+
+	if err = ch.AuthorizeOn(req.UID, req.Target, goch.RolePerm); err != nil || role > ch.Members[req.UID].Role {
+		http.Error(w, "chat: insufficient permissions", 403)
+		return
+	}
+
+	api.saveRole(w, ch, req.Target, role)
+}
+
+type setRoleReq struct {
+	Role string `json:"role"`
+}
+
+func (api *API) setRole(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, chanName := vars["uid"], vars["chanName"]
+	if err := exceedsAny(map[string]goch.Limit{
+		chanName: goch.ChanLimit,
+		uid:      goch.UIDLimit,
+	}); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	var req setRoleReq
+	if err := render.Bind(w, r, &req); err != nil {
+		return
+	}
+
+	role, err := goch.ParseRole(req.Role)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	ch, err := api.store.Get(chanName)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unexisting channel: %v", err), 500)
+		return
+	}
+
+	api.saveRole(w, ch, uid, role)
+}
+
+func (api *API) saveRole(w http.ResponseWriter, ch *goch.Chat, uid string, role goch.Role) {
+	if err := ch.SetRole(uid, role); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	if err := api.saveMembership(w, ch); err != nil {
+		return
+	}
+
+	api.notifyUpdate(ch.Name)
+}
+
+type rotateSecretReq struct {
+	memberReq
+	NewSecret string `json:"new_secret"` // Generated if not provided
+}
+
+type rotateSecretResp struct {
+	Secret string `json:"secret"`
+}
+
+func (r *rotateSecretReq) Bind() error {
+	if err := r.memberReq.Bind(); err != nil {
+		return err
+	}
+	if r.NewSecret == "" {
+		return nil
+	}
+	if !alfaRgx.MatchString(r.NewSecret) {
+		return errors.New("new_secret must contain only alphanumeric and underscores")
+	}
+	return exceeds(r.NewSecret, goch.SecretLimit)
+}
+
+func (api *API) rotateSecret(w http.ResponseWriter, r *http.Request) {
+	var req rotateSecretReq
+	if err := render.Bind(w, r, &req); err != nil {
+		return
+	}
+
+	chanName := mux.Vars(r)["name"]
+	if err := exceeds(chanName, goch.ChanLimit); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	ch, err := api.store.Get(chanName)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid secret or unexisting channel: %v", err), 500)
+		return
+	}
+
+	secret, err := ch.RotateSecret(req.UID, req.Secret, req.NewSecret)
+	switch {
+	case err == goch.ErrInvalidSecret:
+		http.Error(w, err.Error(), 401)
+		return
+	case err != nil:
+		// Member is unknown, banned, or has no secret of their own
+		http.Error(w, err.Error(), 403)
+		return
+	}
+
+	if err = api.saveMembership(w, ch); err != nil {
+		return
+	}
+
+	render.JSON(w, &rotateSecretResp{Secret: secret})
+}
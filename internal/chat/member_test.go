@@ -0,0 +1,354 @@
+package chat_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/ribice/goch"
+	"github.com/ribice/goch/internal/chat"
+)
+
+const (
+	modUID    = "MODERATOR12345678901"
+	memberUID = "MEMBER12345678901234"
+	ownerUID  = "OWNER123456789012345"
+	memSecret = "12345678901234567890"
+)
+
+var memHash = func() []byte {
+	var u goch.User
+	if err := u.SetSecret(memSecret); err != nil {
+		panic(err)
+	}
+	return u.SecretHash
+}()
+
+func moderatedChan() *goch.Chat {
+	return &goch.Chat{
+		Name: "1234567890",
+		Members: map[string]*goch.User{
+			modUID:    {UID: modUID, SecretHash: memHash, Role: goch.ModeratorRole},
+			memberUID: {UID: memberUID, SecretHash: memHash},
+			ownerUID:  {UID: ownerUID, SecretHash: memHash, Role: goch.OwnerRole},
+		},
+	}
+}
+
+func TestKick(t *testing.T) {
+	cases := []struct {
+		name     string
+		store    *store
+		req      map[string]string
+		wantCode int
+		wantKick string
+	}{
+		{
+			name:     "Fail on validation",
+			req:      map[string]string{"uid": "abc", "secret": memSecret, "target": memberUID},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "Member cannot kick",
+			store: &store{
+				GetFunc: func(string) (*goch.Chat, error) { return moderatedChan(), nil },
+			},
+			req:      map[string]string{"uid": memberUID, "secret": memSecret, "target": modUID},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name: "Moderator cannot kick owner",
+			store: &store{
+				GetFunc: func(string) (*goch.Chat, error) { return moderatedChan(), nil },
+			},
+			req:      map[string]string{"uid": modUID, "secret": memSecret, "target": ownerUID},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name: "Success",
+			store: &store{
+				GetFunc: func(string) (*goch.Chat, error) { return moderatedChan(), nil },
+			},
+			req:      map[string]string{"uid": modUID, "secret": memSecret, "target": memberUID},
+			wantCode: http.StatusOK,
+			wantKick: memberUID,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var saved *goch.Chat
+			if tc.store != nil {
+				tc.store.SaveFunc = func(c *goch.Chat) error { saved = c; return nil }
+			}
+			m := mux.NewRouter()
+			chat.New(m, tc.store, &events{}, cfg, middleware)
+			srv := httptest.NewServer(m)
+			defer srv.Close()
+
+			req, err := json.Marshal(tc.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := http.Post(srv.URL+"/channels/1234567890/kick", "application/json", bytes.NewBuffer(req))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.StatusCode != tc.wantCode {
+				t.Errorf("unexpected response code. want: %d, got: %d", tc.wantCode, res.StatusCode)
+			}
+
+			if tc.wantKick != "" {
+				if saved == nil {
+					t.Fatal("expected channel to be saved")
+				}
+				if _, ok := saved.Members[tc.wantKick]; ok {
+					t.Errorf("expected %s to be kicked", tc.wantKick)
+				}
+				if !saved.Members[modUID].VerifySecret(memSecret) {
+					t.Error("expected moderator's secret to be preserved")
+				}
+			}
+		})
+	}
+}
+
+func TestChangeRole(t *testing.T) {
+	cases := []struct {
+		name     string
+		req      map[string]string
+		wantCode int
+		wantRole goch.Role
+	}{
+		{
+			name:     "Invalid role",
+			req:      map[string]string{"uid": ownerUID, "secret": memSecret, "target": memberUID, "role": "admin"},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Moderator cannot change roles",
+			req:      map[string]string{"uid": modUID, "secret": memSecret, "target": memberUID, "role": "moderator"},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Owner cannot grant ownership above own rank",
+			req:      map[string]string{"uid": ownerUID, "secret": memSecret, "target": ownerUID, "role": "owner"},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Owner promotes member",
+			req:      map[string]string{"uid": ownerUID, "secret": memSecret, "target": memberUID, "role": "moderator"},
+			wantCode: http.StatusOK,
+			wantRole: goch.ModeratorRole,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var saved *goch.Chat
+			s := &store{
+				GetFunc:  func(string) (*goch.Chat, error) { return moderatedChan(), nil },
+				SaveFunc: func(c *goch.Chat) error { saved = c; return nil },
+			}
+			m := mux.NewRouter()
+			ev := &events{}
+			chat.New(m, s, ev, cfg, middleware)
+			srv := httptest.NewServer(m)
+			defer srv.Close()
+
+			req, err := json.Marshal(tc.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := http.Post(srv.URL+"/channels/1234567890/role", "application/json", bytes.NewBuffer(req))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.StatusCode != tc.wantCode {
+				t.Errorf("unexpected response code. want: %d, got: %d", tc.wantCode, res.StatusCode)
+			}
+
+			if tc.wantCode == http.StatusOK && saved.Members[tc.req["target"]].Role != tc.wantRole {
+				t.Errorf("expected role %v but got %v", tc.wantRole, saved.Members[tc.req["target"]].Role)
+			}
+
+			if wantEvent := tc.wantCode == http.StatusOK; wantEvent != (len(ev.sent) == 1) {
+				t.Errorf("unexpected chat update events %v", ev.sent)
+			}
+		})
+	}
+}
+
+func TestSetRole(t *testing.T) {
+	cases := []struct {
+		name     string
+		store    *store
+		uid      string
+		role     string
+		wantCode int
+	}{
+		{
+			name:     "Invalid role",
+			uid:      memberUID,
+			role:     "admin",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "Error fetching channel",
+			store: &store{
+				GetFunc: func(string) (*goch.Chat, error) { return nil, errors.New("err fetching chan") },
+			},
+			uid:      memberUID,
+			role:     "moderator",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name: "Not a member",
+			store: &store{
+				GetFunc: func(string) (*goch.Chat, error) { return moderatedChan(), nil },
+			},
+			uid:      "STRANGER123456789012",
+			role:     "moderator",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "Conflicting save",
+			store: &store{
+				GetFunc:  func(string) (*goch.Chat, error) { return moderatedChan(), nil },
+				SaveFunc: func(*goch.Chat) error { return goch.ErrChatConflict },
+			},
+			uid:      memberUID,
+			role:     "moderator",
+			wantCode: http.StatusConflict,
+		},
+		{
+			name: "Success",
+			store: &store{
+				GetFunc:  func(string) (*goch.Chat, error) { return moderatedChan(), nil },
+				SaveFunc: func(*goch.Chat) error { return nil },
+			},
+			uid:      memberUID,
+			role:     "moderator",
+			wantCode: http.StatusOK,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := mux.NewRouter()
+			ev := &events{}
+			chat.New(m, tc.store, ev, cfg, middleware)
+			srv := httptest.NewServer(m)
+			defer srv.Close()
+
+			req, err := json.Marshal(map[string]string{"role": tc.role})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := http.NewRequest("PUT", srv.URL+"/admin/channels/1234567890/user/"+tc.uid+"/role", bytes.NewBuffer(req))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := http.DefaultClient.Do(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.StatusCode != tc.wantCode {
+				t.Errorf("unexpected response code. want: %d, got: %d", tc.wantCode, res.StatusCode)
+			}
+
+			if wantEvent := tc.wantCode == http.StatusOK; wantEvent != (len(ev.sent) == 1) {
+				t.Errorf("unexpected chat update events %v", ev.sent)
+			}
+		})
+	}
+}
+
+func TestRotateSecret(t *testing.T) {
+	const newSecret = "NEWSECRET12345678901"
+	cases := []struct {
+		name     string
+		req      map[string]string
+		saveErr  error
+		wantCode int
+		wantNew  string
+	}{
+		{
+			name:     "Invalid new secret",
+			req:      map[string]string{"uid": memberUID, "secret": memSecret, "new_secret": "short"},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Invalid current secret",
+			req:      map[string]string{"uid": memberUID, "secret": "INVALID1234567890123"},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Unknown member",
+			req:      map[string]string{"uid": "UNKNOWN1234567890123", "secret": memSecret},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Conflicting save",
+			req:      map[string]string{"uid": memberUID, "secret": memSecret, "new_secret": newSecret},
+			saveErr:  goch.ErrChatConflict,
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "Success",
+			req:      map[string]string{"uid": memberUID, "secret": memSecret, "new_secret": newSecret},
+			wantCode: http.StatusOK,
+			wantNew:  newSecret,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := moderatedChan()
+			s := &store{
+				GetFunc:  func(string) (*goch.Chat, error) { return ch, nil },
+				SaveFunc: func(*goch.Chat) error { return tc.saveErr },
+			}
+			m := mux.NewRouter()
+			chat.New(m, s, &events{}, cfg, middleware)
+			srv := httptest.NewServer(m)
+			defer srv.Close()
+
+			req, err := json.Marshal(tc.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := http.Post(srv.URL+"/channels/1234567890/secret", "application/json", bytes.NewBuffer(req))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.StatusCode != tc.wantCode {
+				t.Errorf("unexpected response code. want: %d, got: %d", tc.wantCode, res.StatusCode)
+			}
+
+			if tc.wantNew != "" {
+				var resp struct {
+					Secret string `json:"secret"`
+				}
+				if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+					t.Fatal(err)
+				}
+				if resp.Secret != tc.wantNew {
+					t.Errorf("expected secret %s, got %s", tc.wantNew, resp.Secret)
+				}
+				if _, err := ch.Join(memberUID, tc.wantNew); err != nil {
+					t.Errorf("expected new secret to be accepted: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package chat
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/ribice/goch"
+	"github.com/ribice/msv/render"
+)
+
+type receiptResp struct {
+	UID string `json:"uid"`
+	Seq uint64 `json:"seq"`
+}
+
+// listReceipts returns how far each channel member has read. If seq query
+// param is provided, only members who have read message seq are returned.
+func (api *API) listReceipts(w http.ResponseWriter, r *http.Request) {
+	var seq uint64
+	if v := r.URL.Query().Get("seq"); v != "" {
+		var err error
+		if seq, err = strconv.ParseUint(v, 10, 64); err != nil {
+			http.Error(w, "seq must be a positive number", 400)
+			return
+		}
+	}
+
+	mr, err := queryMember(w, r)
+	if err != nil {
+		return
+	}
+
+	ch, err := api.authorize(w, mux.Vars(r)["name"], mr, goch.ReadPerm)
+	if err != nil {
+		return
+	}
+
+	if ch.DisableReceipts {
+		http.Error(w, "read receipts are disabled in this channel", 403)
+		return
+	}
+
+	uids := make([]string, 0, len(ch.Members))
+	for uid := range ch.Members {
+		uids = append(uids, uid)
+	}
+
+	rs, err := api.store.ReadReceipts(ch.Name, uids)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to fetch read receipts: %v", err), 500)
+		return
+	}
+
+	resp := []receiptResp{}
+	for uid, s := range rs {
+		if s >= seq {
+			resp = append(resp, receiptResp{UID: uid, Seq: s})
+		}
+	}
+
+	sort.Slice(resp, func(i, j int) bool {
+		if resp[i].Seq != resp[j].Seq {
+			return resp[i].Seq > resp[j].Seq
+		}
+		return resp[i].UID < resp[j].UID
+	})
+
+	render.JSON(w, resp)
+}
@@ -0,0 +1,86 @@
+package chat_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/ribice/goch"
+	"github.com/ribice/goch/internal/chat"
+)
+
+func TestListReceipts(t *testing.T) {
+	type receipt struct {
+		UID string `json:"uid"`
+		Seq uint64 `json:"seq"`
+	}
+	cases := []struct {
+		name     string
+		query    string
+		disabled bool
+		wantCode int
+		want     []receipt
+	}{
+		{
+			name:     "Invalid seq",
+			query:    "&seq=abc",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Receipts disabled",
+			disabled: true,
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "All receipts",
+			wantCode: http.StatusOK,
+			want:     []receipt{{modUID, 12}, {memberUID, 7}, {ownerUID, 7}},
+		},
+		{
+			name:     "Members who read message",
+			query:    "&seq=10",
+			wantCode: http.StatusOK,
+			want:     []receipt{{modUID, 12}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &store{
+				GetFunc: func(string) (*goch.Chat, error) {
+					ch := moderatedChan()
+					ch.DisableReceipts = tc.disabled
+					return ch, nil
+				},
+				ReadReceiptsFunc: func(string, []string) (map[string]uint64, error) {
+					return map[string]uint64{modUID: 12, memberUID: 7, ownerUID: 7}, nil
+				},
+			}
+			m := mux.NewRouter()
+			chat.New(m, s, &events{}, cfg, middleware)
+			srv := httptest.NewServer(m)
+			defer srv.Close()
+
+			res, err := http.Get(srv.URL + "/channels/1234567890/receipts?uid=" + memberUID + "&secret=" + memSecret + tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.StatusCode != tc.wantCode {
+				t.Errorf("unexpected response code. want: %d, got: %d", tc.wantCode, res.StatusCode)
+			}
+
+			if tc.want != nil {
+				var got []receipt
+				if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, tc.want) {
+					t.Errorf("expected receipts %v, got %v", tc.want, got)
+				}
+			}
+		})
+	}
+}
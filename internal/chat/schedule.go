@@ -0,0 +1,168 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/ribice/goch"
+	"github.com/ribice/msv/render"
+)
+
+// NewScheduleAPI creates new scheduled message api. Member credentials
+// are checked the same way as in api created with New.
+func NewScheduleAPI(m *mux.Router, store ScheduleStore, mod Moderator) *ScheduleAPI {
+	api := ScheduleAPI{
+		API:   API{store: store},
+		store: store,
+		mod:   mod,
+	}
+
+	sr := m.PathPrefix("/channels/{name}/scheduled").Subrouter()
+	sr.HandleFunc("", api.scheduleMessage).Methods("POST")
+	sr.HandleFunc("", api.listScheduled).Methods("GET")
+	sr.HandleFunc("/{id}", api.cancelScheduled).Methods("DELETE")
+
+	return &api
+}
+
+// ScheduleAPI represents scheduled message api service
+type ScheduleAPI struct {
+	API
+	store ScheduleStore
+	mod   Moderator
+}
+
+// ScheduleStore represents scheduled message store interface
+type ScheduleStore interface {
+	Store
+	ScheduleMessage(*goch.Scheduled) error
+	GetScheduled(string, string) (*goch.Scheduled, error)
+	ListScheduled(string, string) ([]*goch.Scheduled, error)
+	CancelScheduled(string, string) error
+}
+
+type scheduleReq struct {
+	memberReq
+	Text   string            `json:"text"`
+	Meta   map[string]string `json:"meta"`
+	SendAt int64             `json:"send_at"` // UnixNano
+	TTL    int64             `json:"ttl"`     // Seconds after sending message expires, channel's default if zero
+}
+
+func (r *scheduleReq) Bind() error {
+	if err := r.memberReq.Bind(); err != nil {
+		return err
+	}
+	if r.Text == "" {
+		return errors.New("sent empty message")
+	}
+	if len(r.Text) > goch.MaxTextLength {
+		return fmt.Errorf("exceeded max message length of %d characters", goch.MaxTextLength)
+	}
+	return nil
+}
+
+func (api *ScheduleAPI) scheduleMessage(w http.ResponseWriter, r *http.Request) {
+	var req scheduleReq
+	if err := render.Bind(w, r, &req); err != nil {
+		return
+	}
+
+	ch, err := api.authorize(w, mux.Vars(r)["name"], req.memberReq, goch.PostPerm)
+	if err != nil {
+		return
+	}
+
+	m := &goch.Message{
+		Meta:     req.Meta,
+		Text:     req.Text,
+		FromUID:  req.UID,
+		FromName: api.displayName(ch, req.UID),
+	}
+
+	// Expiry is recomputed once message is sent
+	if err = m.SetTTL(ch.MessageTTL(req.TTL)); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	if err = api.mod.Moderate(ch.Name, m); err != nil {
+		http.Error(w, fmt.Sprintf("message rejected: %v", err), 400)
+		return
+	}
+
+	m.Mentions = ch.MentionedBy(req.UID, m.Text)
+
+	sm, err := goch.NewScheduled(ch.Name, m, req.SendAt)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	if err = api.store.ScheduleMessage(sm); err != nil {
+		http.Error(w, fmt.Sprintf("could not schedule message: %v", err), 500)
+		return
+	}
+
+	render.JSON(w, sm)
+}
+
+func (api *ScheduleAPI) listScheduled(w http.ResponseWriter, r *http.Request) {
+	mr, err := queryMember(w, r)
+	if err != nil {
+		return
+	}
+
+	ch, err := api.authorize(w, mux.Vars(r)["name"], mr, goch.ReadPerm)
+	if err != nil {
+		return
+	}
+
+	sms, err := api.store.ListScheduled(ch.Name, mr.UID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to fetch scheduled messages: %v", err), 500)
+		return
+	}
+
+	if sms == nil {
+		sms = []*goch.Scheduled{}
+	}
+
+	render.JSON(w, sms)
+}
+
+func (api *ScheduleAPI) cancelScheduled(w http.ResponseWriter, r *http.Request) {
+	mr, err := queryMember(w, r)
+	if err != nil {
+		return
+	}
+
+	ch, err := api.authorize(w, mux.Vars(r)["name"], mr, goch.ReadPerm)
+	if err != nil {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	sm, err := api.store.GetScheduled(ch.Name, id)
+	if err != nil || sm.Message.FromUID != mr.UID {
+		http.Error(w, "can only cancel your own scheduled messages", 403)
+		return
+	}
+
+	if err = api.store.CancelScheduled(ch.Name, id); err != nil {
+		http.Error(w, fmt.Sprintf("could not cancel scheduled message: %v", err), 500)
+	}
+}
+
+// displayName returns chat member's display name, which
+// is kept in their account if they registered with one
+func (api *API) displayName(ch *goch.Chat, uid string) string {
+	if ch.IsAccount(uid) {
+		if acc, err := api.store.GetAccount(uid); err == nil {
+			return acc.DisplayName
+		}
+	}
+	return ch.Members[uid].DisplayName
+}
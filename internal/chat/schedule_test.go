@@ -0,0 +1,201 @@
+package chat_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ribice/goch"
+	"github.com/ribice/goch/internal/chat"
+)
+
+func TestScheduleMessage(t *testing.T) {
+	cases := []struct {
+		name     string
+		req      map[string]interface{}
+		wantCode int
+	}{
+		{
+			name:     "Fail on empty message",
+			req:      map[string]interface{}{"uid": memberUID, "secret": memSecret, "send_at": time.Now().Add(time.Hour).UnixNano()},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Fail on send time in the past",
+			req:      map[string]interface{}{"uid": memberUID, "secret": memSecret, "text": "hello", "send_at": time.Now().Add(-time.Hour).UnixNano()},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Fail on moderated message",
+			req:      map[string]interface{}{"uid": memberUID, "secret": memSecret, "text": "spam", "send_at": time.Now().Add(time.Hour).UnixNano()},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Success",
+			req:      map[string]interface{}{"uid": memberUID, "secret": memSecret, "text": "hello @" + modUID, "send_at": time.Now().Add(time.Hour).UnixNano()},
+			wantCode: http.StatusOK,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var saved *goch.Scheduled
+			s := &schedStore{
+				store:     &store{GetFunc: func(string) (*goch.Chat, error) { return moderatedChan(), nil }},
+				scheduled: map[string]*goch.Scheduled{},
+				ScheduleFunc: func(sm *goch.Scheduled) error {
+					saved = sm
+					return nil
+				},
+			}
+			m := mux.NewRouter()
+			chat.New(m, s, &events{}, cfg, middleware)
+			chat.NewScheduleAPI(m, s, &moderator{})
+			srv := httptest.NewServer(m)
+			defer srv.Close()
+
+			req, err := json.Marshal(tc.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := http.Post(srv.URL+"/channels/1234567890/scheduled", "application/json", bytes.NewBuffer(req))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tc.wantCode {
+				t.Fatalf("unexpected response code. want: %d, got: %d", tc.wantCode, res.StatusCode)
+			}
+
+			if tc.wantCode != http.StatusOK {
+				if saved != nil {
+					t.Error("expected message not to be scheduled")
+				}
+				return
+			}
+
+			if saved == nil || saved.Channel != "1234567890" || saved.Message.FromUID != memberUID {
+				t.Fatalf("unexpected scheduled message %+v", saved)
+			}
+			if len(saved.Message.Mentions) != 1 || saved.Message.Mentions[0] != modUID {
+				t.Errorf("expected mentions to be set, got %v", saved.Message.Mentions)
+			}
+		})
+	}
+}
+
+func TestListScheduled(t *testing.T) {
+	s := &schedStore{
+		store: &store{GetFunc: func(string) (*goch.Chat, error) { return moderatedChan(), nil }},
+		scheduled: map[string]*goch.Scheduled{
+			"1": {ID: "1", Message: &goch.Message{Text: "first", FromUID: memberUID}},
+		},
+	}
+	m := mux.NewRouter()
+	chat.New(m, s, &events{}, cfg, middleware)
+	chat.NewScheduleAPI(m, s, &moderator{})
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/channels/1234567890/scheduled?uid=" + memberUID + "&secret=" + memSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected response code. want: %d, got: %d", http.StatusOK, res.StatusCode)
+	}
+
+	var sms []goch.Scheduled
+	if err := json.NewDecoder(res.Body).Decode(&sms); err != nil {
+		t.Fatal(err)
+	}
+	if len(sms) != 1 || sms[0].ID != "1" {
+		t.Errorf("expected own scheduled message to be listed, got %+v", sms)
+	}
+}
+
+func TestCancelScheduled(t *testing.T) {
+	cases := []struct {
+		name       string
+		uid        string
+		wantCode   int
+		wantCancel bool
+	}{
+		{
+			name:     "Fail on cancelling others' message",
+			uid:      modUID,
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:       "Success",
+			uid:        memberUID,
+			wantCode:   http.StatusOK,
+			wantCancel: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &schedStore{
+				store: &store{GetFunc: func(string) (*goch.Chat, error) { return moderatedChan(), nil }},
+				scheduled: map[string]*goch.Scheduled{
+					"1": {ID: "1", Message: &goch.Message{Text: "first", FromUID: memberUID}},
+				},
+			}
+			m := mux.NewRouter()
+			chat.New(m, s, &events{}, cfg, middleware)
+			chat.NewScheduleAPI(m, s, &moderator{})
+			srv := httptest.NewServer(m)
+			defer srv.Close()
+
+			req, err := http.NewRequest("DELETE", srv.URL+"/channels/1234567890/scheduled/1?uid="+tc.uid+"&secret="+memSecret, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tc.wantCode {
+				t.Errorf("unexpected response code. want: %d, got: %d", tc.wantCode, res.StatusCode)
+			}
+			if _, ok := s.scheduled["1"]; ok == tc.wantCancel {
+				t.Errorf("expected message to be cancelled: %v", tc.wantCancel)
+			}
+		})
+	}
+}
+
+type schedStore struct {
+	*store
+	scheduled    map[string]*goch.Scheduled
+	ScheduleFunc func(*goch.Scheduled) error
+}
+
+func (s *schedStore) ScheduleMessage(sm *goch.Scheduled) error { return s.ScheduleFunc(sm) }
+
+func (s *schedStore) GetScheduled(_, id string) (*goch.Scheduled, error) {
+	sm, ok := s.scheduled[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return sm, nil
+}
+
+func (s *schedStore) ListScheduled(_, uid string) ([]*goch.Scheduled, error) {
+	var sms []*goch.Scheduled
+	for _, sm := range s.scheduled {
+		if sm.Message.FromUID == uid {
+			sms = append(sms, sm)
+		}
+	}
+	return sms, nil
+}
+
+func (s *schedStore) CancelScheduled(_, id string) error {
+	delete(s.scheduled, id)
+	return nil
+}
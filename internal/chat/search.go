@@ -0,0 +1,129 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/ribice/goch"
+	"github.com/ribice/goch/pkg/search"
+	"github.com/ribice/msv/render"
+)
+
+const (
+	maxQueryLength = 256
+	maxMetaFilters = 10
+)
+
+// NewSearchAPI creates new message search api. Member credentials
+// are checked the same way as in api created with New.
+func NewSearchAPI(m *mux.Router, store Store, s Searcher) *SearchAPI {
+	api := SearchAPI{
+		API:    API{store: store},
+		search: s,
+	}
+
+	m.HandleFunc("/channels/{name}/search", api.searchMessages).Methods("GET")
+
+	return &api
+}
+
+// SearchAPI represents message search api service
+type SearchAPI struct {
+	API
+	search Searcher
+}
+
+// Searcher represents message search index interface
+type Searcher interface {
+	Search(string, search.Query) ([]goch.Message, error)
+}
+
+// searchMessages returns channel messages matching provided query params:
+// q (message text), from_uid, since and until (UnixNano), meta (key:value,
+// may be repeated) and limit
+func (api *SearchAPI) searchMessages(w http.ResponseWriter, r *http.Request) {
+	q, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	mr, err := queryMember(w, r)
+	if err != nil {
+		return
+	}
+
+	ch, err := api.authorize(w, mux.Vars(r)["name"], mr, goch.ReadPerm)
+	if err != nil {
+		return
+	}
+
+	msgs, err := api.search.Search(ch.Name, q)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to search messages: %v", err), 500)
+		return
+	}
+
+	if msgs == nil {
+		msgs = []goch.Message{}
+	}
+
+	render.JSON(w, msgs)
+}
+
+func parseQuery(r *http.Request) (search.Query, error) {
+	v := r.URL.Query()
+	q := search.Query{
+		Text:    v.Get("q"),
+		FromUID: v.Get("from_uid"),
+	}
+
+	if len(q.Text) > maxQueryLength {
+		return q, fmt.Errorf("q must be at most %d characters long", maxQueryLength)
+	}
+
+	if q.FromUID != "" {
+		if err := exceeds(q.FromUID, goch.UIDLimit); err != nil {
+			return q, err
+		}
+	}
+
+	for name, dst := range map[string]*int64{"since": &q.Since, "until": &q.Until} {
+		if s := v.Get(name); s != "" {
+			t, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || t < 0 {
+				return q, fmt.Errorf("%s must be a positive number", name)
+			}
+			*dst = t
+		}
+	}
+
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > search.MaxLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d", search.MaxLimit)
+		}
+		q.Limit = n
+	}
+
+	if len(v["meta"]) > maxMetaFilters {
+		return q, fmt.Errorf("at most %d meta filters are allowed", maxMetaFilters)
+	}
+
+	for _, kv := range v["meta"] {
+		parts := strings.SplitN(kv, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return q, errors.New("meta filter must be in key:value format")
+		}
+		if q.Meta == nil {
+			q.Meta = make(map[string]string)
+		}
+		q.Meta[parts[0]] = parts[1]
+	}
+
+	return q, nil
+}
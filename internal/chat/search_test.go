@@ -0,0 +1,114 @@
+package chat_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/ribice/goch"
+	"github.com/ribice/goch/internal/chat"
+	"github.com/ribice/goch/pkg/search"
+)
+
+func TestSearchMessages(t *testing.T) {
+	cases := []struct {
+		name     string
+		secret   string
+		query    string
+		wantCode int
+		wantQ    *search.Query
+	}{
+		{
+			name:     "Invalid time range",
+			query:    "&since=yesterday",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Invalid limit",
+			query:    "&limit=1000",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Invalid meta filter",
+			query:    "&meta=env",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Invalid credentials",
+			secret:   "wrongwrongwrongwrong",
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "Success",
+			query:    "&q=deploy+done&from_uid=" + modUID + "&since=100&until=200&meta=env:prod&limit=5",
+			wantCode: http.StatusOK,
+			wantQ: &search.Query{
+				Text:    "deploy done",
+				FromUID: modUID,
+				Since:   100,
+				Until:   200,
+				Meta:    map[string]string{"env": "prod"},
+				Limit:   5,
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &store{
+				GetFunc: func(string) (*goch.Chat, error) {
+					return moderatedChan(), nil
+				},
+			}
+			idx := &searcher{}
+			m := mux.NewRouter()
+			chat.New(m, s, &events{}, cfg, middleware)
+			chat.NewSearchAPI(m, s, idx)
+			srv := httptest.NewServer(m)
+			defer srv.Close()
+
+			secret := memSecret
+			if tc.secret != "" {
+				secret = tc.secret
+			}
+
+			res, err := http.Get(srv.URL + "/channels/1234567890/search?uid=" + memberUID + "&secret=" + secret + tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tc.wantCode {
+				t.Errorf("unexpected response code. want: %d, got: %d", tc.wantCode, res.StatusCode)
+			}
+
+			if tc.wantQ == nil {
+				return
+			}
+
+			if idx.chat != "1234567890" || !reflect.DeepEqual(&idx.q, tc.wantQ) {
+				t.Errorf("expected query %v on chat 1234567890, got %v on %s", tc.wantQ, idx.q, idx.chat)
+			}
+
+			var msgs []goch.Message
+			if err := json.NewDecoder(res.Body).Decode(&msgs); err != nil {
+				t.Fatal(err)
+			}
+			if len(msgs) != 1 || msgs[0].Seq != 7 {
+				t.Errorf("expected search results, got %v", msgs)
+			}
+		})
+	}
+}
+
+type searcher struct {
+	chat string
+	q    search.Query
+}
+
+func (s *searcher) Search(id string, q search.Query) ([]goch.Message, error) {
+	s.chat, s.q = id, q
+	return []goch.Message{{Seq: 7, Text: "deploy is done", FromUID: "john"}}, nil
+}
@@ -0,0 +1,115 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+	"github.com/ribice/goch"
+	"github.com/ribice/msv/render"
+)
+
+const maxWebhookURLLength = 2048
+
+type webhookReq struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"` // Empty to subscribe to all events
+}
+
+func (r *webhookReq) Bind() error {
+	if len(r.URL) > maxWebhookURLLength {
+		return fmt.Errorf("url must be at most %d characters long", maxWebhookURLLength)
+	}
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be a valid http or https url")
+	}
+	return nil
+}
+
+func (api *API) createWebhook(w http.ResponseWriter, r *http.Request) {
+	chanName := mux.Vars(r)["chanName"]
+	if err := exceeds(chanName, goch.ChanLimit); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	var req webhookReq
+	if err := render.Bind(w, r, &req); err != nil {
+		return
+	}
+
+	wh, err := goch.NewWebhook(chanName, req.URL, req.Events)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	if _, err := api.store.Get(chanName); err != nil {
+		http.Error(w, fmt.Sprintf("unexisting channel: %v", err), 500)
+		return
+	}
+
+	if err := api.store.SaveWebhook(wh); err != nil {
+		http.Error(w, fmt.Sprintf("could not create webhook: %v", err), 500)
+		return
+	}
+
+	// Secret is returned only on creation
+	render.JSON(w, wh)
+}
+
+func (api *API) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	chanName := mux.Vars(r)["chanName"]
+	if err := exceeds(chanName, goch.ChanLimit); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	whs, err := api.store.ListWebhooks(chanName)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to fetch webhooks: %v", err), 500)
+		return
+	}
+
+	resp := make([]*goch.Webhook, len(whs))
+	for i, wh := range whs {
+		resp[i] = wh.Public()
+	}
+
+	render.JSON(w, resp)
+}
+
+func (api *API) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	chanName := mux.Vars(r)["chanName"]
+	if err := exceeds(chanName, goch.ChanLimit); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	if err := api.store.DeleteWebhook(chanName, mux.Vars(r)["id"]); err != nil {
+		http.Error(w, fmt.Sprintf("could not delete webhook: %v", err), 500)
+	}
+}
+
+func (api *API) listDeadLetters(w http.ResponseWriter, r *http.Request) {
+	chanName := mux.Vars(r)["chanName"]
+	if err := exceeds(chanName, goch.ChanLimit); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	dls, err := api.store.ListDeadLetters(chanName)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to fetch dead letters: %v", err), 500)
+		return
+	}
+
+	if dls == nil {
+		dls = []*goch.DeadLetter{}
+	}
+
+	render.JSON(w, dls)
+}
@@ -0,0 +1,155 @@
+package chat_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/ribice/goch"
+	"github.com/ribice/goch/internal/chat"
+)
+
+func TestCreateWebhook(t *testing.T) {
+	cases := []struct {
+		name     string
+		req      map[string]interface{}
+		wantCode int
+	}{
+		{
+			name:     "Fail on invalid url",
+			req:      map[string]interface{}{"url": "ftp://example.com"},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Fail on unknown event",
+			req:      map[string]interface{}{"url": "https://example.com/hook", "events": []string{"typing"}},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Success",
+			req:      map[string]interface{}{"url": "https://example.com/hook", "events": []string{"message", "edit"}},
+			wantCode: http.StatusOK,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var saved *goch.Webhook
+			s := &store{
+				GetFunc:         func(string) (*goch.Chat, error) { return moderatedChan(), nil },
+				SaveWebhookFunc: func(wh *goch.Webhook) error { saved = wh; return nil },
+			}
+			m := mux.NewRouter()
+			chat.New(m, s, &events{}, cfg, middleware)
+			srv := httptest.NewServer(m)
+			defer srv.Close()
+
+			req, err := json.Marshal(tc.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := http.Post(srv.URL+"/admin/channels/1234567890/webhooks", "application/json", bytes.NewBuffer(req))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.StatusCode != tc.wantCode {
+				t.Fatalf("unexpected response code. want: %d, got: %d", tc.wantCode, res.StatusCode)
+			}
+
+			if tc.wantCode != http.StatusOK {
+				if saved != nil {
+					t.Error("expected webhook not to be saved")
+				}
+				return
+			}
+
+			var wh goch.Webhook
+			if err := json.NewDecoder(res.Body).Decode(&wh); err != nil {
+				t.Fatal(err)
+			}
+			if saved == nil || wh.ID != saved.ID || wh.Secret == "" || wh.Secret != saved.Secret || wh.Channel != "1234567890" {
+				t.Errorf("unexpected webhook created: %+v, saved: %+v", wh, saved)
+			}
+		})
+	}
+}
+
+func TestListWebhooks(t *testing.T) {
+	s := &store{
+		ListWebhooksFunc: func(string) ([]*goch.Webhook, error) {
+			return []*goch.Webhook{{ID: "1", URL: "https://example.com/hook", Secret: "secret"}}, nil
+		},
+		ListDeadLettersFunc: func(string) ([]*goch.DeadLetter, error) {
+			return []*goch.DeadLetter{{WebhookID: "1", Attempts: 5, Error: "webhook: receiver responded with status 500"}}, nil
+		},
+	}
+	m := mux.NewRouter()
+	chat.New(m, s, &events{}, cfg, middleware)
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/admin/channels/1234567890/webhooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected response code. want: %d, got: %d", http.StatusOK, res.StatusCode)
+	}
+
+	var whs []goch.Webhook
+	if err := json.NewDecoder(res.Body).Decode(&whs); err != nil {
+		t.Fatal(err)
+	}
+	if len(whs) != 1 || whs[0].ID != "1" || whs[0].Secret != "" {
+		t.Errorf("expected webhook to be listed without secret, got %+v", whs)
+	}
+
+	res, err = http.Get(srv.URL + "/admin/channels/1234567890/webhooks/deadletters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected response code. want: %d, got: %d", http.StatusOK, res.StatusCode)
+	}
+
+	var dls []goch.DeadLetter
+	if err := json.NewDecoder(res.Body).Decode(&dls); err != nil {
+		t.Fatal(err)
+	}
+	if len(dls) != 1 || dls[0].WebhookID != "1" || dls[0].Attempts != 5 {
+		t.Errorf("unexpected dead letters %+v", dls)
+	}
+}
+
+func TestDeleteWebhook(t *testing.T) {
+	var deleted string
+	s := &store{
+		DeleteWebhookFunc: func(_, id string) error {
+			deleted = id
+			return nil
+		},
+	}
+	m := mux.NewRouter()
+	chat.New(m, s, &events{}, cfg, middleware)
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+
+	req, err := http.NewRequest("DELETE", srv.URL+"/admin/channels/1234567890/webhooks/WEBHOOK1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("unexpected response code. want: %d, got: %d", http.StatusOK, res.StatusCode)
+	}
+	if deleted != "WEBHOOK1" {
+		t.Errorf("expected webhook WEBHOOK1 to be deleted, got %q", deleted)
+	}
+}
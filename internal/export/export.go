@@ -0,0 +1,175 @@
+// Package export provides functionality for exporting
+// full chat history from the message log
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ribice/goch"
+)
+
+// New creates new exporter instance
+func New(mq MQ, s ChatStore) *Exporter {
+	return &Exporter{
+		mq:    mq,
+		store: s,
+	}
+}
+
+// Exporter represents chat history exporter
+type Exporter struct {
+	mq    MQ
+	store ChatStore
+}
+
+// MQ represents export message queue interface
+type MQ interface {
+	Replay(string, uint64, func(uint64, []byte)) (io.Closer, error)
+	LastSeq(string) (uint64, error)
+}
+
+// ChatStore represents chat store interface
+type ChatStore interface {
+	Get(string) (*goch.Chat, error)
+	GetAccount(string) (*goch.Account, error)
+}
+
+const replayTimeout = 10 * time.Second
+
+var errReplayTimeout = errors.New("export: timed out waiting for message log")
+
+// Export writes chat's members and full message history to w in format f.
+// Messages are streamed from the log as they are written, so history is
+// never held in memory. History is exported up to the last message in the
+// log, including ones not yet ingested. Edits and deletes are folded into
+// messages they reference, as in chat history, so the log is read twice:
+// first to collect them, and then to export messages. Nothing is written
+// to w if chat can not be fetched.
+func (e *Exporter) Export(w io.Writer, id string, f Format) error {
+	newEnc, ok := encoders[f]
+	if !ok {
+		return errInvalidFormat
+	}
+
+	ch, err := e.store.Get(id)
+	if err != nil {
+		return fmt.Errorf("export: unable to fetch chat: %v", err)
+	}
+
+	// Profiles of account-registered members are kept in their accounts
+	for _, u := range ch.Members {
+		if !u.Account {
+			continue
+		}
+		if acc, err := e.store.GetAccount(u.UID); err == nil {
+			u.Profile(acc)
+		}
+	}
+
+	last, err := e.mq.LastSeq("chat." + id)
+	if err != nil {
+		return fmt.Errorf("export: unable to fetch last sequence: %v", err)
+	}
+
+	enc := newEnc(w)
+
+	if err = enc.header(ch); err != nil {
+		return err
+	}
+
+	if last > 0 {
+		if err = e.export(id, last, enc); err != nil {
+			return err
+		}
+	}
+
+	return enc.footer()
+}
+
+// export passes messages from chat log up to sequence last to enc,
+// with edits and deletes applied to messages they reference
+func (e *Exporter) export(id string, last uint64, enc encoder) error {
+	updates := make(map[uint64][]*goch.Message)
+	err := e.replay(id, last, func(msg *goch.Message) error {
+		if folded(msg) {
+			updates[msg.Ref] = append(updates[msg.Ref], msg)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return e.replay(id, last, func(msg *goch.Message) error {
+		if folded(msg) {
+			return nil
+		}
+		for _, ev := range updates[msg.Seq] {
+			msg.Apply(ev)
+		}
+		return enc.message(msg)
+	})
+}
+
+// folded checks whether event msg is folded into message it references
+func folded(msg *goch.Message) bool {
+	switch msg.Type {
+	case goch.EditMessage, goch.DeleteMessage, goch.ExpireMessage:
+		return true
+	}
+	return false
+}
+
+// replay passes messages from chat log up to sequence last to f
+func (e *Exporter) replay(id string, last uint64, f func(*goch.Message) error) error {
+	mc := make(chan *goch.Message)
+	done := make(chan struct{})
+	defer close(done)
+
+	closer, err := e.mq.Replay("chat."+id, 1, func(seq uint64, data []byte) {
+		msg, err := goch.DecodeMsg(data)
+		if err != nil {
+			msg = &goch.Message{
+				FromUID: "export",
+				Text:    "export: message unavailable: decoding error",
+			}
+		}
+
+		msg.Seq = seq
+
+		// Log keeps original content of expired messages, which is left out of exports
+		if msg.IsExpired(time.Now()) {
+			msg.Expire()
+		}
+
+		select {
+		case mc <- msg:
+		case <-done:
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("export: unable to replay chat log: %v", err)
+	}
+
+	defer closer.Close()
+
+	for {
+		select {
+		case msg := <-mc:
+			if msg.Seq > last {
+				return nil
+			}
+			if err := f(msg); err != nil {
+				return err
+			}
+			if msg.Seq == last {
+				return nil
+			}
+		case <-time.After(replayTimeout):
+			return errReplayTimeout
+		}
+	}
+}
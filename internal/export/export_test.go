@@ -0,0 +1,238 @@
+package export_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ribice/goch"
+	"github.com/ribice/goch/internal/export"
+)
+
+var errTest = errors.New("error")
+
+func TestExport(t *testing.T) {
+	msgs := []goch.Message{
+		{Text: "hello *world*", FromUID: "john", FromName: "John"},
+		{Text: "reply", FromUID: "jane", Parent: 1},
+		{Type: goch.ReactMessage, Ref: 1, Text: "+1", FromUID: "jane"},
+		{Type: goch.EditMessage, Ref: 1, Text: "<b>hi</b>", FromUID: "john", Time: 1},
+		{Text: "self-destructing", FromUID: "jane", TTL: 1, ExpiresAt: 1},
+		{Type: goch.ExpireMessage, Ref: 5},
+		{Text: "not ingested yet", FromUID: "john"},
+		{Text: "secret plan", FromUID: "jane"},
+		{Type: goch.DeleteMessage, Ref: 8, FromUID: "jane"},
+	}
+
+	cases := []struct {
+		name    string
+		format  export.Format
+		getErr  bool
+		mqErr   bool
+		last    uint64
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "Invalid format",
+			format:  export.Format("pdf"),
+			wantErr: true,
+		},
+		{
+			name:    "Unexisting chat",
+			format:  export.JSONLines,
+			getErr:  true,
+			wantErr: true,
+		},
+		{
+			name:    "Replay failure",
+			format:  export.JSONLines,
+			last:    4,
+			mqErr:   true,
+			wantErr: true,
+		},
+		{
+			name:   "Empty chat",
+			format: export.Markdown,
+			want:   []string{"# general\n", "- John (john), owner\n", "- Joe (joe), member\n", "## History\n\n"},
+		},
+		{
+			name:   "Markdown",
+			format: export.Markdown,
+			last:   6,
+			want: []string{
+				"**Topic:** Daily \\_standup\\_\n",
+				"**John** [1970-01-01 00:00:00] #1: &lt;b&gt;hi&lt;/b&gt; (edited)\n",
+				"**jane** [1970-01-01 00:00:00] #2: (reply to #1) reply\n",
+				"#5: message expired\n",
+			},
+		},
+		{
+			name:   "Messages not yet ingested",
+			format: export.Markdown,
+			last:   7,
+			want:   []string{"**john** [1970-01-01 00:00:00] #7: not ingested yet\n"},
+		},
+		{
+			name:   "Deleted message",
+			format: export.Markdown,
+			last:   9,
+			want:   []string{"**jane** [1970-01-01 00:00:00] #8: message deleted\n"},
+		},
+		{
+			name:   "HTML",
+			format: export.HTML,
+			last:   4,
+			want: []string{
+				"<li>jane (jane), member</li>\n",
+				"<p id=\"msg-1\"><strong>John</strong> [1970-01-01 00:00:00] #1: &lt;b&gt;hi&lt;/b&gt; (edited)</p>\n",
+				"</html>\n",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := &queue{msgs: msgs[:tc.last], err: tc.mqErr}
+			s := &store{err: tc.getErr}
+
+			var buf bytes.Buffer
+			err := export.New(q, s).Export(&buf, "general", tc.format)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tc.wantErr)
+			}
+
+			if tc.wantErr && tc.getErr && buf.Len() > 0 {
+				t.Errorf("expected nothing to be written, got %q", buf.String())
+			}
+
+			out := buf.String()
+			for _, w := range tc.want {
+				if !strings.Contains(out, w) {
+					t.Errorf("expected export to contain %q, got:\n%s", w, out)
+				}
+			}
+
+			for _, s := range []string{"+1", "self-destructing", "hello", "secret plan", "#4", "#6", "#9"} {
+				if strings.Contains(out, s) {
+					t.Errorf("unexpected %q in export:\n%s", s, out)
+				}
+			}
+		})
+	}
+}
+
+func TestExportJSONLines(t *testing.T) {
+	q := &queue{msgs: []goch.Message{
+		{Text: "first"},
+		{Text: "second"},
+		{Type: goch.EditMessage, Ref: 1, Text: "first edited", Time: 5},
+		{Type: goch.DeleteMessage, Ref: 2, Time: 6},
+	}}
+	s := &store{}
+
+	var buf bytes.Buffer
+	if err := export.New(q, s).Export(&buf, "general", export.JSONLines); err != nil {
+		t.Fatal(err)
+	}
+
+	var types []string
+	var msgs []*goch.Message
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var rec struct {
+			Type    string        `json:"type"`
+			Message *goch.Message `json:"message"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("invalid line %q: %v", sc.Text(), err)
+		}
+		types = append(types, rec.Type)
+		if rec.Message != nil {
+			msgs = append(msgs, rec.Message)
+		}
+	}
+
+	want := "channel,member,member,member,message,message"
+	if got := strings.Join(types, ","); got != want {
+		t.Errorf("expected records %s, got %s", want, got)
+	}
+	if len(msgs) != 2 || msgs[0].Seq != 1 || msgs[1].Seq != 2 {
+		t.Fatalf("expected messages 1 and 2, got %v", msgs)
+	}
+	if msgs[0].Text != "first edited" || msgs[0].Edited != 5 {
+		t.Errorf("expected edit to be folded into message, got %+v", msgs[0])
+	}
+	if !msgs[1].Deleted || msgs[1].Text != "" {
+		t.Errorf("expected deleted message without content, got %+v", msgs[1])
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	f, err := export.ParseFormat("html")
+	if err != nil || f != export.HTML {
+		t.Errorf("expected html format but got %v (%v)", f, err)
+	}
+	if f.ContentType() != "text/html; charset=utf-8" {
+		t.Errorf("unexpected content type %s", f.ContentType())
+	}
+	if _, err := export.ParseFormat("pdf"); err == nil {
+		t.Error("expected error but received nil")
+	}
+}
+
+type store struct {
+	err bool
+}
+
+func (s *store) Get(id string) (*goch.Chat, error) {
+	if s.err {
+		return nil, errTest
+	}
+	return &goch.Chat{
+		Name:  id,
+		Topic: "Daily _standup_",
+		Members: map[string]*goch.User{
+			"john": {UID: "john", DisplayName: "John", Role: goch.OwnerRole},
+			"jane": {UID: "jane", DisplayName: "jane", Secret: "secret"},
+			"joe":  {UID: "joe", Account: true},
+		},
+	}, nil
+}
+
+func (s *store) GetAccount(uid string) (*goch.Account, error) {
+	if uid != "joe" {
+		return nil, errTest
+	}
+	return &goch.Account{UID: uid, DisplayName: "Joe", Email: "joe@example.com"}, nil
+}
+
+type queue struct {
+	msgs []goch.Message
+	err  bool
+}
+
+func (q *queue) LastSeq(subj string) (uint64, error) {
+	return uint64(len(q.msgs)), nil
+}
+
+func (q *queue) Replay(subj string, start uint64, f func(uint64, []byte)) (io.Closer, error) {
+	if q.err {
+		return nil, errTest
+	}
+	go func() {
+		for i := start - 1; i < uint64(len(q.msgs)); i++ {
+			bts, _ := q.msgs[i].Encode()
+			f(i+1, bts)
+		}
+	}()
+	return &cl{}, nil
+}
+
+type cl struct{}
+
+func (c *cl) Close() error { return nil }
@@ -0,0 +1,274 @@
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ribice/goch"
+)
+
+// Format represents export output format
+type Format string
+
+// Format constants
+const (
+	JSONLines Format = "jsonl"
+	Markdown  Format = "md"
+	HTML      Format = "html"
+)
+
+var errInvalidFormat = errors.New("export: format must be one of jsonl, md or html")
+
+var encoders = map[Format]func(io.Writer) encoder{
+	JSONLines: newJSONLEncoder,
+	Markdown:  newMarkdownEncoder,
+	HTML:      newHTMLEncoder,
+}
+
+var contentTypes = map[Format]string{
+	JSONLines: "application/x-ndjson",
+	Markdown:  "text/markdown; charset=utf-8",
+	HTML:      "text/html; charset=utf-8",
+}
+
+// ParseFormat returns format for provided name
+func ParseFormat(name string) (Format, error) {
+	if _, ok := encoders[Format(name)]; !ok {
+		return "", errInvalidFormat
+	}
+	return Format(name), nil
+}
+
+// ContentType returns MIME type of exported document
+func (f Format) ContentType() string {
+	return contentTypes[f]
+}
+
+// encoder writes exported chat in a single format
+type encoder interface {
+	header(*goch.Chat) error
+	message(*goch.Message) error
+	footer() error
+}
+
+// members returns chat members ordered by uid
+func members(ch *goch.Chat) []*goch.User {
+	users := ch.ListMembers()
+	sort.Slice(users, func(i, j int) bool { return users[i].UID < users[j].UID })
+	return users
+}
+
+// record represents a single line of JSON Lines export
+type record struct {
+	Type    string        `json:"type"`
+	Channel *channel      `json:"channel,omitempty"`
+	Member  *goch.User    `json:"member,omitempty"`
+	Message *goch.Message `json:"message,omitempty"`
+}
+
+type channel struct {
+	Name        string `json:"name"`
+	Topic       string `json:"topic,omitempty"`
+	Description string `json:"description,omitempty"`
+	CreatedBy   string `json:"created_by,omitempty"`
+	CreatedAt   int64  `json:"created_at,omitempty"`
+	Archived    bool   `json:"archived,omitempty"`
+}
+
+type jsonlEncoder struct {
+	enc *json.Encoder
+}
+
+func newJSONLEncoder(w io.Writer) encoder {
+	return &jsonlEncoder{enc: json.NewEncoder(w)}
+}
+
+func (e *jsonlEncoder) header(ch *goch.Chat) error {
+	err := e.enc.Encode(record{Type: "channel", Channel: &channel{
+		Name:        ch.Name,
+		Topic:       ch.Topic,
+		Description: ch.Description,
+		CreatedBy:   ch.CreatedBy,
+		CreatedAt:   ch.CreatedAt,
+		Archived:    ch.Archived,
+	}})
+	if err != nil {
+		return err
+	}
+	for _, u := range members(ch) {
+		if err = e.enc.Encode(record{Type: "member", Member: u}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *jsonlEncoder) message(m *goch.Message) error {
+	return e.enc.Encode(record{Type: "message", Message: m})
+}
+
+func (e *jsonlEncoder) footer() error { return nil }
+
+// transcript holds formatting shared by human readable encoders
+type transcript struct {
+	w      io.Writer
+	escape func(string) string
+}
+
+// printf writes formatted text to transcript, escaping string args
+func (t *transcript) printf(format string, args ...interface{}) error {
+	for i, a := range args {
+		if s, ok := a.(string); ok {
+			args[i] = t.escape(s)
+		}
+	}
+	_, err := fmt.Fprintf(t.w, format, args...)
+	return err
+}
+
+// describe returns human readable description of message m,
+// escaping message text with esc
+func describe(m *goch.Message, esc func(string) string) (string, bool) {
+	switch m.Type {
+	case goch.TextMessage:
+		text := esc(m.Text)
+		switch {
+		case m.Expired:
+			text = "message expired"
+		case m.Deleted:
+			text = "message deleted"
+		case m.Edited != 0:
+			text += " (edited)"
+		}
+		if m.IsReply() {
+			return fmt.Sprintf("(reply to #%d) %s", m.Parent, text), true
+		}
+		return text, true
+	case goch.PinMessage:
+		return fmt.Sprintf("pinned #%d", m.Ref), true
+	case goch.UnpinMessage:
+		return fmt.Sprintf("unpinned #%d", m.Ref), true
+	}
+	// Reactions are left out of transcripts, while edits
+	// and deletes are folded into messages they reference
+	return "", false
+}
+
+func author(m *goch.Message) string {
+	if m.System {
+		return "goch"
+	}
+	if m.FromName != "" {
+		return m.FromName
+	}
+	return m.FromUID
+}
+
+func timestamp(t int64) string {
+	return time.Unix(0, t).UTC().Format("2006-01-02 15:04:05")
+}
+
+type markdownEncoder struct {
+	transcript
+}
+
+func newMarkdownEncoder(w io.Writer) encoder {
+	return &markdownEncoder{transcript{w: w, escape: escapeMarkdown}}
+}
+
+var mdEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "#", `\#`,
+	"[", `\[`, "]", `\]`, "<", "&lt;", ">", "&gt;", "\n", "  \n",
+)
+
+func escapeMarkdown(s string) string {
+	return mdEscaper.Replace(s)
+}
+
+func (e *markdownEncoder) header(ch *goch.Chat) error {
+	if err := e.printf("# %s\n\n", ch.Name); err != nil {
+		return err
+	}
+	if ch.Topic != "" {
+		if err := e.printf("**Topic:** %s\n\n", ch.Topic); err != nil {
+			return err
+		}
+	}
+	if ch.Description != "" {
+		if err := e.printf("%s\n\n", ch.Description); err != nil {
+			return err
+		}
+	}
+	if err := e.printf("## Members\n\n"); err != nil {
+		return err
+	}
+	for _, u := range members(ch) {
+		if err := e.printf("- %s (%s), %s\n", u.DisplayName, u.UID, u.Role.String()); err != nil {
+			return err
+		}
+	}
+	return e.printf("\n## History\n\n")
+}
+
+func (e *markdownEncoder) message(m *goch.Message) error {
+	text, ok := describe(m, e.escape)
+	if !ok {
+		return nil
+	}
+	_, err := fmt.Fprintf(e.w, "**%s** [%s] #%d: %s\n\n", e.escape(author(m)), timestamp(m.Time), m.Seq, text)
+	return err
+}
+
+func (e *markdownEncoder) footer() error { return nil }
+
+type htmlEncoder struct {
+	transcript
+}
+
+func newHTMLEncoder(w io.Writer) encoder {
+	return &htmlEncoder{transcript{w: w, escape: html.EscapeString}}
+}
+
+func (e *htmlEncoder) header(ch *goch.Chat) error {
+	if err := e.printf("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n</head>\n<body>\n<h1>%s</h1>\n", ch.Name, ch.Name); err != nil {
+		return err
+	}
+	if ch.Topic != "" {
+		if err := e.printf("<p><strong>Topic:</strong> %s</p>\n", ch.Topic); err != nil {
+			return err
+		}
+	}
+	if ch.Description != "" {
+		if err := e.printf("<p>%s</p>\n", ch.Description); err != nil {
+			return err
+		}
+	}
+	if err := e.printf("<h2>Members</h2>\n<ul>\n"); err != nil {
+		return err
+	}
+	for _, u := range members(ch) {
+		if err := e.printf("<li>%s (%s), %s</li>\n", u.DisplayName, u.UID, u.Role.String()); err != nil {
+			return err
+		}
+	}
+	return e.printf("</ul>\n<h2>History</h2>\n")
+}
+
+func (e *htmlEncoder) message(m *goch.Message) error {
+	text, ok := describe(m, e.escape)
+	if !ok {
+		return nil
+	}
+	_, err := fmt.Fprintf(e.w, "<p id=\"msg-%d\"><strong>%s</strong> [%s] #%d: %s</p>\n", m.Seq, e.escape(author(m)), timestamp(m.Time), m.Seq, text)
+	return err
+}
+
+func (e *htmlEncoder) footer() error {
+	return e.printf("</body>\n</html>\n")
+}
@@ -5,16 +5,21 @@ package ingest
 import (
 	"fmt"
 	"io"
+	"sync"
 	"time"
 
 	"github.com/ribice/goch"
 )
 
-// New creates new ingest instance
-func New(mq MQ, s ChatStore) *Ingest {
+// New creates new ingest instance. Content of attachments
+// is kept after their messages are deleted if bs is nil.
+func New(mq MQ, s ChatStore, idx Indexer, bs BlobStore) *Ingest {
 	return &Ingest{
 		mq:    mq,
 		store: s,
+		idx:   idx,
+		blobs: bs,
+		subs:  make(map[string]io.Closer),
 	}
 }
 
@@ -22,41 +27,299 @@ func New(mq MQ, s ChatStore) *Ingest {
 type Ingest struct {
 	mq    MQ
 	store ChatStore
+	idx   Indexer
+	blobs BlobStore
+
+	mu   sync.Mutex
+	subs map[string]io.Closer
 }
 
 // MQ represents ingest message queue interface
 type MQ interface {
-	SubscribeQueue(string, func(uint64, []byte)) (io.Closer, error)
+	SubscribeGroup(string, string, time.Duration, func(uint64, []byte)) (io.Closer, error)
+	Send(string, []byte) error
 }
 
 // ChatStore represents chat store interface
 type ChatStore interface {
 	AppendMessage(string, *goch.Message) error
+	UpdateMessage(string, *goch.Message) error
+	AppendReply(string, *goch.Message) error
+	React(string, *goch.Message) error
+	Pin(string, *goch.Message) error
+	AddMentions(string, *goch.Message) error
+	AddExpiring(string, *goch.Message) error
+	ClaimExpired(time.Time, time.Duration, int64) (map[string][]*goch.Message, error)
+	CompleteExpired(string, *goch.Message) error
+	ReleaseAttachments(string, uint64) ([]string, error)
+	ClaimUnsentAttachments(time.Time, time.Duration, int64) (map[string][]string, error)
+	CompleteUnsentAttachment(string, string) error
+	AddIngestChannel(string) error
+	ListIngestChannels() ([]string, error)
+}
+
+// Indexer represents message search index interface
+type Indexer interface {
+	Index(string, *goch.Message) error
+	Update(string, *goch.Message) error
+}
+
+// BlobStore represents attachment content store interface
+type BlobStore interface {
+	Delete(string) error
 }
 
-// Run subscribes to ingest queue group and updates chat read model
-func (i *Ingest) Run(id string) (func(), error) {
-	closer, err := i.mq.SubscribeQueue(
-		"chat."+id,
-		func(seq uint64, data []byte) {
-			msg, err := goch.DecodeMsg(data)
-			if err != nil {
-				msg = &goch.Message{
-					FromUID: "ingest",
-					Text:    "ingest: message unavailable: decoding error",
-					Time:    time.Now().UnixNano(),
+const (
+	queueGroup      = "ingest"
+	ackWait         = 30 * time.Second
+	refreshInterval = 30 * time.Second
+)
+
+// Run subscribes to ingest queue group of every chat messages were sent to,
+// regardless of whether any of its members is connected. Chats first
+// written to on other instances are picked up every refreshInterval.
+// Returns func stopping the ingest.
+func (i *Ingest) Run() func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		t := time.NewTicker(refreshInterval)
+		defer t.Stop()
+
+		for {
+			i.refresh()
+			select {
+			case <-t.C:
+			case <-stop:
+				i.mu.Lock()
+				for _, sub := range i.subs {
+					sub.Close()
 				}
+				i.mu.Unlock()
+				return
 			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// refresh subscribes to chats recorded by any instance
+func (i *Ingest) refresh() {
+	ids, err := i.store.ListIngestChannels()
+	if err != nil {
+		return
+	}
+	for _, id := range ids {
+		i.subscribe(id)
+	}
+}
+
+// Subscribe records chat id for ingestion and subscribes to it, unless
+// this instance already did. Since ingest queue group is durable, messages
+// sent once chat was subscribed to are ingested even while no instance runs.
+func (i *Ingest) Subscribe(id string) error {
+	i.mu.Lock()
+	_, ok := i.subs[id]
+	i.mu.Unlock()
+	if ok {
+		return nil
+	}
+
+	if err := i.store.AddIngestChannel(id); err != nil {
+		return fmt.Errorf("ingest: couldn't record channel: %v", err)
+	}
 
-			msg.Seq = seq
-			// TODO: Handle error via ACK
-			i.store.AppendMessage(id, msg)
-		},
-	)
+	return i.subscribe(id)
+}
+
+func (i *Ingest) subscribe(id string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if _, ok := i.subs[id]; ok {
+		return nil
+	}
 
+	sub, err := i.mq.SubscribeGroup("chat."+id, queueGroup, ackWait, func(seq uint64, data []byte) {
+		i.ingest(id, seq, data)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("ingest: couldn't subscribe: %v", err)
+		return fmt.Errorf("ingest: couldn't subscribe: %v", err)
+	}
+
+	i.subs[id] = sub
+	return nil
+}
+
+// ingest updates chat read model with message received at seq
+func (i *Ingest) ingest(id string, seq uint64, data []byte) {
+	msg, err := goch.DecodeMsg(data)
+	if err != nil {
+		msg = &goch.Message{
+			FromUID: "ingest",
+			Text:    "ingest: message unavailable: decoding error",
+			Time:    time.Now().UnixNano(),
+		}
+	}
+
+	msg.Seq = seq
+	// TODO: Handle error via ACK
+	switch {
+	case msg.IsReaction():
+		i.store.React(id, msg)
+	case msg.IsPin():
+		i.store.Pin(id, msg)
+	case msg.IsEvent():
+		i.store.UpdateMessage(id, msg)
+		i.idx.Update(id, msg)
+		if msg.Type == goch.DeleteMessage || msg.Type == goch.ExpireMessage {
+			i.release(id, msg.Ref)
+		}
+	case msg.IsReply():
+		i.store.AppendReply(id, msg)
+		i.idx.Index(id, msg)
+	default:
+		i.store.AppendMessage(id, msg)
+		i.idx.Index(id, msg)
+	}
+
+	if msg.ExpiresAt != 0 && !msg.IsEvent() {
+		i.store.AddExpiring(id, msg)
+	}
+
+	// Edits carry only mentions added by them
+	if len(msg.Mentions) > 0 && (!msg.IsEvent() || msg.Type == goch.EditMessage) {
+		i.store.AddMentions(id, msg)
+	}
+}
+
+const (
+	expiryInterval = time.Second
+	expiryBatch    = 100
+	// Claimed messages whose tombstone was not stored within
+	// expiryLease, e.g. due to a crash, are claimed again
+	expiryLease = time.Minute
+)
+
+// RunExpiry periodically replaces messages whose TTL has passed with
+// tombstones, and publishes expire events for them. Uploads which were
+// not sent with any message are deleted as well. Returns func stopping
+// the expiry.
+func (i *Ingest) RunExpiry() func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		t := time.NewTicker(expiryInterval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				now := time.Now()
+				i.Expire(now)
+				i.DeleteUnsent(now)
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// Expire replaces messages expired at t with tombstones in chat store and
+// search index, and publishes expire events notifying connected clients
+// and webhooks. Tombstones are stored directly rather than through ingest,
+// so messages expire even when no instance is subscribed to their chat.
+// Messages whose tombstone could not be stored are expired again once
+// their claim's lease passes.
+func (i *Ingest) Expire(t time.Time) {
+	for {
+		evs, err := i.store.ClaimExpired(t, expiryLease, expiryBatch)
+		if err != nil {
+			return
+		}
+
+		var n int
+		for id, chatEvs := range evs {
+			for _, ev := range chatEvs {
+				n++
+				ev.Time = t.UnixNano()
+				if err = i.store.UpdateMessage(id, ev); err != nil {
+					continue
+				}
+				i.store.CompleteExpired(id, ev)
+				i.idx.Update(id, ev)
+				i.release(id, ev.Ref)
+				// Published event is ingested as well, leaving
+				// already expired message unchanged
+				i.send(id, ev)
+			}
+		}
+
+		if n < expiryBatch {
+			return
+		}
 	}
+}
+
+// DeleteUnsent deletes content of attachments uploaded more than
+// goch.UploadTTL before t which were not sent with any message. Attachments
+// whose content could not be deleted are deleted again once their claim's
+// lease passes.
+func (i *Ingest) DeleteUnsent(t time.Time) {
+	for {
+		atts, err := i.store.ClaimUnsentAttachments(t, expiryLease, expiryBatch)
+		if err != nil {
+			return
+		}
 
-	return func() { closer.Close() }, nil
+		var n int
+		for id, ids := range atts {
+			for _, att := range ids {
+				n++
+				if i.blobs != nil && i.blobs.Delete(goch.BlobKey(id, att)) != nil {
+					continue
+				}
+				i.store.CompleteUnsentAttachment(id, att)
+			}
+		}
+
+		if n < expiryBatch {
+			return
+		}
+	}
+}
+
+// release drops references of deleted or expired message seq to its
+// attachments, deleting content of ones no longer referenced by any message
+func (i *Ingest) release(id string, seq uint64) {
+	atts, err := i.store.ReleaseAttachments(id, seq)
+	if err != nil || i.blobs == nil {
+		return
+	}
+	for _, att := range atts {
+		i.blobs.Delete(goch.BlobKey(id, att))
+	}
+}
+
+func (i *Ingest) send(id string, ev *goch.Message) error {
+	data, err := ev.Encode()
+	if err != nil {
+		return err
+	}
+	return i.mq.Send("chat."+id, data)
 }
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"reflect"
 	"testing"
 	"time"
 
@@ -76,9 +77,11 @@ func TestChatIngest(t *testing.T) {
 			ig := ingest.New(
 				&q,
 				&s,
+				&index{},
+				nil,
 			)
 
-			close, err := ig.Run(tc.chat)
+			err := ig.Subscribe(tc.chat)
 			if (err != nil) != tc.wantErr {
 				t.Errorf("error = %v, wantErr %v", err, tc.wantErr)
 				return
@@ -88,8 +91,6 @@ func TestChatIngest(t *testing.T) {
 				return
 			}
 
-			defer close()
-
 			<-q.purged
 
 			time.Sleep(100 * time.Millisecond)
@@ -107,6 +108,32 @@ func TestChatIngest(t *testing.T) {
 	}
 }
 
+func TestRun(t *testing.T) {
+	q := queue{subscribed: make(chan string, 2)}
+	s := store{chats: []string{"general"}}
+
+	ig := ingest.New(&q, &s, &index{}, nil)
+	stop := ig.Run()
+	<-q.subscribed
+
+	if err := ig.Subscribe("general"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ig.Subscribe("random"); err != nil {
+		t.Fatal(err)
+	}
+
+	stop()
+
+	if !reflect.DeepEqual(q.subs, []string{"chat.general", "chat.random"}) {
+		t.Errorf("expected each chat to be subscribed to once, got %v", q.subs)
+	}
+
+	if !reflect.DeepEqual(s.chats, []string{"general", "random"}) {
+		t.Errorf("expected new chat to be recorded, got %v", s.chats)
+	}
+}
+
 func TestChatIngestDecodingErrs(t *testing.T) {
 	cases := []struct {
 		name string
@@ -147,15 +174,14 @@ func TestChatIngestDecodingErrs(t *testing.T) {
 			ig := ingest.New(
 				&q,
 				&s,
+				&index{},
+				nil,
 			)
 
-			close, err := ig.Run(tc.chat)
-			if err != nil {
+			if err := ig.Subscribe(tc.chat); err != nil {
 				t.Fatal(err)
 			}
 
-			defer close()
-
 			<-q.purged
 
 			time.Sleep(100 * time.Millisecond)
@@ -173,9 +199,364 @@ func TestChatIngestDecodingErrs(t *testing.T) {
 	}
 }
 
+func TestChatIngestEvents(t *testing.T) {
+	msgs := []goch.Message{
+		{Text: "first"},
+		{Text: "second"},
+		{Type: goch.EditMessage, Ref: 0, Text: "first edited @jane", Mentions: []string{"jane"}, Time: 5},
+		{Type: goch.DeleteMessage, Ref: 1, Time: 6},
+		{Text: "reply @john", Parent: 1, Mentions: []string{"john"}},
+		{Type: goch.ReactMessage, Ref: 0, Text: "+1"},
+		{Type: goch.PinMessage, Ref: 0},
+	}
+
+	q := queue{}
+	s := store{}
+
+	for i, m := range msgs {
+		bts, err := m.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		q.data = append(
+			q.data,
+			struct {
+				seq uint64
+				msg []byte
+			}{
+				seq: uint64(i),
+				msg: bts,
+			},
+		)
+	}
+
+	idx := index{}
+
+	if err := ingest.New(&q, &s, &idx, nil).Subscribe("general"); err != nil {
+		t.Fatal(err)
+	}
+
+	<-q.purged
+
+	time.Sleep(100 * time.Millisecond)
+
+	history := s.data["general"]
+	if len(history) != 2 {
+		t.Fatalf("expected events not to be appended to history, got %d messages", len(history))
+	}
+
+	if history[0].Text != "first edited @jane" || history[0].Edited != 5 {
+		t.Errorf("expected first message to be edited, got %v", history[0])
+	}
+
+	if !history[1].Deleted || history[1].Text != "" {
+		t.Errorf("expected second message to be deleted, got %v", history[1])
+	}
+
+	if len(s.replies[1]) != 1 || s.replies[1][0].Text != "reply @john" {
+		t.Errorf("expected reply to be appended to thread, got %v", s.replies)
+	}
+
+	if len(s.reacts) != 1 || s.reacts[0].Text != "+1" {
+		t.Errorf("expected reaction to be aggregated, got %v", s.reacts)
+	}
+
+	if len(idx.docs) != 3 || idx.docs[2].Text != "reply @john" || len(idx.events) != 2 {
+		t.Errorf("expected messages and events to be indexed, got %v and %v", idx.docs, idx.events)
+	}
+
+	if len(s.pins) != 1 || s.pins[0].Ref != 0 || s.pins[0].Type != goch.PinMessage {
+		t.Errorf("expected message to be pinned, got %v", s.pins)
+	}
+
+	if !reflect.DeepEqual(s.mentions, map[string][]uint64{"john": {4}, "jane": {2}}) {
+		t.Errorf("expected mentions of reply and edit to be recorded, got %v", s.mentions)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	now := time.Now()
+	msgs := []goch.Message{
+		{Text: "kept"},
+		{Text: "expiring", ExpiresAt: now.Add(time.Minute).UnixNano()},
+		{Text: "expiring reply", Parent: 1, ExpiresAt: now.Add(time.Hour).UnixNano()},
+		{Type: goch.EditMessage, Ref: 1, Text: "edited", ExpiresAt: now.Add(time.Minute).UnixNano()},
+	}
+
+	q := queue{}
+	s := store{}
+
+	for i, m := range msgs {
+		bts, err := m.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		q.data = append(
+			q.data,
+			struct {
+				seq uint64
+				msg []byte
+			}{
+				seq: uint64(i),
+				msg: bts,
+			},
+		)
+	}
+
+	ig := ingest.New(&q, &s, &index{}, nil)
+	if err := ig.Subscribe("general"); err != nil {
+		t.Fatal(err)
+	}
+
+	<-q.purged
+
+	time.Sleep(100 * time.Millisecond)
+
+	if len(s.expiring) != 2 {
+		t.Fatalf("expected only expiring messages to be recorded, got %v", s.expiring)
+	}
+
+	ig.Expire(now)
+	if len(q.sent) != 0 {
+		t.Errorf("expected no messages to expire yet, got %v", q.sent)
+	}
+
+	ig.Expire(now.Add(2 * time.Minute))
+	if len(q.sent) != 1 || q.sent[0].Type != goch.ExpireMessage || q.sent[0].Ref != 1 || q.sent[0].Time == 0 {
+		t.Errorf("expected expire event for message 1, got %v", q.sent)
+	}
+	if m := s.data["general"][1]; !m.Expired || m.Text != "" {
+		t.Errorf("expected message 1 to be replaced with tombstone, got %v", m)
+	}
+
+	s.err = true
+	ig.Expire(now.Add(2 * time.Hour))
+	if len(s.expiring) != 1 || s.expiring[0].Seq != 2 || s.expiring[0].Parent != 1 {
+		t.Fatalf("expected reply to stay claimed after failing to store tombstone, got %v", s.expiring)
+	}
+
+	s.err = false
+	ig.Expire(now.Add(2*time.Hour + time.Second))
+	if len(q.sent) != 1 {
+		t.Errorf("expected reply not to be claimed again before its lease passes, got %v", q.sent)
+	}
+
+	ig.Expire(now.Add(3 * time.Hour))
+	if len(q.sent) != 2 || q.sent[1].Ref != 2 || q.sent[1].Parent != 1 {
+		t.Errorf("expected expire event for reply once its lease passed, got %v", q.sent)
+	}
+	if len(s.expiring) != 0 {
+		t.Errorf("expected reply to be completed after storing tombstone, got %v", s.expiring)
+	}
+}
+
+func TestExpireWithoutSubscriber(t *testing.T) {
+	now := time.Now()
+	s := store{
+		data: map[string][]*goch.Message{
+			"general": {{Seq: 1, Text: "expiring"}},
+		},
+		replies: map[uint64][]*goch.Message{
+			1: {{Seq: 2, Parent: 1, Text: "expiring reply"}},
+		},
+		expiring: []*goch.Message{
+			{Seq: 1, ExpiresAt: now.UnixNano()},
+			{Seq: 2, Parent: 1, ExpiresAt: now.UnixNano()},
+		},
+		atts: map[uint64][]string{2: {"att"}},
+	}
+	q := queue{err: true}
+	idx := index{}
+	bs := blobs{}
+
+	ingest.New(&q, &s, &idx, &bs).Expire(now.Add(time.Second))
+
+	if m := s.data["general"][0]; !m.Expired || m.Text != "" {
+		t.Errorf("expected message to be replaced with tombstone, got %v", m)
+	}
+	if m := s.replies[1][0]; !m.Expired || m.Text != "" {
+		t.Errorf("expected reply to be replaced with tombstone, got %v", m)
+	}
+	if len(s.expiring) != 0 {
+		t.Errorf("expected expired messages not to be expired again, got %v", s.expiring)
+	}
+	if len(idx.events) != 2 {
+		t.Errorf("expected expired messages to be removed from index, got %v", idx.events)
+	}
+	if !reflect.DeepEqual(bs.deleted, []string{"general.att"}) {
+		t.Errorf("expected attachment of expired reply to be deleted, got %v", bs.deleted)
+	}
+}
+
+func TestDeleteAttachments(t *testing.T) {
+	msgs := []goch.Message{
+		{Text: "kept", Attachments: []goch.Attachment{{ID: "kept"}}},
+		{Text: "deleted", Attachments: []goch.Attachment{{ID: "deleted"}}},
+		{Type: goch.EditMessage, Ref: 0, Text: "kept edited"},
+		{Type: goch.DeleteMessage, Ref: 1},
+	}
+
+	q := queue{}
+	s := store{atts: map[uint64][]string{0: {"kept"}, 1: {"deleted"}}}
+	bs := blobs{}
+
+	for i, m := range msgs {
+		bts, err := m.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		q.data = append(
+			q.data,
+			struct {
+				seq uint64
+				msg []byte
+			}{
+				seq: uint64(i),
+				msg: bts,
+			},
+		)
+	}
+
+	if err := ingest.New(&q, &s, &index{}, &bs).Subscribe("general"); err != nil {
+		t.Fatal(err)
+	}
+
+	<-q.purged
+
+	if !reflect.DeepEqual(bs.deleted, []string{"general.deleted"}) {
+		t.Errorf("expected only attachment of deleted message to be deleted, got %v", bs.deleted)
+	}
+}
+
+func TestDeleteUnsent(t *testing.T) {
+	now := time.Now()
+	s := store{pending: map[string]time.Time{
+		"old": now,
+		"new": now.Add(goch.UploadTTL),
+	}}
+	bs := blobs{err: true}
+	ig := ingest.New(&queue{}, &s, &index{}, &bs)
+
+	ig.DeleteUnsent(now.Add(time.Second))
+	if _, ok := s.pending["old"]; !ok {
+		t.Fatalf("expected upload to stay claimed after failing to delete its content, got %v", s.pending)
+	}
+
+	bs.err = false
+	ig.DeleteUnsent(now.Add(2 * time.Second))
+	if len(bs.deleted) != 0 {
+		t.Errorf("expected upload not to be claimed again before its lease passes, got %v", bs.deleted)
+	}
+
+	ig.DeleteUnsent(now.Add(time.Hour))
+	if !reflect.DeepEqual(bs.deleted, []string{"general.old"}) {
+		t.Errorf("expected content of unsent upload to be deleted, got %v", bs.deleted)
+	}
+	if _, ok := s.pending["new"]; !ok || len(s.pending) != 1 {
+		t.Errorf("expected only upload within its TTL to stay pending, got %v", s.pending)
+	}
+}
+
 type store struct {
-	data map[string][]*goch.Message
-	err  bool
+	chats    []string
+	data     map[string][]*goch.Message
+	replies  map[uint64][]*goch.Message
+	reacts   []*goch.Message
+	pins     []*goch.Message
+	mentions map[string][]uint64
+	expiring []*goch.Message
+	atts     map[uint64][]string
+	pending  map[string]time.Time // Deadlines of unsent uploads by id
+	err      bool
+}
+
+func (s *store) ReleaseAttachments(id string, seq uint64) ([]string, error) {
+	atts := s.atts[seq]
+	delete(s.atts, seq)
+	return atts, nil
+}
+
+func (s *store) ClaimUnsentAttachments(t time.Time, lease time.Duration, n int64) (map[string][]string, error) {
+	atts := make(map[string][]string)
+	for id, deadline := range s.pending {
+		if deadline.After(t) {
+			continue
+		}
+		s.pending[id] = t.Add(lease)
+		atts["general"] = append(atts["general"], id)
+	}
+	return atts, nil
+}
+
+func (s *store) CompleteUnsentAttachment(id, attID string) error {
+	delete(s.pending, attID)
+	return nil
+}
+
+func (s *store) AddIngestChannel(id string) error {
+	s.chats = append(s.chats, id)
+	return nil
+}
+
+func (s *store) ListIngestChannels() ([]string, error) {
+	return s.chats, nil
+}
+
+func (s *store) AddExpiring(id string, msg *goch.Message) error {
+	m := *msg
+	s.expiring = append(s.expiring, &m)
+	return nil
+}
+
+func (s *store) ClaimExpired(t time.Time, lease time.Duration, n int64) (map[string][]*goch.Message, error) {
+	evs := make(map[string][]*goch.Message)
+	for _, m := range s.expiring {
+		if m.ExpiresAt > t.UnixNano() {
+			continue
+		}
+		m.ExpiresAt = t.Add(lease).UnixNano()
+		evs["general"] = append(evs["general"], &goch.Message{Type: goch.ExpireMessage, Ref: m.Seq, Parent: m.Parent})
+	}
+	return evs, nil
+}
+
+func (s *store) CompleteExpired(id string, ev *goch.Message) error {
+	var left []*goch.Message
+	for _, m := range s.expiring {
+		if m.Seq != ev.Ref || m.Parent != ev.Parent {
+			left = append(left, m)
+		}
+	}
+	s.expiring = left
+	return nil
+}
+
+func (s *store) AddMentions(id string, msg *goch.Message) error {
+	if s.mentions == nil {
+		s.mentions = make(map[string][]uint64)
+	}
+	for _, uid := range msg.Mentions {
+		s.mentions[uid] = append(s.mentions[uid], msg.Seq)
+	}
+	return nil
+}
+
+func (s *store) React(id string, msg *goch.Message) error {
+	s.reacts = append(s.reacts, msg)
+	return nil
+}
+
+func (s *store) Pin(id string, msg *goch.Message) error {
+	s.pins = append(s.pins, msg)
+	return nil
+}
+
+func (s *store) AppendReply(id string, msg *goch.Message) error {
+	if s.replies == nil {
+		s.replies = make(map[uint64][]*goch.Message)
+	}
+	s.replies[msg.Parent] = append(s.replies[msg.Parent], msg)
+	return nil
 }
 
 func (s *store) AppendMessage(id string, msg *goch.Message) error {
@@ -189,19 +570,83 @@ func (s *store) AppendMessage(id string, msg *goch.Message) error {
 	return nil
 }
 
+func (s *store) UpdateMessage(id string, ev *goch.Message) error {
+	if s.err {
+		return errTest
+	}
+	msgs := s.data[id]
+	if ev.IsReply() {
+		msgs = s.replies[ev.Parent]
+	}
+	for _, m := range msgs {
+		if m.Apply(ev) {
+			return nil
+		}
+	}
+	return errTest
+}
+
+type index struct {
+	docs   []*goch.Message
+	events []*goch.Message
+}
+
+func (i *index) Index(id string, msg *goch.Message) error {
+	i.docs = append(i.docs, msg)
+	return nil
+}
+
+func (i *index) Update(id string, ev *goch.Message) error {
+	i.events = append(i.events, ev)
+	return nil
+}
+
+type blobs struct {
+	deleted []string
+	err     bool
+}
+
+func (b *blobs) Delete(key string) error {
+	if b.err {
+		return errors.New("could not delete")
+	}
+	b.deleted = append(b.deleted, key)
+	return nil
+}
+
 type queue struct {
 	data []struct {
 		seq uint64
 		msg []byte
 	}
-	purged chan struct{}
-	err    bool
+	purged     chan struct{}
+	subscribed chan string
+	subs       []string
+	sent       []*goch.Message
+	err        bool
+}
+
+func (q *queue) Send(subj string, data []byte) error {
+	if q.err {
+		return errTest
+	}
+	msg, err := goch.DecodeMsg(data)
+	if err != nil {
+		return err
+	}
+	q.sent = append(q.sent, msg)
+	return nil
 }
 
-func (q *queue) SubscribeQueue(id string, f func(uint64, []byte)) (io.Closer, error) {
+func (q *queue) SubscribeGroup(subj, group string, ackWait time.Duration, f func(uint64, []byte)) (io.Closer, error) {
 	if q.err {
 		return nil, errTest
 	}
+	q.subs = append(q.subs, subj)
+	if q.subscribed != nil {
+		q.subscribed <- subj
+		return &cl{}, nil
+	}
 	q.purged = make(chan struct{})
 	go func() {
 		for _, m := range q.data {
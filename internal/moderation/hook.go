@@ -0,0 +1,102 @@
+package moderation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ribice/goch"
+	"github.com/ribice/goch/pkg/config"
+)
+
+var errHookUnavailable = errors.New("message could not be moderated, try again later")
+
+func newHook(rc config.ModerationRule) (*Hook, error) {
+	if rc.URL == "" {
+		return nil, errors.New("hook rule requires url")
+	}
+
+	timeout := defaultHookTimeout
+	if rc.Timeout > 0 {
+		timeout = time.Duration(rc.Timeout) * time.Millisecond
+	}
+
+	return &Hook{
+		url:      rc.URL,
+		failOpen: rc.FailOpen,
+		cl:       &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Hook represents moderation rule delegating
+// decisions to an external HTTP service
+type Hook struct {
+	url      string
+	failOpen bool
+	cl       *http.Client
+}
+
+type hookReq struct {
+	Channel string        `json:"channel"`
+	Message *goch.Message `json:"message"`
+}
+
+type hookResp struct {
+	Action string `json:"action"` // allow, reject, redact or flag
+	Reason string `json:"reason"`
+	Text   string `json:"text"` // Replacement text of redacted message
+}
+
+// Check implements Rule. Message is POSTed to hook's url, which responds
+// with the action to take. Unless hook fails open, messages are rejected
+// while the hook is unavailable.
+func (h *Hook) Check(id string, m *goch.Message) (Verdict, error) {
+	v, err := h.check(id, m)
+	if err != nil {
+		if h.failOpen {
+			return Verdict{}, nil
+		}
+		return Verdict{}, errHookUnavailable
+	}
+	return v, nil
+}
+
+func (h *Hook) check(id string, m *goch.Message) (Verdict, error) {
+	body, err := json.Marshal(hookReq{Channel: id, Message: m})
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	res, err := h.cl.Post(h.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return Verdict{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return Verdict{}, fmt.Errorf("moderation: hook responded with status %d", res.StatusCode)
+	}
+
+	var resp hookResp
+	if err = json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return Verdict{}, err
+	}
+
+	action, ok := actions[resp.Action]
+	if !ok {
+		return Verdict{}, fmt.Errorf("moderation: hook responded with unknown action %s", resp.Action)
+	}
+
+	if action == Redact && resp.Text == "" {
+		return Verdict{}, errors.New("moderation: hook redacted message without replacement text")
+	}
+
+	if resp.Reason == "" {
+		resp.Reason = "message was moderated"
+	}
+
+	return Verdict{Action: action, Reason: resp.Reason, Text: resp.Text}, nil
+}
@@ -0,0 +1,196 @@
+// Package moderation provides a pipeline of rules
+// applied to chat messages before they are published
+package moderation
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ribice/goch"
+	"github.com/ribice/goch/pkg/config"
+)
+
+// Action represents moderation decision on a message
+type Action int
+
+// Action constants, ordered by severity
+const (
+	Allow Action = iota
+	Flag
+	Redact
+	Reject
+)
+
+var actions = map[string]Action{
+	"flag":   Flag,
+	"redact": Redact,
+	"reject": Reject,
+	"allow":  Allow,
+}
+
+// Verdict represents result of a moderation rule
+type Verdict struct {
+	Action Action
+	Reason string
+	Text   string // Replacement text of redacted message
+}
+
+// Rule represents a single moderation rule
+type Rule interface {
+	Check(string, *goch.Message) (Verdict, error)
+}
+
+// AllChannels is the key of rules applied to every channel
+const AllChannels = "*"
+
+const defaultHookTimeout = 2 * time.Second
+
+var errTextTooLong = fmt.Errorf("moderated message exceeds max message length of %d characters", goch.MaxTextLength)
+
+var linkRgx = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"]+`)
+
+// New creates new moderation pipeline from rules configured per channel
+func New(cfg map[string][]config.ModerationRule) (*Pipeline, error) {
+	p := &Pipeline{rules: make(map[string][]Rule)}
+	for ch, rules := range cfg {
+		for i, rc := range rules {
+			r, err := newRule(rc)
+			if err != nil {
+				return nil, fmt.Errorf("moderation: invalid rule %d for channel %s: %v", i, ch, err)
+			}
+			p.rules[ch] = append(p.rules[ch], r)
+		}
+	}
+	return p, nil
+}
+
+// Pipeline represents chain of moderation rules
+type Pipeline struct {
+	rules map[string][]Rule
+}
+
+// Moderate runs rules configured for all channels, followed by ones
+// configured for chat id, on message m. Redacted text and flags are
+// applied to m. Returns an error holding the reason if m was rejected,
+// or if redacted text exceeds max message length.
+func (p *Pipeline) Moderate(id string, m *goch.Message) error {
+	for _, rules := range [][]Rule{p.rules[AllChannels], p.rules[id]} {
+		for _, r := range rules {
+			v, err := r.Check(id, m)
+			if err != nil {
+				return err
+			}
+			switch v.Action {
+			case Reject:
+				return errors.New(v.Reason)
+			case Redact:
+				m.Text = v.Text
+			case Flag:
+				m.Flags = append(m.Flags, v.Reason)
+			}
+		}
+	}
+
+	if len(m.Text) > goch.MaxTextLength {
+		return errTextTooLong
+	}
+
+	return nil
+}
+
+func newRule(rc config.ModerationRule) (Rule, error) {
+	if rc.Type == "hook" {
+		return newHook(rc)
+	}
+
+	mr := &matchRule{action: actions[rc.Action], reason: rc.Reason}
+	if mr.action == Allow {
+		return nil, fmt.Errorf("unknown action %s", rc.Action)
+	}
+
+	switch rc.Type {
+	case "words":
+		if len(rc.Words) == 0 {
+			return nil, errors.New("words rule requires words")
+		}
+		quoted := make([]string, len(rc.Words))
+		for i, w := range rc.Words {
+			quoted[i] = regexp.QuoteMeta(w)
+		}
+		mr.rgx = regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+		mr.def = "message contains blocked words"
+	case "regex":
+		rgx, err := regexp.Compile(rc.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		mr.rgx = rgx
+		mr.def = "message matches blocked pattern"
+	case "links":
+		mr.rgx = linkRgx
+		mr.allow = rc.Allow
+		mr.def = "message contains links"
+	default:
+		return nil, fmt.Errorf("unknown type %s", rc.Type)
+	}
+
+	if mr.reason == "" {
+		mr.reason = mr.def
+	}
+
+	return mr, nil
+}
+
+// matchRule applies action to messages whose text matches rgx
+type matchRule struct {
+	rgx    *regexp.Regexp
+	allow  []string // Allowed link hosts
+	action Action
+	reason string
+	def    string
+}
+
+// Check implements Rule
+func (r *matchRule) Check(id string, m *goch.Message) (Verdict, error) {
+	var matched bool
+	text := r.rgx.ReplaceAllStringFunc(m.Text, func(s string) string {
+		if r.allowed(s) {
+			return s
+		}
+		matched = true
+		return strings.Repeat("*", utf8.RuneCountInString(s))
+	})
+
+	if !matched {
+		return Verdict{}, nil
+	}
+
+	return Verdict{Action: r.action, Reason: r.reason, Text: text}, nil
+}
+
+// allowed checks whether matched link points to one of allowed hosts
+func (r *matchRule) allowed(s string) bool {
+	if len(r.allow) == 0 {
+		return false
+	}
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, h := range r.allow {
+		h = strings.ToLower(h)
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
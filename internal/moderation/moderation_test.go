@@ -0,0 +1,236 @@
+package moderation_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ribice/goch"
+	"github.com/ribice/goch/internal/moderation"
+	"github.com/ribice/goch/pkg/config"
+)
+
+func TestNew(t *testing.T) {
+	cases := []struct {
+		name string
+		rule config.ModerationRule
+	}{
+		{
+			name: "Invalid pattern",
+			rule: config.ModerationRule{Type: "regex", Action: "reject", Pattern: "(["},
+		},
+		{
+			name: "Missing words",
+			rule: config.ModerationRule{Type: "words", Action: "reject"},
+		},
+		{
+			name: "Invalid action",
+			rule: config.ModerationRule{Type: "links", Action: "ban"},
+		},
+		{
+			name: "Missing hook url",
+			rule: config.ModerationRule{Type: "hook"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := moderation.New(map[string][]config.ModerationRule{"general": {tc.rule}})
+			if err == nil {
+				t.Error("expected error but received nil")
+			}
+		})
+	}
+}
+
+func TestModerate(t *testing.T) {
+	p, err := moderation.New(map[string][]config.ModerationRule{
+		moderation.AllChannels: {
+			{Type: "words", Action: "reject", Words: []string{"scam"}},
+			{Type: "words", Action: "redact", Words: []string{"darn", "heck"}},
+		},
+		"general": {
+			{Type: "regex", Action: "redact", Pattern: `\b\d{16}\b`},
+			{Type: "links", Action: "flag", Reason: "contains external link", Allow: []string{"example.com"}},
+		},
+		"kids": {
+			{Type: "links", Action: "reject"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name      string
+		chat      string
+		text      string
+		wantText  string
+		wantFlags []string
+		wantErr   string
+	}{
+		{
+			name:     "Allowed",
+			chat:     "general",
+			text:     "Hello world",
+			wantText: "Hello world",
+		},
+		{
+			name:    "Rejected word in every channel",
+			chat:    "random",
+			text:    "Not a SCAM",
+			wantErr: "message contains blocked words",
+		},
+		{
+			name:     "Word within another word",
+			chat:     "random",
+			text:     "scamper away",
+			wantText: "scamper away",
+		},
+		{
+			name:     "Redacted words and pattern",
+			chat:     "general",
+			text:     "Darn, card 1234567812345678 leaked",
+			wantText: "****, card **************** leaked",
+		},
+		{
+			name:     "Allowed link",
+			chat:     "general",
+			text:     "see https://docs.example.com/page",
+			wantText: "see https://docs.example.com/page",
+		},
+		{
+			name:      "Flagged link",
+			chat:      "general",
+			text:      "see www.other.org",
+			wantText:  "see www.other.org",
+			wantFlags: []string{"contains external link"},
+		},
+		{
+			name:    "Rejected link",
+			chat:    "kids",
+			text:    "see http://example.com",
+			wantErr: "message contains links",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &goch.Message{Text: tc.text}
+			err := p.Moderate(tc.chat, m)
+			if (err != nil) != (tc.wantErr != "") || (err != nil && err.Error() != tc.wantErr) {
+				t.Fatalf("expected err %q but got %v", tc.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if m.Text != tc.wantText {
+				t.Errorf("expected text %q, got %q", tc.wantText, m.Text)
+			}
+			if !reflect.DeepEqual(m.Flags, tc.wantFlags) {
+				t.Errorf("expected flags %v, got %v", tc.wantFlags, m.Flags)
+			}
+		})
+	}
+}
+
+func TestHook(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Channel string       `json:"channel"`
+			Message goch.Message `json:"message"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		switch req.Message.Text {
+		case "slow":
+			time.Sleep(100 * time.Millisecond)
+		case "broken":
+			w.WriteHeader(500)
+		case "spam":
+			w.Write([]byte(`{"action":"reject","reason":"looks like spam"}`))
+		case "rude":
+			w.Write([]byte(`{"action":"redact","text":"[removed]"}`))
+		case "verbose":
+			w.Write([]byte(`{"action":"redact","text":"` + strings.Repeat("x", goch.MaxTextLength+1) + `"}`))
+		default:
+			w.Write([]byte(`{"action":"allow"}`))
+		}
+	}))
+	defer srv.Close()
+
+	p, err := moderation.New(map[string][]config.ModerationRule{
+		"strict":  {{Type: "hook", URL: srv.URL, Timeout: 50}},
+		"lenient": {{Type: "hook", URL: srv.URL, Timeout: 50, FailOpen: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		chat     string
+		text     string
+		wantText string
+		wantErr  string
+	}{
+		{
+			name:     "Allowed",
+			chat:     "strict",
+			text:     "hello",
+			wantText: "hello",
+		},
+		{
+			name:    "Rejected",
+			chat:    "strict",
+			text:    "spam",
+			wantErr: "looks like spam",
+		},
+		{
+			name:     "Redacted",
+			chat:     "strict",
+			text:     "rude",
+			wantText: "[removed]",
+		},
+		{
+			name:    "Redacted over max length",
+			chat:    "strict",
+			text:    "verbose",
+			wantErr: "moderated message exceeds max message length of 1024 characters",
+		},
+		{
+			name:    "Hook failure",
+			chat:    "strict",
+			text:    "broken",
+			wantErr: "message could not be moderated, try again later",
+		},
+		{
+			name:    "Hook timeout",
+			chat:    "strict",
+			text:    "slow",
+			wantErr: "message could not be moderated, try again later",
+		},
+		{
+			name:     "Hook failing open",
+			chat:     "lenient",
+			text:     "broken",
+			wantText: "broken",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &goch.Message{Text: tc.text}
+			err := p.Moderate(tc.chat, m)
+			if (err != nil) != (tc.wantErr != "") || (err != nil && err.Error() != tc.wantErr) {
+				t.Fatalf("expected err %q but got %v", tc.wantErr, err)
+			}
+			if err == nil && m.Text != tc.wantText {
+				t.Errorf("expected text %q, got %q", tc.wantText, m.Text)
+			}
+		})
+	}
+}
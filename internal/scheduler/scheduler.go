@@ -0,0 +1,143 @@
+// Package scheduler provides sending of scheduled messages
+package scheduler
+
+import (
+	"time"
+
+	"github.com/ribice/goch"
+)
+
+const (
+	pollInterval = time.Second
+	// Claimed messages are sent one by one, each taking up to NATS publish
+	// timeout (10s), so the whole batch is sent well before its lease expires
+	claimBatch = 10
+	claimLease = 5 * time.Minute
+	// Sent markers outlive the lease, so messages sent by an instance which
+	// failed before completing them are not sent again once reclaimed
+	sentMarkerTTL = 24 * time.Hour
+	maxAttempts   = 5
+)
+
+// New creates new scheduled message sender
+func New(store Store, mb MessageBroker) *Scheduler {
+	return &Scheduler{store: store, mb: mb}
+}
+
+// Scheduler represents scheduled message sender
+type Scheduler struct {
+	store Store
+	mb    MessageBroker
+}
+
+// Store represents scheduled message store interface
+type Store interface {
+	Get(string) (*goch.Chat, error)
+	ClaimScheduled(time.Time, time.Duration, int64) ([]*goch.Scheduled, error)
+	MarkScheduledSent(*goch.Scheduled, time.Duration) (bool, error)
+	RetryScheduled(*goch.Scheduled) error
+	CompleteScheduled(*goch.Scheduled) error
+}
+
+// MessageBroker represents broker interface
+type MessageBroker interface {
+	Send(string, *goch.Message) error
+}
+
+// Run polls for due scheduled messages and sends them.
+// Returns func stopping the scheduler.
+func (s *Scheduler) Run() func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		t := time.NewTicker(pollInterval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				s.SendDue(time.Now())
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// SendDue sends messages scheduled until t. Messages are claimed and marked
+// as sent before being sent, so running it concurrently on multiple goch
+// instances sends each once. A message can only be sent twice if NATS stored
+// it but failed to acknowledge it in time. Messages which failed to send, or
+// whose channel could not be loaded, are retried once their claim expires,
+// and dropped after maxAttempts.
+func (s *Scheduler) SendDue(t time.Time) {
+	for {
+		sms, err := s.store.ClaimScheduled(t, claimLease, claimBatch)
+		if err != nil {
+			return
+		}
+
+		for _, sm := range sms {
+			s.send(sm)
+		}
+
+		if len(sms) < claimBatch {
+			return
+		}
+	}
+}
+
+// send sends scheduled message. Messages of members who can
+// no longer post in the chat are dropped.
+func (s *Scheduler) send(sm *goch.Scheduled) {
+	ch, err := s.store.Get(sm.Channel)
+	if err != nil {
+		s.retry(sm)
+		return
+	}
+
+	if ch.Authorize(sm.Message.FromUID, goch.PostPerm) != nil {
+		s.store.CompleteScheduled(sm)
+		return
+	}
+
+	marked, err := s.store.MarkScheduledSent(sm, sentMarkerTTL)
+	if err != nil {
+		s.retry(sm)
+		return
+	}
+
+	// Message was sent under a previous claim, which failed to complete it
+	if !marked {
+		s.store.CompleteScheduled(sm)
+		return
+	}
+
+	sm.Message.Time = time.Now().UnixNano()
+	// TTL was validated when scheduling, expiry counts from the time message is sent
+	sm.Message.SetTTL(sm.Message.TTL)
+	if err = s.mb.Send(sm.Channel, sm.Message); err != nil {
+		s.retry(sm)
+		return
+	}
+
+	s.store.CompleteScheduled(sm)
+}
+
+// retry records failed attempt to send sm, dropping it after maxAttempts
+func (s *Scheduler) retry(sm *goch.Scheduled) {
+	sm.Attempts++
+	if sm.Attempts >= maxAttempts {
+		s.store.CompleteScheduled(sm)
+		return
+	}
+	s.store.RetryScheduled(sm)
+}
@@ -0,0 +1,162 @@
+package scheduler_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ribice/goch"
+	"github.com/ribice/goch/internal/scheduler"
+)
+
+func TestSendDue(t *testing.T) {
+	now := time.Now()
+	s := &store{
+		due:       make(map[string]*goch.Scheduled),
+		completed: make(map[string]bool),
+		marked:    map[string]bool{"resent": true},
+		retried:   make(map[string]int),
+	}
+	for i := 0; i < 250; i++ {
+		s.add(fmt.Sprintf("msg%d", i), "john", now.Add(-time.Second))
+	}
+	s.add("future", "john", now.Add(time.Hour))
+	s.add("kicked", "jane", now.Add(-time.Second))
+	s.add("failing", "john", now.Add(-time.Second))
+	s.add("exhausted", "john", now.Add(-time.Second))
+	s.due["exhausted"].Attempts = 4
+	s.due["exhausted"].Message.Text = "failing"
+	s.add("resent", "john", now.Add(-time.Second))
+	s.add("gone", "john", now.Add(-time.Second))
+	s.due["gone"].Channel = "gone"
+
+	mb := &broker{sent: make(map[string]int)}
+
+	// Concurrent schedulers mimic multiple goch instances
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scheduler.New(s, mb).SendDue(now)
+		}()
+	}
+	wg.Wait()
+
+	if len(mb.sent) != 250 {
+		t.Errorf("expected 250 messages to be sent, got %d", len(mb.sent))
+	}
+	for text, n := range mb.sent {
+		if n != 1 {
+			t.Errorf("expected %s to be sent once, got %d", text, n)
+		}
+	}
+
+	if _, ok := mb.sent["future"]; ok || s.completed["future"] {
+		t.Error("expected message scheduled in the future not to be sent")
+	}
+	if _, ok := mb.sent["kicked"]; ok || !s.completed["kicked"] {
+		t.Error("expected message of former member to be dropped")
+	}
+	if s.completed["failing"] || s.retried["failing"] != 1 || s.marked["failing"] {
+		t.Error("expected message which failed to send to be retried")
+	}
+	if !s.completed["exhausted"] || s.retried["exhausted"] != 0 {
+		t.Error("expected message to be dropped after max attempts")
+	}
+	if _, ok := mb.sent["resent"]; ok || !s.completed["resent"] {
+		t.Error("expected message sent under previous claim not to be sent again")
+	}
+	if s.completed["gone"] || s.retried["gone"] != 1 {
+		t.Error("expected message whose channel could not be loaded to be retried")
+	}
+}
+
+type store struct {
+	mu        sync.Mutex
+	due       map[string]*goch.Scheduled
+	completed map[string]bool
+	marked    map[string]bool
+	retried   map[string]int
+}
+
+func (s *store) add(text, uid string, sendAt time.Time) {
+	s.due[text] = &goch.Scheduled{
+		ID:      text,
+		Channel: "general",
+		Message: &goch.Message{Text: text, FromUID: uid, TTL: 60, ExpiresAt: sendAt.Add(time.Minute).UnixNano()},
+		SendAt:  sendAt.UnixNano(),
+	}
+}
+
+func (s *store) Get(id string) (*goch.Chat, error) {
+	if id != "general" {
+		return nil, errors.New("chat not found")
+	}
+	return &goch.Chat{Name: "general", Members: map[string]*goch.User{"john": {UID: "john"}}}, nil
+}
+
+func (s *store) ClaimScheduled(t time.Time, lease time.Duration, n int64) ([]*goch.Scheduled, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sms []*goch.Scheduled
+	for id, sm := range s.due {
+		if int64(len(sms)) == n {
+			break
+		}
+		if sm.SendAt <= t.UnixNano() {
+			sms = append(sms, sm)
+			delete(s.due, id)
+		}
+	}
+	return sms, nil
+}
+
+func (s *store) MarkScheduledSent(sm *goch.Scheduled, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.marked[sm.ID] {
+		return false, nil
+	}
+	s.marked[sm.ID] = true
+	return true, nil
+}
+
+func (s *store) RetryScheduled(sm *goch.Scheduled) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.marked, sm.ID)
+	s.retried[sm.ID]++
+	return nil
+}
+
+func (s *store) CompleteScheduled(sm *goch.Scheduled) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.completed[sm.ID] = true
+	return nil
+}
+
+type broker struct {
+	mu   sync.Mutex
+	sent map[string]int
+}
+
+func (b *broker) Send(id string, m *goch.Message) error {
+	if m.Text == "failing" {
+		return errors.New("unable to send")
+	}
+	if m.Time == 0 {
+		return errors.New("expected message time to be set")
+	}
+	if m.ExpiresAt != m.Time+m.TTL*int64(time.Second) {
+		return errors.New("expected message to expire relative to time it was sent")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sent[m.Text]++
+	return nil
+}
@@ -0,0 +1,274 @@
+// Package webhook provides delivery of chat
+// messages to channels' outgoing webhooks
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ribice/goch"
+	"github.com/ribice/goch/pkg/config"
+)
+
+const (
+	queueGroup      = "webhook"
+	refreshInterval = 30 * time.Second
+
+	defaultMaxAttempts = 5
+	defaultBackoff     = time.Second
+	defaultTimeout     = 5 * time.Second
+	maxBackoff         = 5 * time.Minute
+)
+
+// New creates new webhook dispatcher. Delivery defaults are used if cfg is nil.
+func New(mq MQ, store Store, cfg *config.Webhooks) *Dispatcher {
+	d := &Dispatcher{
+		mq:          mq,
+		store:       store,
+		maxAttempts: defaultMaxAttempts,
+		backoff:     defaultBackoff,
+		subs:        make(map[string]io.Closer),
+	}
+
+	timeout := defaultTimeout
+	if cfg != nil {
+		if cfg.MaxAttempts > 0 {
+			d.maxAttempts = cfg.MaxAttempts
+		}
+		if cfg.Backoff > 0 {
+			d.backoff = time.Duration(cfg.Backoff) * time.Millisecond
+		}
+		if cfg.Timeout > 0 {
+			timeout = time.Duration(cfg.Timeout) * time.Millisecond
+		}
+	}
+
+	d.cl = &http.Client{Timeout: timeout}
+	// Messages are delivered one at a time, and are redelivered only if all
+	// of their attempts took longer than expected. Backoff after the last
+	// attempt is never waited, leaving time for store calls.
+	d.ackWait = time.Duration(d.maxAttempts) * timeout
+	for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+		d.ackWait += d.delay(attempt)
+	}
+
+	return d
+}
+
+// Dispatcher represents outgoing webhook dispatcher
+type Dispatcher struct {
+	mq          MQ
+	store       Store
+	cl          *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	ackWait     time.Duration
+	subs        map[string]io.Closer
+}
+
+// MQ represents webhook message queue interface
+type MQ interface {
+	SubscribeGroup(string, string, time.Duration, func(uint64, []byte)) (io.Closer, error)
+}
+
+// Store represents webhook store interface
+type Store interface {
+	ListWebhookChannels() ([]string, error)
+	ListWebhooks(string) ([]*goch.Webhook, error)
+	AddDeadLetter(string, *goch.DeadLetter) error
+}
+
+// Payload represents body POSTed to webhooks
+type Payload struct {
+	WebhookID string        `json:"webhook_id"`
+	Event     string        `json:"event"`
+	Channel   string        `json:"channel"`
+	Message   *goch.Message `json:"message"`
+}
+
+// Webhook request headers
+const (
+	EventHeader     = "X-Goch-Event"
+	DeliveryHeader  = "X-Goch-Delivery"
+	SignatureHeader = "X-Goch-Signature" // sha256=<hex encoded HMAC of body>
+)
+
+// Run subscribes to messages of all channels having webhooks. Channels
+// are refreshed periodically, so webhooks added to new channels are
+// picked up without restart. Returns func stopping the dispatcher.
+func (d *Dispatcher) Run() func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		t := time.NewTicker(refreshInterval)
+		defer t.Stop()
+
+		for {
+			d.refresh()
+			select {
+			case <-t.C:
+			case <-stop:
+				for _, sub := range d.subs {
+					sub.Close()
+				}
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// refresh subscribes to channels which got webhooks,
+// and unsubscribes from ones which no longer have any
+func (d *Dispatcher) refresh() {
+	ids, err := d.store.ListWebhookChannels()
+	if err != nil {
+		return
+	}
+
+	active := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		active[id] = true
+		if _, ok := d.subs[id]; ok {
+			continue
+		}
+
+		id := id
+		sub, err := d.mq.SubscribeGroup("chat."+id, queueGroup, d.ackWait, func(seq uint64, data []byte) {
+			d.dispatch(id, seq, data)
+		})
+		if err != nil {
+			continue
+		}
+		d.subs[id] = sub
+	}
+
+	for id, sub := range d.subs {
+		if !active[id] {
+			sub.Close()
+			delete(d.subs, id)
+		}
+	}
+}
+
+// dispatch delivers message to all of chat's webhooks subscribed
+// to its event, returning once all deliveries are done
+func (d *Dispatcher) dispatch(id string, seq uint64, data []byte) {
+	msg, err := goch.DecodeMsg(data)
+	if err != nil {
+		return
+	}
+	msg.Seq = seq
+
+	whs, err := d.store.ListWebhooks(id)
+	if err != nil {
+		return
+	}
+
+	event := goch.WebhookEvent(msg)
+
+	var wg sync.WaitGroup
+	for _, wh := range whs {
+		if !wh.Subscribed(event) {
+			continue
+		}
+		wg.Add(1)
+		go func(wh *goch.Webhook) {
+			defer wg.Done()
+			d.deliver(wh, event, msg)
+		}(wh)
+	}
+	wg.Wait()
+}
+
+// deliver POSTs message to webhook, retrying with exponential backoff.
+// Messages which could not be delivered are added to dead letters.
+func (d *Dispatcher) deliver(wh *goch.Webhook, event string, msg *goch.Message) {
+	body, err := json.Marshal(Payload{
+		WebhookID: wh.ID,
+		Event:     event,
+		Channel:   wh.Channel,
+		Message:   msg,
+	})
+	if err != nil {
+		return
+	}
+
+	var attempt int
+	for attempt = 1; ; attempt++ {
+		var retry bool
+		if retry, err = d.post(wh, event, msg.Seq, body); err == nil {
+			return
+		}
+		if !retry || attempt == d.maxAttempts {
+			break
+		}
+		time.Sleep(d.delay(attempt))
+	}
+
+	d.store.AddDeadLetter(wh.Channel, &goch.DeadLetter{
+		WebhookID: wh.ID,
+		URL:       wh.URL,
+		Event:     event,
+		Message:   msg,
+		Attempts:  attempt,
+		Error:     err.Error(),
+		FailedAt:  time.Now().UnixNano(),
+	})
+}
+
+// delay returns backoff before retrying failed attempt, doubling
+// with each attempt up to maxBackoff
+func (d *Dispatcher) delay(attempt int) time.Duration {
+	wait := d.backoff
+	for i := 1; i < attempt && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxBackoff {
+		return maxBackoff
+	}
+	return wait
+}
+
+// post sends a single delivery request. Failed requests are worth
+// retrying unless webhook rejected the payload.
+func (d *Dispatcher) post(wh *goch.Webhook, event string, seq uint64, body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, fmt.Sprintf("%s.%d", wh.Channel, seq))
+	req.Header.Set(SignatureHeader, "sha256="+wh.Sign(body))
+
+	res, err := d.cl.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return false, nil
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500:
+		return true, fmt.Errorf("webhook: receiver responded with status %d", res.StatusCode)
+	}
+
+	return false, fmt.Errorf("webhook: receiver rejected payload with status %d", res.StatusCode)
+}
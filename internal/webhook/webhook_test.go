@@ -0,0 +1,282 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ribice/goch"
+	"github.com/ribice/goch/internal/webhook"
+	"github.com/ribice/goch/pkg/config"
+)
+
+func TestDispatcher(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []webhook.Payload
+		attempts = make(map[string]int)
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		id := r.URL.Path[1:]
+		attempts[id]++
+
+		body, _ := ioutil.ReadAll(r.Body)
+		wh := &goch.Webhook{Secret: "secret-" + id}
+		if r.Header.Get(webhook.SignatureHeader) != "sha256="+wh.Sign(body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case id == "flaky" && attempts[id] < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		case id == "down":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		case id == "gone":
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+
+		var p webhook.Payload
+		json.Unmarshal(body, &p)
+		if r.Header.Get(webhook.EventHeader) != p.Event {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received = append(received, p)
+	}))
+	defer srv.Close()
+
+	newWebhook := func(id string, events ...string) *goch.Webhook {
+		return &goch.Webhook{ID: id, Channel: "general", URL: srv.URL + "/" + id, Secret: "secret-" + id, Events: events}
+	}
+
+	s := &store{
+		webhooks: []*goch.Webhook{
+			newWebhook("ok"),
+			newWebhook("edits", goch.EditWebhookEvent),
+			newWebhook("flaky"),
+			newWebhook("down"),
+			newWebhook("gone"),
+		},
+	}
+	mq := &queue{subscribed: make(chan struct{})}
+
+	stop := webhook.New(mq, s, &config.Webhooks{MaxAttempts: 3, Backoff: 1, Timeout: 1000}).Run()
+	defer stop()
+
+	select {
+	case <-mq.subscribed:
+	case <-time.After(time.Second):
+		t.Fatal("dispatcher did not subscribe to chat")
+	}
+
+	if mq.subj != "chat.general" {
+		t.Errorf("expected subscription to chat.general but got %s", mq.subj)
+	}
+
+	bts, err := (&goch.Message{Text: "hello", FromUID: "john"}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mq.f(42, bts)
+
+	if len(received) != 2 {
+		t.Fatalf("expected 2 deliveries but got %d", len(received))
+	}
+	for _, p := range received {
+		if p.Event != goch.MessageWebhookEvent || p.Channel != "general" || p.Message.Seq != 42 || p.Message.Text != "hello" {
+			t.Errorf("unexpected payload %v", p)
+		}
+	}
+
+	want := map[string]int{"ok": 1, "flaky": 3, "down": 3, "gone": 1}
+	for id, n := range want {
+		if attempts[id] != n {
+			t.Errorf("expected %d attempts for %s but got %d", n, id, attempts[id])
+		}
+	}
+	if attempts["edits"] != 0 {
+		t.Error("expected webhook not subscribed to messages to be skipped")
+	}
+
+	if len(s.deadLetters) != 2 {
+		t.Fatalf("expected 2 dead letters but got %d", len(s.deadLetters))
+	}
+	for _, dl := range s.deadLetters {
+		if dl.Attempts != attempts[dl.WebhookID] || dl.Message.Seq != 42 || dl.Error == "" {
+			t.Errorf("unexpected dead letter %v", dl)
+		}
+	}
+}
+
+func TestAckWait(t *testing.T) {
+	mq := &queue{subscribed: make(chan struct{})}
+	s := &store{}
+
+	stop := webhook.New(mq, s, &config.Webhooks{MaxAttempts: 40, Backoff: 1000, Timeout: 1000}).Run()
+	defer stop()
+
+	<-mq.subscribed
+
+	// Backoff is capped at 5 minutes, rather than doubling past int64
+	if max := 40 * (time.Second + 5*time.Minute); mq.ackWait <= 0 || mq.ackWait > max {
+		t.Errorf("expected ack wait between 0 and %v, got %v", max, mq.ackWait)
+	}
+}
+
+func TestSlowReceiver(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts = make(map[string]map[uint64]int)
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p webhook.Payload
+		json.NewDecoder(r.Body).Decode(&p)
+
+		mu.Lock()
+		id := r.URL.Path[1:]
+		if attempts[id] == nil {
+			attempts[id] = make(map[uint64]int)
+		}
+		attempts[id][p.Message.Seq]++
+		mu.Unlock()
+
+		time.Sleep(30 * time.Millisecond)
+		if id == "down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	s := &store{
+		webhooks: []*goch.Webhook{
+			{ID: "ok", Channel: "general", URL: srv.URL + "/ok"},
+			{ID: "down", Channel: "general", URL: srv.URL + "/down"},
+		},
+	}
+	mq := &serialQueue{}
+	d := webhook.New(mq, s, &config.Webhooks{MaxAttempts: 3, Backoff: 10, Timeout: 50})
+
+	stop := d.Run()
+	defer stop()
+
+	seqs := []uint64{1, 2, 3}
+	for _, seq := range seqs {
+		bts, err := (&goch.Message{Text: "hello", FromUID: "john"}).Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mq.publish(t, seq, bts)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, seq := range seqs {
+		if n := attempts["ok"][seq]; n != 1 {
+			t.Errorf("expected message %d to be delivered once, got %d deliveries", seq, n)
+		}
+		if n := attempts["down"][seq]; n != 3 {
+			t.Errorf("expected message %d to be attempted 3 times, got %d attempts", seq, n)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.deadLetters) != len(seqs) {
+		t.Errorf("expected a dead letter per message, got %d", len(s.deadLetters))
+	}
+}
+
+type queue struct {
+	subj       string
+	ackWait    time.Duration
+	f          func(uint64, []byte)
+	subscribed chan struct{}
+}
+
+func (q *queue) SubscribeGroup(subj, group string, ackWait time.Duration, f func(uint64, []byte)) (io.Closer, error) {
+	q.subj, q.ackWait, q.f = subj, ackWait, f
+	close(q.subscribed)
+	return ioutil.NopCloser(nil), nil
+}
+
+type store struct {
+	mu          sync.Mutex
+	webhooks    []*goch.Webhook
+	deadLetters []*goch.DeadLetter
+}
+
+func (s *store) ListWebhookChannels() ([]string, error) {
+	return []string{"general"}, nil
+}
+
+func (s *store) ListWebhooks(id string) ([]*goch.Webhook, error) {
+	return s.webhooks, nil
+}
+
+func (s *store) AddDeadLetter(id string, dl *goch.DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadLetters = append(s.deadLetters, dl)
+	return nil
+}
+
+// serialQueue delivers group messages like NATS Streaming does with a single
+// message in flight: each message is delivered once the previous one is
+// acknowledged, and redelivered if not acknowledged within ackWait
+type serialQueue struct {
+	mu      sync.Mutex
+	ackWait time.Duration
+	f       func(uint64, []byte)
+}
+
+func (q *serialQueue) SubscribeGroup(subj, group string, ackWait time.Duration, f func(uint64, []byte)) (io.Closer, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.ackWait, q.f = ackWait, f
+	return ioutil.NopCloser(nil), nil
+}
+
+// publish delivers message, returning once it is acknowledged
+func (q *serialQueue) publish(t *testing.T, seq uint64, data []byte) {
+	for q.handler() == nil {
+		time.Sleep(time.Millisecond)
+	}
+
+	for redeliveries := 0; ; redeliveries++ {
+		if redeliveries > 3 {
+			t.Fatalf("message %d was not acknowledged", seq)
+		}
+
+		acked := make(chan struct{})
+		go func() {
+			q.handler()(seq, data)
+			close(acked)
+		}()
+
+		select {
+		case <-acked:
+			return
+		case <-time.After(q.ackWait):
+		}
+	}
+}
+
+func (q *serialQueue) handler() func(uint64, []byte) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.f
+}
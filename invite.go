@@ -0,0 +1,100 @@
+package goch
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Invite represents a token which allows joining a channel
+type Invite struct {
+	Token     string `json:"token"`
+	Channel   string `json:"channel"`
+	CreatedBy string `json:"created_by"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at"` // Zero if invite never expires
+	MaxUses   int    `json:"max_uses"`   // Zero if invite can be used unlimited times
+	Uses      int    `json:"uses"`
+	Revoked   bool   `json:"revoked"`
+}
+
+// ErrInviteNotFound is returned by stores when an invite does not exist
+var ErrInviteNotFound = errors.New("invite: invite does not exist")
+
+// Invite errors
+var (
+	errInviteRevoked   = errors.New("invite: invite was revoked")
+	errInviteExpired   = errors.New("invite: invite has expired")
+	errInviteExhausted = errors.New("invite: invite has no uses left")
+)
+
+// inviteTokenSize is number of random bytes in invite token. Hex encoded,
+// tokens are as long as channel secrets, so they pass the same limit.
+const inviteTokenSize = 10
+
+// NewInvite creates new invite for a channel. Zero ttl and maxUses
+// create an invite that doesn't expire and can be used unlimited times.
+func NewInvite(channel, createdBy string, ttl time.Duration, maxUses int) (*Invite, error) {
+	token := make([]byte, inviteTokenSize)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("invite: unable to generate token: %v", err)
+	}
+
+	now := time.Now()
+	inv := Invite{
+		Token:     hex.EncodeToString(token),
+		Channel:   channel,
+		CreatedBy: createdBy,
+		CreatedAt: now.UnixNano(),
+		MaxUses:   maxUses,
+	}
+	if ttl > 0 {
+		inv.ExpiresAt = now.Add(ttl).UnixNano()
+	}
+	return &inv, nil
+}
+
+// Valid checks whether invite can be used at time t
+func (i *Invite) Valid(t time.Time) error {
+	switch {
+	case i.Revoked:
+		return errInviteRevoked
+	case i.ExpiresAt > 0 && t.UnixNano() >= i.ExpiresAt:
+		return errInviteExpired
+	case i.MaxUses > 0 && i.Uses >= i.MaxUses:
+		return errInviteExhausted
+	}
+	return nil
+}
+
+// Use validates the invite at time t and records its use
+func (i *Invite) Use(t time.Time) error {
+	if err := i.Valid(t); err != nil {
+		return err
+	}
+	i.Uses++
+	return nil
+}
+
+// Release reverts a use of the invite, for when joining with it failed
+func (i *Invite) Release() {
+	if i.Uses > 0 {
+		i.Uses--
+	}
+}
+
+// DecodeInvite tries to decode binary formatted invite in b to Invite
+func DecodeInvite(b []byte) (*Invite, error) {
+	var i Invite
+	if err := decode(b, &i); err != nil {
+		return nil, fmt.Errorf("invite: unable to unmarshal invite: %v", err)
+	}
+	return &i, nil
+}
+
+// Encode encodes provided invite in binary format using DefaultCodec
+func (i *Invite) Encode() ([]byte, error) {
+	return encode(i)
+}
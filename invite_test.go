@@ -0,0 +1,80 @@
+package goch_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ribice/goch"
+)
+
+func TestInvite(t *testing.T) {
+	now := time.Now()
+
+	inv, err := goch.NewInvite("channel", "admin", time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inv.Token) != 20 || inv.Channel != "channel" || inv.CreatedBy != "admin" {
+		t.Errorf("unexpected invite %v", inv)
+	}
+
+	other, err := goch.NewInvite("channel", "admin", time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Token[:8] == inv.Token[:8] {
+		t.Errorf("expected random tokens, got %s and %s", inv.Token, other.Token)
+	}
+
+	if err := inv.Use(now); err != nil {
+		t.Errorf("did not expect error but received: %v", err)
+	}
+	if err := inv.Use(now); err != nil {
+		t.Errorf("did not expect error but received: %v", err)
+	}
+	if err := inv.Use(now); err == nil || err.Error() != "invite: invite has no uses left" {
+		t.Errorf("expected exhausted error but received: %v", err)
+	}
+	if inv.Uses != 2 {
+		t.Errorf("expected 2 uses but got %d", inv.Uses)
+	}
+
+	inv.Release()
+	if err := inv.Use(now); err != nil {
+		t.Errorf("expected released use to be available but received: %v", err)
+	}
+
+	inv, _ = goch.NewInvite("channel", "admin", time.Hour, 0)
+	if err := inv.Valid(now.Add(2 * time.Hour)); err == nil || err.Error() != "invite: invite has expired" {
+		t.Errorf("expected expired error but received: %v", err)
+	}
+
+	inv, _ = goch.NewInvite("channel", "admin", 0, 0)
+	if err := inv.Valid(now.Add(24 * 365 * time.Hour)); err != nil {
+		t.Errorf("did not expect error but received: %v", err)
+	}
+
+	inv.Revoked = true
+	if err := inv.Valid(now); err == nil || err.Error() != "invite: invite was revoked" {
+		t.Errorf("expected revoked error but received: %v", err)
+	}
+}
+
+func TestInviteEncode(t *testing.T) {
+	inv, err := goch.NewInvite("channel", "admin", time.Hour, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bts, err := inv.Encode()
+	if err != nil {
+		t.Errorf("did not expect error but received: %v", err)
+	}
+	got, err := goch.DecodeInvite(bts)
+	if err != nil {
+		t.Errorf("did not expect error but received: %v", err)
+	}
+	if !reflect.DeepEqual(inv, got) {
+		t.Errorf("expected invite %v but got %v", inv, got)
+	}
+}
@@ -1,27 +1,154 @@
 package goch
 
 import (
-	"github.com/vmihailenco/msgpack"
+	"fmt"
+	"time"
 )
 
+// MessageType represents type of a chat message
+type MessageType int
+
+// MessageType constants. Types other than TextMessage are events
+// referencing an existing message by its sequence (Ref).
+const (
+	TextMessage MessageType = iota
+	EditMessage
+	DeleteMessage
+	ReactMessage
+	UnreactMessage
+	PinMessage
+	UnpinMessage
+	ExpireMessage
+)
+
+// MaxTTL is the longest time a message can be kept for before expiring
+const MaxTTL = 30 * 24 * time.Hour
+
+// MaxTextLength is the max length of message text
+const MaxTextLength = 1024
+
 // Message represents chat message
 type Message struct {
-	Meta     map[string]string `json:"meta"`
-	Time     int64             `json:"time"`
-	Seq      uint64            `json:"seq"`
-	Text     string            `json:"text"`
-	FromUID  string            `json:"from_uid"`
-	FromName string            `json:"from_name"`
+	Meta        map[string]string `json:"meta"`
+	Time        int64             `json:"time"`
+	Seq         uint64            `json:"seq"`
+	Text        string            `json:"text"`
+	FromUID     string            `json:"from_uid"`
+	FromName    string            `json:"from_name"`
+	Type        MessageType       `json:"type"`
+	Ref         uint64            `json:"ref,omitempty"`
+	Edited      int64             `json:"edited,omitempty"`
+	Deleted     bool              `json:"deleted,omitempty"`
+	Parent      uint64            `json:"parent,omitempty"`
+	Replies     uint64            `json:"replies,omitempty"`
+	Reactions   []Reaction        `json:"reactions,omitempty"`
+	Attachments []Attachment      `json:"attachments,omitempty"`
+	Mentions    []string          `json:"mentions,omitempty"`
+	Flags       []string          `json:"flags,omitempty"`  // Reasons message was flagged by moderation
+	System      bool              `json:"system,omitempty"` // Sent by goch, e.g. as output of a slash command
+	Action      bool              `json:"action,omitempty"` // Describes what sender is doing, sent with /me
+	TTL         int64             `json:"ttl,omitempty"`    // Seconds message is kept for before expiring, zero if it never expires
+	ExpiresAt   int64             `json:"expires_at,omitempty"`
+	Expired     bool              `json:"expired,omitempty"` // Expired messages are tombstones, without their content
+}
+
+// Reaction represents summary of a single reaction on a message
+type Reaction struct {
+	Emoji string   `json:"emoji"`
+	Count int      `json:"count"`
+	UIDs  []string `json:"uids"`
+}
+
+// IsEvent checks whether message is an event referencing another message
+func (m *Message) IsEvent() bool {
+	return m.Type != TextMessage
+}
+
+// IsReaction checks whether message is an event adding or removing a reaction.
+// Reaction's emoji is carried in Text.
+func (m *Message) IsReaction() bool {
+	return m.Type == ReactMessage || m.Type == UnreactMessage
+}
+
+// IsPin checks whether message is an event pinning or unpinning a message
+func (m *Message) IsPin() bool {
+	return m.Type == PinMessage || m.Type == UnpinMessage
+}
+
+var errInvalidTTL = fmt.Errorf("message: ttl must be between 0 and %d seconds", int64(MaxTTL/time.Second))
+
+// SetTTL sets message's TTL in seconds, expiring it ttl after its Time
+func (m *Message) SetTTL(ttl int64) error {
+	if ttl < 0 || ttl > int64(MaxTTL/time.Second) {
+		return errInvalidTTL
+	}
+	m.TTL, m.ExpiresAt = ttl, 0
+	if ttl > 0 {
+		m.ExpiresAt = m.Time + ttl*int64(time.Second)
+	}
+	return nil
+}
+
+// IsExpired checks whether message has expired at time t
+func (m *Message) IsExpired(t time.Time) bool {
+	return m.ExpiresAt != 0 && t.UnixNano() >= m.ExpiresAt
+}
+
+// Expire replaces content of expired message with a tombstone.
+// Events, such as edits of an expired message, only have their content removed.
+func (m *Message) Expire() {
+	m.Text = ""
+	m.Meta = nil
+	m.Attachments = nil
+	m.Flags = nil
+	m.Expired = true
+	if !m.IsEvent() {
+		m.Deleted = true
+	}
+}
+
+// IsReply checks whether message is a reply in a thread
+func (m *Message) IsReply() bool {
+	return m.Parent != 0
+}
+
+// Apply applies edit or delete event ev to message m.
+// Returns false if ev does not reference m or cannot be applied to it.
+func (m *Message) Apply(ev *Message) bool {
+	if ev.Ref != m.Seq || m.Deleted {
+		return false
+	}
+
+	switch ev.Type {
+	case EditMessage:
+		m.Text = ev.Text
+		m.Flags = ev.Flags
+	case DeleteMessage:
+		m.Text = ""
+		m.Meta = nil
+		m.Attachments = nil
+		m.Flags = nil
+		m.Deleted = true
+	case ExpireMessage:
+		m.Expire()
+		return true
+	default:
+		return false
+	}
+
+	m.Edited = ev.Time
+	return true
 }
 
-// DecodeMsg tries to decode binary formatted message in b to Message
+// DecodeMsg tries to decode binary formatted message in b to Message.
+// Both enveloped and legacy msgpack formats are supported.
 func DecodeMsg(b []byte) (*Message, error) {
 	var msg Message
-	err := msgpack.Unmarshal(b, &msg)
+	err := decode(b, &msg)
 	return &msg, err
 }
 
-// Encode encodes provided chat Message in binary format
+// Encode encodes provided chat Message in binary format using DefaultCodec
 func (m *Message) Encode() ([]byte, error) {
-	return msgpack.Marshal(m)
+	return encode(m)
 }
@@ -3,6 +3,7 @@ package goch_test
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/ribice/goch"
 )
@@ -26,3 +27,90 @@ func TestEncodeMSG(t *testing.T) {
 		t.Error("expected error but received nil")
 	}
 }
+
+func TestApply(t *testing.T) {
+	cases := []struct {
+		name      string
+		msg       goch.Message
+		ev        goch.Message
+		want      goch.Message
+		wantApply bool
+	}{
+		{
+			name: "Different message",
+			msg:  goch.Message{Seq: 1, Text: "Hello"},
+			ev:   goch.Message{Type: goch.EditMessage, Ref: 2, Text: "Hi", Time: 5},
+			want: goch.Message{Seq: 1, Text: "Hello"},
+		},
+		{
+			name: "Not an event",
+			msg:  goch.Message{Seq: 1, Text: "Hello"},
+			ev:   goch.Message{Ref: 1, Text: "Hi", Time: 5},
+			want: goch.Message{Seq: 1, Text: "Hello"},
+		},
+		{
+			name:      "Edit",
+			msg:       goch.Message{Seq: 1, Text: "Hello"},
+			ev:        goch.Message{Type: goch.EditMessage, Ref: 1, Text: "Hi", Time: 5},
+			want:      goch.Message{Seq: 1, Text: "Hi", Edited: 5},
+			wantApply: true,
+		},
+		{
+			name:      "Delete",
+			msg:       goch.Message{Seq: 1, Text: "Hello", Meta: map[string]string{"foo": "bar"}},
+			ev:        goch.Message{Type: goch.DeleteMessage, Ref: 1, Time: 5},
+			want:      goch.Message{Seq: 1, Deleted: true, Edited: 5},
+			wantApply: true,
+		},
+		{
+			name:      "Expire",
+			msg:       goch.Message{Seq: 1, Text: "Hello", Attachments: []goch.Attachment{{ID: "1"}}, ExpiresAt: 4},
+			ev:        goch.Message{Type: goch.ExpireMessage, Ref: 1, Time: 5},
+			want:      goch.Message{Seq: 1, Deleted: true, Expired: true, ExpiresAt: 4},
+			wantApply: true,
+		},
+		{
+			name: "Edit deleted message",
+			msg:  goch.Message{Seq: 1, Deleted: true, Edited: 5},
+			ev:   goch.Message{Type: goch.EditMessage, Ref: 1, Text: "Hi", Time: 6},
+			want: goch.Message{Seq: 1, Deleted: true, Edited: 5},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if applied := tc.msg.Apply(&tc.ev); applied != tc.wantApply {
+				t.Errorf("expected applied to be %v but got %v", tc.wantApply, applied)
+			}
+			if !reflect.DeepEqual(tc.want, tc.msg) {
+				t.Errorf("expected msg %v but got %v", tc.want, tc.msg)
+			}
+		})
+	}
+}
+
+func TestTTL(t *testing.T) {
+	m := &goch.Message{Time: time.Now().UnixNano(), Text: "Hello"}
+	if err := m.SetTTL(-1); err == nil {
+		t.Error("expected error setting negative ttl")
+	}
+	if err := m.SetTTL(int64(goch.MaxTTL/time.Second) + 1); err == nil {
+		t.Error("expected error setting ttl above max")
+	}
+
+	if err := m.SetTTL(60); err != nil {
+		t.Fatal(err)
+	}
+	if m.IsExpired(time.Now()) || !m.IsExpired(time.Now().Add(time.Minute)) {
+		t.Errorf("expected message to expire in a minute, expires at %d", m.ExpiresAt)
+	}
+
+	if err := m.SetTTL(0); err != nil || m.ExpiresAt != 0 || m.IsExpired(time.Now().Add(goch.MaxTTL)) {
+		t.Error("expected message without ttl never to expire")
+	}
+
+	ev := &goch.Message{Type: goch.EditMessage, Ref: 1, Text: "Hi"}
+	ev.Expire()
+	if ev.Text != "" || !ev.Expired || ev.Deleted {
+		t.Errorf("expected only content of expired event to be removed, got %+v", ev)
+	}
+}
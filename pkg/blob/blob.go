@@ -0,0 +1,74 @@
+// Package blob provides storage for binary objects such as message attachments
+package blob
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+var keyRgx = regexp.MustCompile("^[a-zA-Z0-9_][a-zA-Z0-9_.-]*$")
+
+var errInvalidKey = errors.New("blob: invalid key")
+
+// Local represents blob store backed by local filesystem
+type Local struct {
+	dir string
+}
+
+// NewLocal creates new local filesystem blob store rooted at dir
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("blob: unable to create directory: %v", err)
+	}
+	return &Local{dir: dir}, nil
+}
+
+// Put stores content read from r under key
+func (l *Local) Put(key string, r io.Reader) error {
+	if !keyRgx.MatchString(key) {
+		return errInvalidKey
+	}
+
+	f, err := ioutil.TempFile(l.dir, ".upload-")
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), filepath.Join(l.dir, key))
+}
+
+// Get opens content stored under key
+func (l *Local) Get(key string) (io.ReadCloser, error) {
+	if !keyRgx.MatchString(key) {
+		return nil, errInvalidKey
+	}
+	return os.Open(filepath.Join(l.dir, key))
+}
+
+// Delete removes content stored under key. Deleting
+// content which does not exist is not an error.
+func (l *Local) Delete(key string) error {
+	if !keyRgx.MatchString(key) {
+		return errInvalidKey
+	}
+	if err := os.Remove(filepath.Join(l.dir, key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
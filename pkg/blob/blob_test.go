@@ -0,0 +1,59 @@
+package blob_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ribice/goch/pkg/blob"
+)
+
+func TestLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goch-blob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := blob.NewLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"", "..", ".upload-1", "../escape", "a/b"} {
+		if err := l.Put(key, bytes.NewBufferString("data")); err == nil {
+			t.Errorf("expected error for key %q but received nil", key)
+		}
+		if _, err := l.Get(key); err == nil {
+			t.Errorf("expected error for key %q but received nil", key)
+		}
+	}
+
+	if err := l.Put("chan.abc", bytes.NewBufferString("hello world")); err != nil {
+		t.Fatalf("did not expect error but received: %v", err)
+	}
+
+	rc, err := l.Get("chan.abc")
+	if err != nil {
+		t.Fatalf("did not expect error but received: %v", err)
+	}
+
+	bts, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(bts) != "hello world" {
+		t.Errorf("expected content %q but got %q (%v)", "hello world", bts, err)
+	}
+
+	if err := l.Delete("chan.abc"); err != nil {
+		t.Fatalf("did not expect error but received: %v", err)
+	}
+
+	if _, err := l.Get("chan.abc"); err == nil {
+		t.Error("expected error but received nil")
+	}
+
+	if err := l.Delete("chan.abc"); err != nil {
+		t.Errorf("expected deleting missing content to succeed, got %v", err)
+	}
+}
@@ -9,14 +9,27 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+const (
+	defaultAttachmentLimit int64 = 10 << 20
+	defaultBotRateLimit          = 60
+	defaultSearch                = "redis"
+)
+
 // Config represents application configuration
 type Config struct {
-	Server    *Server               `yaml:"server,omitempty"`
-	Redis     *Redis                `yaml:"redis,omitempty"`
-	NATS      *NATS                 `yaml:"nats,omitempty"`
-	Admin     *AdminAccount         `yaml:"-"`
-	Limits    map[goch.Limit][2]int `yaml:"limits,omitempty"`
-	LimitErrs map[goch.Limit]error  `yaml:"-"`
+	Server          *Server                     `yaml:"server,omitempty"`
+	Redis           *Redis                      `yaml:"redis,omitempty"`
+	NATS            *NATS                       `yaml:"nats,omitempty"`
+	Blob            *Blob                       `yaml:"blob,omitempty"`
+	Admin           *AdminAccount               `yaml:"-"`
+	Limits          map[goch.Limit][2]int       `yaml:"limits,omitempty"`
+	AttachmentLimit int64                       `yaml:"attachment_limit,omitempty"` // Max attachment size in bytes
+	Codec           string                      `yaml:"codec,omitempty"`            // Encoding of stored chats and messages
+	Moderation      map[string][]ModerationRule `yaml:"moderation,omitempty"`       // Rules per channel name, "*" applies to all channels
+	Webhooks        *Webhooks                   `yaml:"webhooks,omitempty"`
+	BotRateLimit    int                         `yaml:"bot_rate_limit,omitempty"` // Max messages a bot can post per minute
+	Search          string                      `yaml:"search,omitempty"`         // Message search index, memory or redis
+	LimitErrs       map[goch.Limit]error        `yaml:"-"`
 }
 
 // Server holds data necessery for server configuration
@@ -38,6 +51,38 @@ type NATS struct {
 	URL       string `yaml:"url"`
 }
 
+// Blob holds configuration of attachment storage
+type Blob struct {
+	Dir string `yaml:"dir"`
+}
+
+// Webhooks holds configuration of outgoing webhook delivery. Zero values are replaced with defaults.
+type Webhooks struct {
+	MaxAttempts int `yaml:"max_attempts"`
+	Backoff     int `yaml:"backoff"` // Delay before first retry in milliseconds, doubled on each next one
+	Timeout     int `yaml:"timeout"` // Delivery request timeout in milliseconds
+}
+
+// ModerationRule represents a single moderation rule applied to outgoing messages
+type ModerationRule struct {
+	Type     string   `yaml:"type"`   // words, regex, links or hook
+	Action   string   `yaml:"action"` // reject, redact or flag. Ignored by hook rules.
+	Reason   string   `yaml:"reason,omitempty"`
+	Words    []string `yaml:"words,omitempty"`
+	Pattern  string   `yaml:"pattern,omitempty"`
+	Allow    []string `yaml:"allow,omitempty"` // Hosts links are allowed to
+	URL      string   `yaml:"url,omitempty"`
+	Timeout  int      `yaml:"timeout,omitempty"`   // Hook timeout in milliseconds
+	FailOpen bool     `yaml:"fail_open,omitempty"` // Allow messages if hook is unavailable
+}
+
+var (
+	ruleTypes   = map[string]bool{"words": true, "regex": true, "links": true, "hook": true}
+	ruleActions = map[string]bool{"reject": true, "redact": true, "flag": true}
+)
+
+var searchIndexes = map[string]bool{"memory": true, "redis": true}
+
 // AdminAccount represents an account needed for creating new channels
 type AdminAccount struct {
 	Username string
@@ -63,6 +108,41 @@ func Load(path string) (*Config, error) {
 		cfg.Redis.Password = os.Getenv("REDIS_PASSWORD")
 	}
 
+	if cfg.Codec != "" {
+		if _, err := goch.CodecByName(cfg.Codec); err != nil {
+			return nil, fmt.Errorf("invalid codec %s: %v", cfg.Codec, err)
+		}
+	}
+
+	for ch, rules := range cfg.Moderation {
+		for _, r := range rules {
+			if !ruleTypes[r.Type] {
+				return nil, fmt.Errorf("invalid moderation rule type %s for channel %s", r.Type, ch)
+			}
+			if r.Type == "hook" {
+				if r.URL == "" {
+					return nil, fmt.Errorf("moderation hook for channel %s requires url", ch)
+				}
+			} else if !ruleActions[r.Action] {
+				return nil, fmt.Errorf("invalid moderation action %s for channel %s", r.Action, ch)
+			}
+		}
+	}
+
+	if cfg.AttachmentLimit <= 0 {
+		cfg.AttachmentLimit = defaultAttachmentLimit
+	}
+
+	if cfg.BotRateLimit <= 0 {
+		cfg.BotRateLimit = defaultBotRateLimit
+	}
+
+	if cfg.Search == "" {
+		cfg.Search = defaultSearch
+	} else if !searchIndexes[cfg.Search] {
+		return nil, fmt.Errorf("invalid search index %s", cfg.Search)
+	}
+
 	user, err := getEnv("ADMIN_USERNAME")
 	if err != nil {
 		return nil, err
@@ -58,6 +58,16 @@ func TestLoad(t *testing.T) {
 			path:    "testdata/limits.yaml",
 			wantErr: true,
 		},
+		{
+			name:    "Fail on invalid moderation rule",
+			path:    "testdata/moderation.yaml",
+			wantErr: true,
+		},
+		{
+			name:    "Fail on invalid search index",
+			path:    "testdata/search.yaml",
+			wantErr: true,
+		},
 		{
 			name:    "Missing env vars",
 			path:    "testdata/testdata.yaml",
@@ -92,7 +102,21 @@ func TestLoad(t *testing.T) {
 					Username: "admin",
 					Password: "password",
 				},
-				Limits:    lims,
+				Blob: &config.Blob{
+					Dir: "testdata/blobs",
+				},
+				Limits:          lims,
+				AttachmentLimit: 5242880,
+				BotRateLimit:    30,
+				Search:          "memory",
+				Moderation: map[string][]config.ModerationRule{
+					"*": {
+						{Type: "words", Action: "reject", Words: []string{"scam", "spam"}},
+					},
+					"general": {
+						{Type: "hook", URL: "http://localhost:9000/moderate", Timeout: 500},
+					},
+				},
 				LimitErrs: limErrs,
 			},
 			envData: &data{
@@ -5,9 +5,16 @@ import (
 	"io"
 	"time"
 
+	nats "github.com/nats-io/go-nats"
 	stan "github.com/nats-io/go-nats-streaming"
 )
 
+const (
+	replayInflight = 64
+	pubAckWait     = 10 * time.Second // Max time Send waits for message to be stored
+	lastSeqTimeout = 2 * time.Second  // Max time LastSeq waits for last message, as subj may have none
+)
+
 // Client represents NATS client
 type Client struct {
 	cn stan.Conn
@@ -15,22 +22,31 @@ type Client struct {
 
 // New initializes a connection to NATS server
 func New(clusterID, clientID, url string) (*Client, error) {
-	conn, err := stan.Connect(clusterID, clientID, stan.NatsURL(url))
+	conn, err := stan.Connect(clusterID, clientID, stan.NatsURL(url), stan.PubAckWait(pubAckWait))
 	if err != nil {
 		return nil, fmt.Errorf("error connecting to NATS: %v", err)
 	}
 	return &Client{cn: conn}, nil
 }
 
-// SubscribeQueue subscribers to a message queue
-func (c *Client) SubscribeQueue(subj string, f func(uint64, []byte)) (io.Closer, error) {
+// SubscribeGroup subscribes to subj as a member of durable queue group.
+// Each message is delivered to a single group member, and delivery resumes
+// from the last acknowledged message when group is resubscribed. Messages
+// are acknowledged once f returns, and redelivered if that takes over ackWait.
+// Only one message is in flight at a time, so messages waiting behind a slow
+// one are not redelivered while their ackWait passes.
+func (c *Client) SubscribeGroup(subj, group string, ackWait time.Duration, f func(uint64, []byte)) (io.Closer, error) {
 	return c.cn.QueueSubscribe(
 		subj,
-		"ingest",
+		group,
 		func(m *stan.Msg) {
 			f(m.Sequence, m.Data)
+			m.Ack()
 		},
+		stan.DurableName(group),
 		stan.SetManualAckMode(),
+		stan.AckWait(ackWait),
+		stan.MaxInflight(1),
 	)
 }
 
@@ -58,7 +74,76 @@ func (c *Client) SubscribeTimestamp(id string, nick string, t time.Time, f func(
 	)
 }
 
+// Replay delivers messages stored in subj starting at sequence start.
+// Messages are acknowledged once f returns, so f can block to
+// slow down delivery without them being redelivered.
+func (c *Client) Replay(subj string, start uint64, f func(uint64, []byte)) (io.Closer, error) {
+	return c.cn.Subscribe(
+		subj,
+		func(m *stan.Msg) {
+			f(m.Sequence, m.Data)
+			m.Ack()
+		},
+		stan.StartAtSequence(start),
+		stan.SetManualAckMode(),
+		stan.MaxInflight(replayInflight),
+	)
+}
+
+// LastSeq returns sequence of the last message stored in subj, or 0 if it has none
+func (c *Client) LastSeq(subj string) (uint64, error) {
+	seqs := make(chan uint64, 1)
+	sub, err := c.cn.Subscribe(
+		subj,
+		func(m *stan.Msg) {
+			select {
+			case seqs <- m.Sequence:
+			default:
+			}
+		},
+		stan.StartWithLastReceived(),
+		stan.SetManualAckMode(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	defer sub.Close()
+
+	select {
+	case seq := <-seqs:
+		return seq, nil
+	case <-time.After(lastSeqTimeout):
+		return 0, nil
+	}
+}
+
 // Send publishes new message
 func (c *Client) Send(id string, msg []byte) error {
 	return c.cn.Publish(id, msg)
 }
+
+// Publish publishes new message over core NATS. Unlike Send,
+// published messages are not persisted and can't be replayed.
+func (c *Client) Publish(subj string, msg []byte) error {
+	return c.cn.NatsConn().Publish(subj, msg)
+}
+
+// Subscribe subscribes to messages published with Publish
+func (c *Client) Subscribe(subj string, f func([]byte)) (io.Closer, error) {
+	sub, err := c.cn.NatsConn().Subscribe(subj, func(m *nats.Msg) {
+		f(m.Data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return subscription{sub}, nil
+}
+
+type subscription struct {
+	*nats.Subscription
+}
+
+func (s subscription) Close() error {
+	return s.Unsubscribe()
+}
@@ -1,8 +1,12 @@
 package redis
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/vmihailenco/msgpack"
 
@@ -12,12 +16,45 @@ import (
 
 const (
 	chanListKey             = "channel.list"
+	webhookChanListKey      = "webhook.channel.list"
+	ingestChanListKey       = "ingest.channel.list"
+	scheduledDueKey         = "scheduled.due"
+	scheduledClaimedKey     = "scheduled.claimed"
+	expiringKey             = "expiring"
+	expiringClaimedKey      = "expiring.claimed"
 	historyPrefix           = "history"
 	chatPrefix              = "chat"
+	threadPrefix            = "thread"
+	repliesPrefix           = "replies"
+	reactionsPrefix         = "reactions"
+	attachmentsPrefix       = "attachments"
+	attachmentMsgsPrefix    = "attachments.msgs"
+	attachmentRefsPrefix    = "attachments.refs"
+	pendingAttachmentsKey   = "attachments.pending"
+	invitesPrefix           = "invites"
 	chatLastSeqPrefix       = "last_seq"
+	chatActivityPrefix      = "last_activity"
 	chatClientLastSeqPrefix = "client.last_seq"
+	chatClientMentionPrefix = "client.mentions"
+	directListPrefix        = "direct.list"
+	accountPrefix           = "account"
+	accountChannelsPrefix   = "account.channels"
+	presencePrefix          = "presence"
+	presenceConnsPrefix     = "presence.conns"
+	pinsPrefix              = "pins"
+	webhooksPrefix          = "webhooks"
+	deadLettersPrefix       = "deadletters"
+	rateLimitPrefix         = "ratelimit"
+	scheduledPrefix         = "scheduled"
+	scheduledSentPrefix     = "scheduled.sent"
+	searchDocsPrefix        = "search.docs"
+	searchSeqsPrefix        = "search.seqs"
+	searchTermsPrefix       = "search.terms"
 
 	maxHistorySize int64 = 1000
+	maxDeadLetters int64 = 1000
+	maxSearchDocs  int64 = 10000
+	maxTxRetries         = 5
 )
 
 // Client represents Redis client
@@ -50,7 +87,16 @@ func (s *Client) Get(id string) (*goch.Chat, error) {
 		return nil, err
 	}
 
-	return goch.DecodeChat(val)
+	ch, err := goch.DecodeChat(val)
+	if err != nil {
+		return nil, err
+	}
+
+	if t, err := s.cl.Get(chatActivityID(id)).Int64(); err == nil {
+		ch.LastActivity = t
+	}
+
+	return ch, nil
 }
 
 // GetRecent returns list of recent messages, and sequence until last message
@@ -69,6 +115,160 @@ func (s *Client) GetRecent(id string, n int64) ([]goch.Message, uint64, error) {
 		return nil, 0, nil
 	}
 
+	msgs, seq := decodeMessages(data)
+
+	seqs := make([]uint64, len(msgs))
+	for i := range msgs {
+		seqs[i] = msgs[i].Seq
+	}
+
+	if counts, err := s.ReplyCounts(id, seqs); err == nil {
+		for i := range msgs {
+			msgs[i].Replies = counts[msgs[i].Seq]
+		}
+	}
+
+	s.fillReactions(id, msgs)
+
+	return msgs, (seq + 1), nil
+}
+
+// GetThread returns replies to message with parent sequence
+func (s *Client) GetThread(id string, parent uint64) ([]goch.Message, error) {
+	data, err := s.cl.LRange(chatThreadID(id, parent), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	msgs, _ := decodeMessages(data)
+	s.fillReactions(id, msgs)
+
+	return msgs, nil
+}
+
+// ReplyCounts returns number of replies for each of provided root
+// messages. Deleted and expired replies are not counted.
+func (s *Client) ReplyCounts(id string, seqs []uint64) (map[uint64]uint64, error) {
+	counts := make(map[uint64]uint64)
+	if len(seqs) == 0 {
+		return counts, nil
+	}
+
+	pipe := s.cl.Pipeline()
+	cmds := make([]*redis.IntCmd, len(seqs))
+	for i, seq := range seqs {
+		cmds[i] = pipe.SCard(chatRepliesID(id, seq))
+	}
+
+	if _, err := pipe.Exec(); err != nil {
+		return nil, err
+	}
+
+	for i, cmd := range cmds {
+		if n := cmd.Val(); n > 0 {
+			counts[seqs[i]] = uint64(n)
+		}
+	}
+
+	return counts, nil
+}
+
+// React adds or removes reaction on a message referenced by ev
+func (s *Client) React(id string, ev *goch.Message) error {
+	idx, key := chatReactionsID(id, ev.Ref), chatReactionID(id, ev.Ref, ev.Text)
+
+	if ev.Type == goch.ReactMessage {
+		pipe := s.cl.TxPipeline()
+		pipe.SAdd(idx, ev.Text)
+		pipe.SAdd(key, ev.FromUID)
+		_, err := pipe.Exec()
+		return err
+	}
+
+	if err := s.cl.SRem(key, ev.FromUID).Err(); err != nil {
+		return err
+	}
+
+	n, err := s.cl.SCard(key).Result()
+	if err != nil || n > 0 {
+		return err
+	}
+
+	return s.cl.SRem(idx, ev.Text).Err()
+}
+
+// Reactions returns reaction summary for each of provided messages
+func (s *Client) Reactions(id string, seqs []uint64) (map[uint64][]goch.Reaction, error) {
+	reactions := make(map[uint64][]goch.Reaction)
+	if len(seqs) == 0 {
+		return reactions, nil
+	}
+
+	pipe := s.cl.Pipeline()
+	emojis := make([]*redis.StringSliceCmd, len(seqs))
+	for i, seq := range seqs {
+		emojis[i] = pipe.SMembers(chatReactionsID(id, seq))
+	}
+	if _, err := pipe.Exec(); err != nil {
+		return nil, err
+	}
+
+	uids := make(map[uint64]map[string]*redis.StringSliceCmd)
+	for i, seq := range seqs {
+		for _, e := range emojis[i].Val() {
+			if uids[seq] == nil {
+				uids[seq] = make(map[string]*redis.StringSliceCmd)
+			}
+			uids[seq][e] = pipe.SMembers(chatReactionID(id, seq, e))
+		}
+	}
+
+	if len(uids) == 0 {
+		return reactions, nil
+	}
+
+	if _, err := pipe.Exec(); err != nil {
+		return nil, err
+	}
+
+	for seq, es := range uids {
+		for e, cmd := range es {
+			if len(cmd.Val()) == 0 {
+				continue
+			}
+			sort.Strings(cmd.Val())
+			reactions[seq] = append(reactions[seq], goch.Reaction{Emoji: e, Count: len(cmd.Val()), UIDs: cmd.Val()})
+		}
+		sort.Slice(reactions[seq], func(i, j int) bool {
+			ri, rj := reactions[seq][i], reactions[seq][j]
+			return ri.Count > rj.Count || (ri.Count == rj.Count && ri.Emoji < rj.Emoji)
+		})
+	}
+
+	return reactions, nil
+}
+
+func (s *Client) fillReactions(id string, msgs []goch.Message) {
+	seqs := make([]uint64, len(msgs))
+	for i := range msgs {
+		seqs[i] = msgs[i].Seq
+	}
+
+	reactions, err := s.Reactions(id, seqs)
+	if err != nil {
+		return
+	}
+
+	for i := range msgs {
+		msgs[i].Reactions = reactions[msgs[i].Seq]
+	}
+}
+
+func decodeMessages(data []string) ([]goch.Message, uint64) {
 	var seq uint64
 	msgs := make([]goch.Message, len(data))
 
@@ -77,29 +277,329 @@ func (s *Client) GetRecent(id string, n int64) ([]goch.Message, uint64, error) {
 		if err != nil {
 			msg.Text = "message unavailable!"
 		} else {
-			seq = msgs[i].Seq
+			seq = msg.Seq
 		}
+		msgs[i] = *msg
 	}
 
-	return msgs, (seq + 1), nil
+	return msgs, seq
 }
 
-// AppendMessage adds new message
+// appendMessageScript appends message to history and records its sequence as
+// chat's last, unless a message at the same or later sequence was appended
+var appendMessageScript = redis.NewScript(`
+local last = tonumber(redis.call('GET', KEYS[2]) or '0')
+if tonumber(ARGV[2]) <= last then
+	return 0
+end
+redis.call('RPUSH', KEYS[1], ARGV[1])
+redis.call('LTRIM', KEYS[1], -tonumber(ARGV[3]), -1)
+redis.call('SET', KEYS[2], ARGV[2])
+return 1
+`)
+
+// AppendMessage adds new message. Redelivered messages
+// are skipped, so they are kept in history once.
 func (s *Client) AppendMessage(id string, m *goch.Message) error {
 	data, err := m.Encode()
 	if err != nil {
 		data, _ = msgpack.Marshal([]byte(`{"text":"message unavailable, unable to encode","from":"goch/client"}`))
 	}
 
-	key := chatHistoryID(id)
+	err = appendMessageScript.Run(
+		s.cl,
+		[]string{chatHistoryID(id), chatLastSeqID(id)},
+		data, m.Seq, maxHistorySize,
+	).Err()
+	if err != nil {
+		return err
+	}
+
+	// Attachments are referenced once, even if message was redelivered
+	// after it was appended but before they were referenced
+	if err := s.refAttachments(id, m); err != nil {
+		return err
+	}
+
+	s.cl.Set(chatActivityID(id), m.Time, 0)
+
+	return nil
+}
+
+// AppendReply adds new reply to a thread and counts it towards thread's
+// root message. Redelivered replies are skipped, so they are counted once.
+func (s *Client) AppendReply(id string, m *goch.Message) error {
+	data, err := m.Encode()
+	if err != nil {
+		return err
+	}
+
+	key, replies := chatThreadID(id, m.Parent), chatRepliesID(id, m.Parent)
+
+	// Redelivered replies are already kept in thread
+	appended, err := s.cl.SIsMember(replies, m.Seq).Result()
+	if err != nil || appended {
+		return err
+	}
+
+	pipe := s.cl.TxPipeline()
+	pipe.RPush(key, data)
+	pipe.LTrim(key, -maxHistorySize, -1)
+	pipe.SAdd(replies, m.Seq)
 
-	if err := s.cl.RPush(key, data).Err(); err != nil {
+	if _, err = pipe.Exec(); err != nil {
+		return err
+	}
+
+	if err = s.refAttachments(id, m); err != nil {
 		return err
 	}
 
 	s.updateChannelSeq(id, m.Seq)
+	s.cl.Set(chatActivityID(id), m.Time, 0)
+
+	return nil
+}
+
+// refAttachmentsScript records attachments referenced by a message, counting
+// each message once so redelivered messages are not counted again. Referenced
+// attachments are no longer pending, so they are kept past upload TTL.
+var refAttachmentsScript = redis.NewScript(`
+if redis.call('HSETNX', KEYS[1], ARGV[1], ARGV[2]) == 0 then
+	return 0
+end
+for id in string.gmatch(ARGV[2], '%S+') do
+	redis.call('HINCRBY', KEYS[2], id, 1)
+	redis.call('ZREM', KEYS[3], ARGV[3] .. '.' .. id)
+end
+return 1
+`)
+
+// refAttachments records attachments referenced by message m, so they
+// are kept until all messages referencing them are deleted or expired
+func (s *Client) refAttachments(id string, m *goch.Message) error {
+	if len(m.Attachments) == 0 {
+		return nil
+	}
+
+	atts := make([]string, len(m.Attachments))
+	for i, a := range m.Attachments {
+		atts[i] = a.ID
+	}
+
+	return refAttachmentsScript.Run(
+		s.cl,
+		[]string{chatAttachmentMsgsID(id), chatAttachmentRefsID(id), pendingAttachmentsKey},
+		m.Seq, strings.Join(atts, " "), id,
+	).Err()
+}
+
+// releaseAttachmentsScript drops references of a message to its attachments,
+// removing metadata of attachments no longer referenced by any message
+var releaseAttachmentsScript = redis.NewScript(`
+local atts = redis.call('HGET', KEYS[1], ARGV[1])
+local released = {}
+if not atts then
+	return released
+end
+redis.call('HDEL', KEYS[1], ARGV[1])
+for id in string.gmatch(atts, '%S+') do
+	if redis.call('HINCRBY', KEYS[2], id, -1) <= 0 then
+		redis.call('HDEL', KEYS[2], id)
+		redis.call('HDEL', KEYS[3], id)
+		table.insert(released, id)
+	end
+end
+return released
+`)
+
+// ReleaseAttachments drops references of deleted or expired message seq
+// to its attachments, regardless of whether it is still kept in history.
+// Returns IDs of attachments no longer referenced by any message, whose
+// metadata was removed so they are not served, and content can be deleted.
+func (s *Client) ReleaseAttachments(id string, seq uint64) ([]string, error) {
+	res, err := releaseAttachmentsScript.Run(
+		s.cl,
+		[]string{chatAttachmentMsgsID(id), chatAttachmentRefsID(id), chatAttachmentsID(id)},
+		seq,
+	).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	vals, _ := res.([]interface{})
+	ids := make([]string, 0, len(vals))
+	for _, v := range vals {
+		if id, ok := v.(string); ok {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// UpdateMessage applies edit or delete event to a message in chat history.
+// Messages no longer kept in history are left as is. Content of expired
+// messages is removed from webhook dead letters as well.
+func (s *Client) UpdateMessage(id string, ev *goch.Message) error {
+	key := chatHistoryID(id)
+	if ev.IsReply() {
+		key = chatThreadID(id, ev.Parent)
+	}
+
+	if err := s.updateMessage(key, ev.Ref, func(m *goch.Message) bool { return m.Apply(ev) }); err != nil {
+		return err
+	}
 
-	return s.cl.LTrim(key, -maxHistorySize, -1).Err()
+	if ev.Type == goch.ExpireMessage {
+		if err := s.expireDeadLetters(id, ev.Ref); err != nil {
+			return err
+		}
+	}
+
+	if ev.IsReply() {
+		if ev.Type == goch.DeleteMessage || ev.Type == goch.ExpireMessage {
+			return s.cl.SRem(chatRepliesID(id, ev.Parent), ev.Ref).Err()
+		}
+		return nil
+	}
+
+	return s.updatePin(id, ev)
+}
+
+var errPinUnavailable = errors.New("redis: message is no longer kept in history")
+
+// Pin pins or unpins message referenced by ev. Pinned messages are copied
+// out of chat history, so they are kept after history gets trimmed.
+// Only messages still kept in history can be pinned.
+func (s *Client) Pin(id string, ev *goch.Message) error {
+	field := strconv.FormatUint(ev.Ref, 10)
+
+	if ev.Type == goch.UnpinMessage {
+		return s.cl.HDel(chatPinsID(id), field).Err()
+	}
+
+	data, err := s.cl.LRange(chatHistoryID(id), 0, -1).Result()
+	if err != nil {
+		return err
+	}
+
+	for i := len(data) - 1; i >= 0; i-- {
+		msg, err := goch.DecodeMsg([]byte(data[i]))
+		if err != nil || msg.Seq != ev.Ref {
+			continue
+		}
+		if msg.Deleted {
+			return nil
+		}
+		return s.cl.HSet(chatPinsID(id), field, data[i]).Err()
+	}
+
+	return errPinUnavailable
+}
+
+// updatePin applies edit or delete event to pinned copy of a message.
+// Deleted and expired messages are unpinned.
+func (s *Client) updatePin(id string, ev *goch.Message) error {
+	field := strconv.FormatUint(ev.Ref, 10)
+
+	if ev.Type == goch.DeleteMessage || ev.Type == goch.ExpireMessage {
+		return s.cl.HDel(chatPinsID(id), field).Err()
+	}
+
+	val, err := s.cl.HGet(chatPinsID(id), field).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	msg, err := goch.DecodeMsg([]byte(val))
+	if err != nil || !msg.Apply(ev) {
+		return err
+	}
+
+	bts, err := msg.Encode()
+	if err != nil {
+		return err
+	}
+
+	return s.cl.HSet(chatPinsID(id), field, bts).Err()
+}
+
+// GetPinned returns pinned messages ordered by sequence
+func (s *Client) GetPinned(id string) ([]goch.Message, error) {
+	vals, err := s.cl.HVals(chatPinsID(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(vals) == 0 {
+		return nil, nil
+	}
+
+	msgs, _ := decodeMessages(vals)
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].Seq < msgs[j].Seq })
+
+	seqs := make([]uint64, len(msgs))
+	for i := range msgs {
+		seqs[i] = msgs[i].Seq
+	}
+
+	if counts, err := s.ReplyCounts(id, seqs); err == nil {
+		for i := range msgs {
+			msgs[i].Replies = counts[msgs[i].Seq]
+		}
+	}
+
+	s.fillReactions(id, msgs)
+
+	return msgs, nil
+}
+
+// updateMessage updates message with provided seq stored in list under key.
+// Update is retried if the list changes in the meantime.
+func (s *Client) updateMessage(key string, seq uint64, update func(*goch.Message) bool) error {
+	fn := func(tx *redis.Tx) error {
+		data, err := tx.LRange(key, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+
+		for i := len(data) - 1; i >= 0; i-- {
+			msg, err := goch.DecodeMsg([]byte(data[i]))
+			if err != nil || msg.Seq != seq {
+				continue
+			}
+
+			if !update(msg) {
+				return nil
+			}
+
+			bts, err := msg.Encode()
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+				pipe.LSet(key, int64(i), bts)
+				return nil
+			})
+			return err
+		}
+
+		return nil
+	}
+
+	for i := 0; i < maxTxRetries; i++ {
+		err := s.cl.Watch(fn, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+
+	return redis.TxFailedErr
 }
 
 func (s *Client) updateChannelSeq(id string, seq uint64) {
@@ -140,7 +640,78 @@ func (s *Client) UpdateLastClientSeq(uid string, id string, seq uint64) {
 		return
 	}
 
-	s.cl.Set(chatClientLastSeqID(uid, id), seq, 0)
+	pipe := s.cl.TxPipeline()
+	pipe.Set(chatClientLastSeqID(uid, id), seq, 0)
+	pipe.ZRemRangeByScore(chatClientMentionID(uid, id), "-inf", strconv.FormatUint(seq, 10))
+	pipe.Exec()
+}
+
+// ReadReceipts returns last read message sequence of provided chat members.
+// Members who haven't read any messages are omitted.
+func (s *Client) ReadReceipts(id string, uids []string) (map[string]uint64, error) {
+	rs := make(map[string]uint64)
+	if len(uids) == 0 {
+		return rs, nil
+	}
+
+	keys := make([]string, len(uids))
+	for i, uid := range uids {
+		keys[i] = chatClientLastSeqID(uid, id)
+	}
+
+	vals, err := s.cl.MGet(keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, v := range vals {
+		v, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if seq, err := strconv.ParseUint(v, 10, 64); err == nil && seq > 0 {
+			rs[uids[i]] = seq
+		}
+	}
+
+	return rs, nil
+}
+
+// AddMentions records message as unread mention for each mentioned user
+func (s *Client) AddMentions(id string, m *goch.Message) error {
+	pipe := s.cl.TxPipeline()
+	for _, uid := range m.Mentions {
+		pipe.ZAdd(chatClientMentionID(uid, id), redis.Z{Score: float64(m.Seq), Member: m.Seq})
+	}
+	_, err := pipe.Exec()
+	return err
+}
+
+// GetMentionCount returns number of unread messages mentioning the user
+func (s *Client) GetMentionCount(uid string, id string) uint64 {
+	val, err := s.cl.Get(chatClientLastSeqID(uid, id)).Result()
+	if err != nil {
+		if err != redis.Nil {
+			return 0
+		}
+		val = "0"
+	}
+
+	n, err := s.cl.ZCount(chatClientMentionID(uid, id), "("+val, "+inf").Result()
+	if err != nil {
+		return 0
+	}
+
+	return uint64(n)
+}
+
+// LastSeq returns sequence of the last message ingested in chat
+func (s *Client) LastSeq(id string) (uint64, error) {
+	seq, err := s.cl.Get(chatLastSeqID(id)).Uint64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return seq, err
 }
 
 // GetUnreadCount returns number of unread messages
@@ -177,30 +748,766 @@ func (s *Client) GetUnreadCount(uid string, id string) uint64 {
 	return uint64(delta)
 }
 
-// Save saves new chat
+// Save saves chat. Saves are optimistic: ErrChatConflict is returned if
+// chat was saved by someone else since it was loaded, so concurrent
+// updates (e.g. a ban and a join) can not silently undo each other.
 func (s *Client) Save(ct *goch.Chat) error {
-	data, err := ct.Encode()
-	if err != nil {
-		return err
+	key := chatID(ct.Name)
+
+	fn := func(tx *redis.Tx) error {
+		val, err := tx.Get(key).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+
+		if err == nil {
+			stored, err := goch.DecodeChat(val)
+			if err != nil {
+				return err
+			}
+			if stored.Version != ct.Version {
+				return goch.ErrChatConflict
+			}
+		}
+
+		saved := *ct
+		saved.Version++
+		data, err := saved.Encode()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+			pipe.Set(key, data, 0)
+
+			// Save only public channels
+			if ct.Secret == "" && !ct.Direct {
+				pipe.SAdd(chanListKey, ct.Name)
+			}
+
+			if ct.Direct {
+				for uid := range ct.Members {
+					pipe.SAdd(directListID(uid), ct.Name)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		ct.Version = saved.Version
+		return nil
 	}
 
-	pipe := s.cl.TxPipeline()
-	pipe.Set(chatID(ct.Name), data, 0)
+	err := s.cl.Watch(fn, key)
+	if err == redis.TxFailedErr {
+		return goch.ErrChatConflict
+	}
+	return err
+}
 
-	// Save only public channels
-	if ct.Secret == "" {
-		pipe.SAdd(chanListKey, ct.Name)
+// SaveAttachment saves attachment metadata for a chat. Attachment
+// is pending until it is sent with a message, and is claimed by
+// ClaimUnsentAttachments if it is not sent within goch.UploadTTL.
+func (s *Client) SaveAttachment(id string, a *goch.Attachment) error {
+	data, err := a.Encode()
+	if err != nil {
+		return err
 	}
 
+	pipe := s.cl.TxPipeline()
+	pipe.HSet(chatAttachmentsID(id), a.ID, data)
+	pipe.ZAdd(pendingAttachmentsKey, redis.Z{
+		Score:  float64(unixMilli(time.Now().Add(goch.UploadTTL).UnixNano())),
+		Member: chatMember(id, a.ID),
+	})
 	_, err = pipe.Exec()
 	return err
 }
 
-// ListChannels returns list of all channels
-func (s *Client) ListChannels() ([]string, error) {
+// claimUnsentScript claims pending attachment whose upload TTL or claim has
+// expired with a new lease deadline, removing its metadata so it is no longer
+// served or sent. Attachments sent in the meantime are no longer pending.
+var claimUnsentScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not score or tonumber(score) > tonumber(ARGV[3]) then
+	return 0
+end
+if redis.call('HEXISTS', KEYS[2], ARGV[2]) == 1 then
+	redis.call('ZREM', KEYS[1], ARGV[1])
+	return 0
+end
+redis.call('HDEL', KEYS[3], ARGV[2])
+redis.call('ZADD', KEYS[1], ARGV[4], ARGV[1])
+return 1
+`)
+
+// ClaimUnsentAttachments claims up to n attachments uploaded more than
+// goch.UploadTTL before t which were not sent with any message, returning
+// their IDs per chat. Claimed attachments which are not completed within
+// lease are claimed again.
+func (s *Client) ClaimUnsentAttachments(t time.Time, lease time.Duration, n int64) (map[string][]string, error) {
+	now := unixMilli(t.UnixNano())
+	members, err := s.cl.ZRangeByScore(pendingAttachmentsKey, redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now, 10),
+		Count: n,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	atts := make(map[string][]string)
+	for _, m := range members {
+		id, fields := parseChatMember(m)
+		if len(fields) != 1 {
+			s.cl.ZRem(pendingAttachmentsKey, m)
+			continue
+		}
+
+		claimed, err := claimUnsentScript.Run(
+			s.cl,
+			[]string{pendingAttachmentsKey, chatAttachmentRefsID(id), chatAttachmentsID(id)},
+			m, fields[0], now, now+int64(lease/time.Millisecond),
+		).Int64()
+		if err != nil || claimed == 0 {
+			continue
+		}
+
+		atts[id] = append(atts[id], fields[0])
+	}
+
+	return atts, nil
+}
+
+// CompleteUnsentAttachment removes claimed attachment once its content was deleted
+func (s *Client) CompleteUnsentAttachment(id, attID string) error {
+	return s.cl.ZRem(pendingAttachmentsKey, chatMember(id, attID)).Err()
+}
+
+// GetAttachment returns attachment metadata stored for a chat
+func (s *Client) GetAttachment(id, attID string) (*goch.Attachment, error) {
+	val, err := s.cl.HGet(chatAttachmentsID(id), attID).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return goch.DecodeAttachment([]byte(val))
+}
+
+// AttachmentReferenced reports whether chat's attachment is
+// referenced by any message which was not deleted or expired
+func (s *Client) AttachmentReferenced(id, attID string) (bool, error) {
+	return s.cl.HExists(chatAttachmentRefsID(id), attID).Result()
+}
+
+// SaveInvite saves channel invite
+func (s *Client) SaveInvite(inv *goch.Invite) error {
+	data, err := inv.Encode()
+	if err != nil {
+		return err
+	}
+	return s.cl.HSet(chatInvitesID(inv.Channel), inv.Token, data).Err()
+}
+
+// GetInvite returns channel invite
+func (s *Client) GetInvite(id, token string) (*goch.Invite, error) {
+	val, err := s.cl.HGet(chatInvitesID(id), token).Result()
+	if err != nil {
+		return nil, err
+	}
+	return goch.DecodeInvite([]byte(val))
+}
+
+// ListInvites returns all invites issued for a channel
+func (s *Client) ListInvites(id string) ([]*goch.Invite, error) {
+	vals, err := s.cl.HVals(chatInvitesID(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var invs []*goch.Invite
+	for _, v := range vals {
+		inv, err := goch.DecodeInvite([]byte(v))
+		if err != nil {
+			continue
+		}
+		invs = append(invs, inv)
+	}
+
+	sort.Slice(invs, func(i, j int) bool { return invs[i].CreatedAt < invs[j].CreatedAt })
+
+	return invs, nil
+}
+
+// UseInvite atomically records use of a channel invite
+func (s *Client) UseInvite(id, token string) (*goch.Invite, error) {
+	return s.updateInvite(id, token, func(inv *goch.Invite) error { return inv.Use(time.Now()) })
+}
+
+// ReleaseInvite atomically reverts a use of a channel invite
+func (s *Client) ReleaseInvite(id, token string) error {
+	_, err := s.updateInvite(id, token, func(inv *goch.Invite) error {
+		inv.Release()
+		return nil
+	})
+	return err
+}
+
+// RevokeInvite revokes a channel invite
+func (s *Client) RevokeInvite(id, token string) error {
+	_, err := s.updateInvite(id, token, func(inv *goch.Invite) error {
+		inv.Revoked = true
+		return nil
+	})
+	if err == redis.Nil {
+		return goch.ErrInviteNotFound
+	}
+	return err
+}
+
+// updateInvite atomically applies update to a stored invite
+func (s *Client) updateInvite(id, token string, update func(*goch.Invite) error) (*goch.Invite, error) {
+	key := chatInvitesID(id)
+
+	var inv *goch.Invite
+	fn := func(tx *redis.Tx) error {
+		val, err := tx.HGet(key, token).Result()
+		if err != nil {
+			return err
+		}
+
+		if inv, err = goch.DecodeInvite([]byte(val)); err != nil {
+			return err
+		}
+
+		if err = update(inv); err != nil {
+			return err
+		}
+
+		data, err := inv.Encode()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+			pipe.HSet(key, token, data)
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < maxTxRetries; i++ {
+		err := s.cl.Watch(fn, key)
+		if err != redis.TxFailedErr {
+			return inv, err
+		}
+	}
+
+	return nil, redis.TxFailedErr
+}
+
+var errWebhookNotFound = errors.New("redis: webhook does not exist")
+
+// SaveWebhook saves channel's outgoing webhook
+func (s *Client) SaveWebhook(wh *goch.Webhook) error {
+	data, err := wh.Encode()
+	if err != nil {
+		return err
+	}
+
+	pipe := s.cl.TxPipeline()
+	pipe.HSet(chatWebhooksID(wh.Channel), wh.ID, data)
+	pipe.SAdd(webhookChanListKey, wh.Channel)
+	_, err = pipe.Exec()
+	return err
+}
+
+// ListWebhooks returns all webhooks of a channel
+func (s *Client) ListWebhooks(id string) ([]*goch.Webhook, error) {
+	vals, err := s.cl.HVals(chatWebhooksID(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var whs []*goch.Webhook
+	for _, v := range vals {
+		wh, err := goch.DecodeWebhook([]byte(v))
+		if err != nil {
+			continue
+		}
+		whs = append(whs, wh)
+	}
+
+	sort.Slice(whs, func(i, j int) bool { return whs[i].CreatedAt < whs[j].CreatedAt })
+
+	return whs, nil
+}
+
+// DeleteWebhook deletes channel's webhook
+func (s *Client) DeleteWebhook(id, whID string) error {
+	n, err := s.cl.HDel(chatWebhooksID(id), whID).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errWebhookNotFound
+	}
+
+	if left, err := s.cl.HLen(chatWebhooksID(id)).Result(); err == nil && left == 0 {
+		s.cl.SRem(webhookChanListKey, id)
+	}
+
+	return nil
+}
+
+// ListWebhookChannels returns list of channels having webhooks
+func (s *Client) ListWebhookChannels() ([]string, error) {
+	return s.cl.SMembers(webhookChanListKey).Result()
+}
+
+// AddIngestChannel records chat id as one whose messages are ingested
+func (s *Client) AddIngestChannel(id string) error {
+	return s.cl.SAdd(ingestChanListKey, id).Err()
+}
+
+// ListIngestChannels returns list of chats whose messages are ingested
+func (s *Client) ListIngestChannels() ([]string, error) {
+	return s.cl.SMembers(ingestChanListKey).Result()
+}
+
+// AddDeadLetter records message which could not be delivered to a webhook.
+// Only the most recent maxDeadLetters are kept.
+func (s *Client) AddDeadLetter(id string, dl *goch.DeadLetter) error {
+	data, err := dl.Encode()
+	if err != nil {
+		return err
+	}
+
+	pipe := s.cl.TxPipeline()
+	pipe.LPush(chatDeadLettersID(id), data)
+	pipe.LTrim(chatDeadLettersID(id), 0, maxDeadLetters-1)
+	_, err = pipe.Exec()
+	return err
+}
+
+// expireDeadLetters removes content of expired message seq, and
+// of events referencing it, from chat's dead letters
+func (s *Client) expireDeadLetters(id string, seq uint64) error {
+	key := chatDeadLettersID(id)
+
+	fn := func(tx *redis.Tx) error {
+		data, err := tx.LRange(key, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+
+		expired := make(map[int64][]byte)
+		for i, v := range data {
+			dl, err := goch.DecodeDeadLetter([]byte(v))
+			if err != nil || dl.Message == nil || dl.Message.Expired {
+				continue
+			}
+			if m := dl.Message; m.Seq != seq && !(m.IsEvent() && m.Ref == seq) {
+				continue
+			}
+
+			dl.Message.Expire()
+			bts, err := dl.Encode()
+			if err != nil {
+				return err
+			}
+			expired[int64(i)] = bts
+		}
+
+		if len(expired) == 0 {
+			return nil
+		}
+
+		_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+			for i, bts := range expired {
+				pipe.LSet(key, i, bts)
+			}
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < maxTxRetries; i++ {
+		err := s.cl.Watch(fn, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+
+	return redis.TxFailedErr
+}
+
+// ListDeadLetters returns undelivered webhook messages, most recent first
+func (s *Client) ListDeadLetters(id string) ([]*goch.DeadLetter, error) {
+	vals, err := s.cl.LRange(chatDeadLettersID(id), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var dls []*goch.DeadLetter
+	for _, v := range vals {
+		dl, err := goch.DecodeDeadLetter([]byte(v))
+		if err != nil {
+			continue
+		}
+		dls = append(dls, dl)
+	}
+
+	return dls, nil
+}
+
+var errScheduledNotFound = errors.New("redis: scheduled message does not exist or is already being sent")
+
+// claimScript atomically moves due scheduled messages, along with ones whose
+// claim has expired, to the claimed set with a new lease deadline
+var claimScript = redis.NewScript(`
+local claimed = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+for _, m in ipairs(due) do
+	redis.call('ZREM', KEYS[1], m)
+	table.insert(claimed, m)
+end
+for _, m in ipairs(claimed) do
+	redis.call('ZADD', KEYS[2], ARGV[2], m)
+end
+return claimed
+`)
+
+// ScheduleMessage stores message to be sent at its scheduled time
+func (s *Client) ScheduleMessage(sm *goch.Scheduled) error {
+	data, err := sm.Encode()
+	if err != nil {
+		return err
+	}
+
+	pipe := s.cl.TxPipeline()
+	pipe.HSet(chatScheduledID(sm.Channel), sm.ID, data)
+	pipe.ZAdd(scheduledDueKey, redis.Z{Score: float64(unixMilli(sm.SendAt)), Member: chatMember(sm.Channel, sm.ID)})
+	_, err = pipe.Exec()
+	return err
+}
+
+// GetScheduled returns message scheduled in a chat
+func (s *Client) GetScheduled(id, smID string) (*goch.Scheduled, error) {
+	val, err := s.cl.HGet(chatScheduledID(id), smID).Result()
+	if err != nil {
+		return nil, err
+	}
+	return goch.DecodeScheduled([]byte(val))
+}
+
+// ListScheduled returns messages uid has scheduled in a chat, ordered by send time
+func (s *Client) ListScheduled(id, uid string) ([]*goch.Scheduled, error) {
+	vals, err := s.cl.HVals(chatScheduledID(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var sms []*goch.Scheduled
+	for _, v := range vals {
+		sm, err := goch.DecodeScheduled([]byte(v))
+		if err != nil || sm.Message.FromUID != uid {
+			continue
+		}
+		sms = append(sms, sm)
+	}
+
+	sort.Slice(sms, func(i, j int) bool { return sms[i].SendAt < sms[j].SendAt })
+
+	return sms, nil
+}
+
+// CancelScheduled cancels a scheduled message. Messages already
+// claimed for sending can no longer be cancelled.
+func (s *Client) CancelScheduled(id, smID string) error {
+	n, err := s.cl.ZRem(scheduledDueKey, chatMember(id, smID)).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errScheduledNotFound
+	}
+	return s.cl.HDel(chatScheduledID(id), smID).Err()
+}
+
+// ClaimScheduled claims up to n scheduled messages due at t for sending.
+// Claimed messages which are not completed within lease are claimed again.
+func (s *Client) ClaimScheduled(t time.Time, lease time.Duration, n int64) ([]*goch.Scheduled, error) {
+	now := unixMilli(t.UnixNano())
+	res, err := claimScript.Run(s.cl, []string{scheduledDueKey, scheduledClaimedKey}, now, now+int64(lease/time.Millisecond), n).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	members, ok := res.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected claim result %v", res)
+	}
+
+	var sms []*goch.Scheduled
+	for _, m := range members {
+		member, _ := m.(string)
+		id, fields := parseChatMember(member)
+		if len(fields) != 1 {
+			s.cl.ZRem(scheduledClaimedKey, member)
+			continue
+		}
+
+		sm, err := s.GetScheduled(id, fields[0])
+		if err == redis.Nil {
+			s.cl.ZRem(scheduledClaimedKey, member)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		sms = append(sms, sm)
+	}
+
+	return sms, nil
+}
+
+// CompleteScheduled removes claimed scheduled message once it was sent
+func (s *Client) CompleteScheduled(sm *goch.Scheduled) error {
+	pipe := s.cl.TxPipeline()
+	pipe.ZRem(scheduledClaimedKey, chatMember(sm.Channel, sm.ID))
+	pipe.HDel(chatScheduledID(sm.Channel), sm.ID)
+	_, err := pipe.Exec()
+	return err
+}
+
+// MarkScheduledSent marks claimed scheduled message as being sent, unless it
+// already was. Marker is kept for ttl, so a message whose claim expired after
+// it was sent is not sent again. Returns whether message was marked.
+func (s *Client) MarkScheduledSent(sm *goch.Scheduled, ttl time.Duration) (bool, error) {
+	return s.cl.SetNX(scheduledSentID(sm.Channel, sm.ID), unixMilli(time.Now().UnixNano()), ttl).Result()
+}
+
+// RetryScheduled stores attempts of claimed scheduled message which failed to
+// send, and clears its sent marker. Message is claimed again once its lease expires.
+func (s *Client) RetryScheduled(sm *goch.Scheduled) error {
+	data, err := sm.Encode()
+	if err != nil {
+		return err
+	}
+
+	pipe := s.cl.TxPipeline()
+	pipe.HSet(chatScheduledID(sm.Channel), sm.ID, data)
+	pipe.Del(scheduledSentID(sm.Channel, sm.ID))
+	_, err = pipe.Exec()
+	return err
+}
+
+// AddExpiring records message which should be expired at its ExpiresAt
+func (s *Client) AddExpiring(id string, m *goch.Message) error {
+	return s.cl.ZAdd(expiringKey, redis.Z{
+		Score:  float64(unixMilli(m.ExpiresAt)),
+		Member: chatMember(id, strconv.FormatUint(m.Seq, 10), strconv.FormatUint(m.Parent, 10)),
+	}).Err()
+}
+
+// ClaimExpired claims up to n messages expired at t, returning expire events
+// referencing them per chat. Claimed messages which are not completed
+// within lease are claimed again.
+func (s *Client) ClaimExpired(t time.Time, lease time.Duration, n int64) (map[string][]*goch.Message, error) {
+	now := unixMilli(t.UnixNano())
+	res, err := claimScript.Run(s.cl, []string{expiringKey, expiringClaimedKey}, now, now+int64(lease/time.Millisecond), n).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	members, ok := res.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected claim result %v", res)
+	}
+
+	evs := make(map[string][]*goch.Message)
+	for _, m := range members {
+		member, _ := m.(string)
+		id, fields := parseChatMember(member)
+		if len(fields) != 2 {
+			s.cl.ZRem(expiringClaimedKey, member)
+			continue
+		}
+		seq, _ := strconv.ParseUint(fields[0], 10, 64)
+		parent, _ := strconv.ParseUint(fields[1], 10, 64)
+
+		evs[id] = append(evs[id], &goch.Message{Type: goch.ExpireMessage, Ref: seq, Parent: parent})
+	}
+
+	return evs, nil
+}
+
+// CompleteExpired removes claimed expire event once message's tombstone was stored
+func (s *Client) CompleteExpired(id string, ev *goch.Message) error {
+	return s.cl.ZRem(expiringClaimedKey, chatMember(id, strconv.FormatUint(ev.Ref, 10), strconv.FormatUint(ev.Parent, 10))).Err()
+}
+
+// ListChannels returns list of all channels
+func (s *Client) ListChannels() ([]string, error) {
 	return s.cl.SMembers(chanListKey).Result()
 }
 
+// ListDirect returns list of private chats user is a member of
+func (s *Client) ListDirect(uid string) ([]string, error) {
+	return s.cl.SMembers(directListID(uid)).Result()
+}
+
+// SetPresence sets member's presence status in a chat, which expires after ttl
+// unless refreshed. Presence is shared between all goch instances.
+func (s *Client) SetPresence(id, uid string, st goch.Status, ttl time.Duration) error {
+	pipe := s.cl.TxPipeline()
+	pipe.Set(presenceID(id, uid), string(st), ttl)
+	pipe.Expire(presenceConnsID(id, uid), ttl)
+	_, err := pipe.Exec()
+	return err
+}
+
+// AddPresence sets member's presence status in a chat like SetPresence,
+// and counts another connection of member to it. Connection count
+// expires along with the status if connections are not closed cleanly.
+func (s *Client) AddPresence(id, uid string, st goch.Status, ttl time.Duration) error {
+	pipe := s.cl.TxPipeline()
+	pipe.Incr(presenceConnsID(id, uid))
+	pipe.Expire(presenceConnsID(id, uid), ttl)
+	pipe.Set(presenceID(id, uid), string(st), ttl)
+	_, err := pipe.Exec()
+	return err
+}
+
+// clearPresenceScript atomically decrements member's connection
+// count, removing their presence status once it reaches zero
+var clearPresenceScript = redis.NewScript(`
+if redis.call('DECR', KEYS[1]) > 0 then
+	return 0
+end
+redis.call('DEL', KEYS[1], KEYS[2])
+return 1
+`)
+
+// ClearPresence removes member's connection to a chat added by AddPresence,
+// and their presence status if it was the last one. Returns whether member
+// went offline.
+func (s *Client) ClearPresence(id, uid string) (bool, error) {
+	n, err := clearPresenceScript.Run(s.cl, []string{presenceConnsID(id, uid), presenceID(id, uid)}).Int64()
+	return n == 1, err
+}
+
+// Presence returns presence status of provided chat members.
+// Members without a status are offline.
+func (s *Client) Presence(id string, uids []string) (map[string]goch.Status, error) {
+	ps := make(map[string]goch.Status, len(uids))
+	if len(uids) == 0 {
+		return ps, nil
+	}
+
+	keys := make([]string, len(uids))
+	for i, uid := range uids {
+		keys[i] = presenceID(id, uid)
+	}
+
+	vals, err := s.cl.MGet(keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, v := range vals {
+		st := goch.OfflineStatus
+		if v, ok := v.(string); ok {
+			st = goch.Status(v)
+		}
+		ps[uids[i]] = st
+	}
+
+	return ps, nil
+}
+
+// AllowPost reports whether uid is allowed to post another message in a chat,
+// counting posts in fixed windows shared between all goch instances
+func (s *Client) AllowPost(id, uid string, limit int64, window time.Duration) (bool, error) {
+	key := rateLimitID(id, uid, time.Now().UnixNano()/int64(window))
+
+	pipe := s.cl.TxPipeline()
+	incr := pipe.Incr(key)
+	pipe.Expire(key, window)
+	if _, err := pipe.Exec(); err != nil {
+		return false, err
+	}
+
+	return incr.Val() <= limit, nil
+}
+
+var errAccountExists = errors.New("redis: account already exists")
+
+// CreateAccount saves new account, failing if uid is already taken
+func (s *Client) CreateAccount(a *goch.Account) error {
+	data, err := encodeAccount(a)
+	if err != nil {
+		return err
+	}
+	ok, err := s.cl.SetNX(accountID(a.UID), data, 0).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errAccountExists
+	}
+	return nil
+}
+
+// SaveAccount updates existing account
+func (s *Client) SaveAccount(a *goch.Account) error {
+	data, err := encodeAccount(a)
+	if err != nil {
+		return err
+	}
+	return s.cl.Set(accountID(a.UID), data, 0).Err()
+}
+
+// GetAccount returns account along with list of channels it has joined
+func (s *Client) GetAccount(uid string) (*goch.Account, error) {
+	val, err := s.cl.Get(accountID(uid)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := goch.DecodeAccount([]byte(val))
+	if err != nil {
+		return nil, err
+	}
+
+	if a.Channels, err = s.cl.SMembers(accountChannelsID(uid)).Result(); err != nil {
+		return nil, err
+	}
+	sort.Strings(a.Channels)
+
+	return a, nil
+}
+
+// AddAccountChannel records that account has joined a channel
+func (s *Client) AddAccountChannel(uid, id string) error {
+	return s.cl.SAdd(accountChannelsID(uid), id).Err()
+}
+
+// RemoveAccountChannel records that account is no longer member of a channel
+func (s *Client) RemoveAccountChannel(uid, id string) error {
+	return s.cl.SRem(accountChannelsID(uid), id).Err()
+}
+
+// encodeAccount encodes account without channels, which are kept in a separate set
+func encodeAccount(a *goch.Account) ([]byte, error) {
+	ac := *a
+	ac.Channels = nil
+	return ac.Encode()
+}
+
 func chatID(id string) string {
 	return fmt.Sprintf("%s.%s", chatPrefix, id)
 }
@@ -209,6 +1516,54 @@ func chatHistoryID(id string) string {
 	return fmt.Sprintf("%s.%s.%s", historyPrefix, chatPrefix, id)
 }
 
+func chatThreadID(id string, parent uint64) string {
+	return fmt.Sprintf("%s.%s.%s.%d", threadPrefix, chatPrefix, id, parent)
+}
+
+func chatRepliesID(id string, parent uint64) string {
+	return fmt.Sprintf("%s.%s.%s.%d", repliesPrefix, chatPrefix, id, parent)
+}
+
+func chatReactionsID(id string, seq uint64) string {
+	return fmt.Sprintf("%s.%s.%s.%d", reactionsPrefix, chatPrefix, id, seq)
+}
+
+func chatReactionID(id string, seq uint64, emoji string) string {
+	return fmt.Sprintf("%s.%s", chatReactionsID(id, seq), emoji)
+}
+
+func chatAttachmentsID(id string) string {
+	return fmt.Sprintf("%s.%s.%s", attachmentsPrefix, chatPrefix, id)
+}
+
+func chatAttachmentMsgsID(id string) string {
+	return fmt.Sprintf("%s.%s.%s", attachmentMsgsPrefix, chatPrefix, id)
+}
+
+func chatAttachmentRefsID(id string) string {
+	return fmt.Sprintf("%s.%s.%s", attachmentRefsPrefix, chatPrefix, id)
+}
+
+func chatActivityID(id string) string {
+	return fmt.Sprintf("%s.%s.%s", chatActivityPrefix, chatPrefix, id)
+}
+
+func chatInvitesID(id string) string {
+	return fmt.Sprintf("%s.%s.%s", invitesPrefix, chatPrefix, id)
+}
+
+func chatWebhooksID(id string) string {
+	return fmt.Sprintf("%s.%s.%s", webhooksPrefix, chatPrefix, id)
+}
+
+func chatDeadLettersID(id string) string {
+	return fmt.Sprintf("%s.%s.%s", deadLettersPrefix, chatPrefix, id)
+}
+
+func chatPinsID(id string) string {
+	return fmt.Sprintf("%s.%s.%s", pinsPrefix, chatPrefix, id)
+}
+
 func chatLastSeqID(id string) string {
 	return fmt.Sprintf("%s.%s.%s", chatLastSeqPrefix, chatPrefix, id)
 }
@@ -216,3 +1571,68 @@ func chatLastSeqID(id string) string {
 func chatClientLastSeqID(uid, id string) string {
 	return fmt.Sprintf("%s.%s.%s", chatClientLastSeqPrefix, uid, id)
 }
+
+func chatClientMentionID(uid, id string) string {
+	return fmt.Sprintf("%s.%s.%s", chatClientMentionPrefix, uid, id)
+}
+
+func directListID(uid string) string {
+	return fmt.Sprintf("%s.%s", directListPrefix, uid)
+}
+
+func presenceID(id, uid string) string {
+	return fmt.Sprintf("%s.%s.%s.%s", presencePrefix, chatPrefix, id, uid)
+}
+
+func presenceConnsID(id, uid string) string {
+	return fmt.Sprintf("%s.%s.%s.%s", presenceConnsPrefix, chatPrefix, id, uid)
+}
+
+func chatScheduledID(id string) string {
+	return fmt.Sprintf("%s.%s.%s", scheduledPrefix, chatPrefix, id)
+}
+
+func scheduledSentID(id, smID string) string {
+	return fmt.Sprintf("%s.%s.%s.%s", scheduledSentPrefix, chatPrefix, id, smID)
+}
+
+// chatMember returns member of sorted sets, such as scheduled and expiring
+// messages, identifying an item of chat id by fields. Chat names can not
+// contain dots, so chat id is always the part before the first one.
+func chatMember(id string, fields ...string) string {
+	return strings.Join(append([]string{id}, fields...), ".")
+}
+
+// parseChatMember returns chat id and fields encoded in member m
+func parseChatMember(m string) (string, []string) {
+	parts := strings.Split(m, ".")
+	return parts[0], parts[1:]
+}
+
+func unixMilli(nsec int64) int64 {
+	return nsec / int64(time.Millisecond)
+}
+
+func rateLimitID(id, uid string, window int64) string {
+	return fmt.Sprintf("%s.%s.%s.%s.%d", rateLimitPrefix, chatPrefix, id, uid, window)
+}
+
+func accountID(uid string) string {
+	return fmt.Sprintf("%s.%s", accountPrefix, uid)
+}
+
+func accountChannelsID(uid string) string {
+	return fmt.Sprintf("%s.%s", accountChannelsPrefix, uid)
+}
+
+func searchDocsID(id string) string {
+	return fmt.Sprintf("%s.%s.%s", searchDocsPrefix, chatPrefix, id)
+}
+
+func searchSeqsID(id string) string {
+	return fmt.Sprintf("%s.%s.%s", searchSeqsPrefix, chatPrefix, id)
+}
+
+func searchTermID(id, term string) string {
+	return fmt.Sprintf("%s.%s.%s.%s", searchTermsPrefix, chatPrefix, id, term)
+}
@@ -0,0 +1,225 @@
+package redis
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/ribice/goch"
+	"github.com/ribice/goch/pkg/search"
+)
+
+// searchBatch is number of indexed messages fetched at once while searching
+const searchBatch = 100
+
+// SearchIndex represents message search index kept in Redis, so it is shared
+// between goch instances and kept on restart. Only maxSearchDocs most recent
+// messages of each chat are indexed.
+type SearchIndex struct {
+	cl *redis.Client
+}
+
+// NewSearchIndex creates new search index stored by client c
+func NewSearchIndex(c *Client) *SearchIndex {
+	return &SearchIndex{cl: c.cl}
+}
+
+// Index adds message to chat's index, removing the oldest messages
+// once more than maxSearchDocs are indexed. Messages are added and
+// evicted in a single transaction, retried if index changes meanwhile.
+func (s *SearchIndex) Index(id string, msg *goch.Message) error {
+	data, err := msg.Encode()
+	if err != nil {
+		return err
+	}
+
+	seqsKey := searchSeqsID(id)
+	field := strconv.FormatUint(msg.Seq, 10)
+
+	fn := func(tx *redis.Tx) error {
+		n, err := tx.ZCard(seqsKey).Result()
+		if err != nil {
+			return err
+		}
+
+		if err = tx.ZScore(seqsKey, field).Err(); err == redis.Nil {
+			n++
+		} else if err != nil {
+			return err
+		}
+
+		var (
+			evicted []string
+			docs    []interface{}
+		)
+
+		if n > maxSearchDocs {
+			if evicted, err = tx.ZRange(seqsKey, 0, n-maxSearchDocs-1).Result(); err != nil {
+				return err
+			}
+			if docs, err = tx.HMGet(searchDocsID(id), evicted...).Result(); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+			for i, f := range evicted {
+				var text string
+				if val, ok := docs[i].(string); ok {
+					if doc, err := goch.DecodeMsg([]byte(val)); err == nil {
+						text = doc.Text
+					}
+				}
+				removeDoc(pipe, id, f, text)
+			}
+			addDoc(pipe, id, msg, data)
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < maxTxRetries; i++ {
+		err := s.cl.Watch(fn, seqsKey)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+
+	return redis.TxFailedErr
+}
+
+// Update applies edit or delete event to indexed message.
+// Deleted and expired messages are removed from the index.
+func (s *SearchIndex) Update(id string, ev *goch.Message) error {
+	key := searchDocsID(id)
+	field := strconv.FormatUint(ev.Ref, 10)
+
+	fn := func(tx *redis.Tx) error {
+		val, err := tx.HGet(key, field).Result()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		doc, err := goch.DecodeMsg([]byte(val))
+		if err != nil {
+			return err
+		}
+
+		text := doc.Text
+		if !doc.Apply(ev) {
+			return nil
+		}
+
+		data, err := doc.Encode()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+			removeDoc(pipe, id, field, text)
+			if !doc.Deleted {
+				addDoc(pipe, id, doc, data)
+			}
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < maxTxRetries; i++ {
+		err := s.cl.Watch(fn, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+
+	return redis.TxFailedErr
+}
+
+// Search returns messages in chat matching q, newest first
+func (s *SearchIndex) Search(id string, q search.Query) ([]goch.Message, error) {
+	var (
+		fields []string
+		err    error
+	)
+
+	if terms := q.Terms(); len(terms) > 0 {
+		keys := make([]string, len(terms))
+		for i, t := range terms {
+			keys[i] = searchTermID(id, t)
+		}
+		if fields, err = s.cl.SInter(keys...).Result(); err != nil {
+			return nil, err
+		}
+		sortSeqs(fields)
+	} else if q.Text != "" {
+		// Text holds no words, such as only punctuation
+		return nil, nil
+	} else if fields, err = s.cl.ZRevRange(searchSeqsID(id), 0, -1).Result(); err != nil {
+		return nil, err
+	}
+
+	size := q.Size()
+	// Expired messages are skipped until their expiry is ingested
+	now := time.Now()
+
+	var msgs []goch.Message
+	for len(fields) > 0 && len(msgs) < size {
+		batch := fields
+		if len(batch) > searchBatch {
+			batch = batch[:searchBatch]
+		}
+		fields = fields[len(batch):]
+
+		docs, err := s.cl.HMGet(searchDocsID(id), batch...).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, d := range docs {
+			val, ok := d.(string)
+			if !ok {
+				continue
+			}
+			doc, err := goch.DecodeMsg([]byte(val))
+			if err != nil || doc.IsExpired(now) || !q.Matches(doc) {
+				continue
+			}
+			msgs = append(msgs, *doc)
+			if len(msgs) == size {
+				break
+			}
+		}
+	}
+
+	return msgs, nil
+}
+
+func addDoc(pipe redis.Pipeliner, id string, doc *goch.Message, data []byte) {
+	field := strconv.FormatUint(doc.Seq, 10)
+	pipe.HSet(searchDocsID(id), field, data)
+	pipe.ZAdd(searchSeqsID(id), redis.Z{Score: float64(doc.Seq), Member: field})
+	for _, t := range search.Terms(doc.Text) {
+		pipe.SAdd(searchTermID(id, t), field)
+	}
+}
+
+func removeDoc(pipe redis.Pipeliner, id, field, text string) {
+	pipe.HDel(searchDocsID(id), field)
+	pipe.ZRem(searchSeqsID(id), field)
+	for _, t := range search.Terms(text) {
+		pipe.SRem(searchTermID(id, t), field)
+	}
+}
+
+// sortSeqs sorts message sequences in descending order
+func sortSeqs(seqs []string) {
+	sort.Slice(seqs, func(i, j int) bool {
+		a, _ := strconv.ParseUint(seqs[i], 10, 64)
+		b, _ := strconv.ParseUint(seqs[j], 10, 64)
+		return a > b
+	})
+}
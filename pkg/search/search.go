@@ -0,0 +1,255 @@
+// Package search provides full-text search over chat messages, with
+// an in-memory index and queries shared by other index implementations
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/ribice/goch"
+)
+
+// Default and max number of results returned by a search
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// Query represents message search query. All provided filters have to match.
+type Query struct {
+	Text    string            // Words contained in message text
+	FromUID string            // Message author
+	Since   int64             // Min message time, in UnixNano
+	Until   int64             // Max message time, in UnixNano
+	Meta    map[string]string // Meta values message has to hold
+	Limit   int
+}
+
+// Size returns max number of results query returns,
+// DefaultLimit if Limit is not set or out of range
+func (q *Query) Size() int {
+	if q.Limit <= 0 || q.Limit > MaxLimit {
+		return DefaultLimit
+	}
+	return q.Limit
+}
+
+// Terms returns words message text has to contain to match q
+func (q *Query) Terms() []string {
+	return Terms(q.Text)
+}
+
+// Matches checks whether m matches q's filters other than text,
+// which is matched by index using message Terms
+func (q *Query) Matches(m *goch.Message) bool {
+	if q.FromUID != "" && m.FromUID != q.FromUID {
+		return false
+	}
+	if q.Since != 0 && m.Time < q.Since {
+		return false
+	}
+	if q.Until != 0 && m.Time > q.Until {
+		return false
+	}
+	for k, v := range q.Meta {
+		if mv, ok := m.Meta[k]; !ok || mv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Terms splits text into unique lowercase words it is indexed by
+func Terms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := make(map[string]bool, len(words))
+	terms := words[:0]
+	for _, w := range words {
+		if !seen[w] {
+			seen[w] = true
+			terms = append(terms, w)
+		}
+	}
+	return terms
+}
+
+// MaxDocs is the max number of most recent messages indexed per chat
+const MaxDocs = 10000
+
+// Memory represents search index kept in memory. Each instance only
+// indexes messages it ingested, and the index is lost on restart.
+// Only MaxDocs most recent messages of each chat are indexed.
+type Memory struct {
+	mu    sync.RWMutex
+	chats map[string]*chatIndex
+}
+
+type chatIndex struct {
+	docs  map[uint64]*goch.Message
+	terms map[string]map[uint64]struct{}
+	seqs  []uint64 // Indexed sequences in order of indexing, oldest first
+}
+
+// NewMemory creates new in-memory search index
+func NewMemory() *Memory {
+	return &Memory{chats: make(map[string]*chatIndex)}
+}
+
+// Index adds message to chat's index, removing the oldest messages
+// once more than MaxDocs are indexed
+func (m *Memory) Index(id string, msg *goch.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ci, ok := m.chats[id]
+	if !ok {
+		ci = &chatIndex{
+			docs:  make(map[uint64]*goch.Message),
+			terms: make(map[string]map[uint64]struct{}),
+		}
+		m.chats[id] = ci
+	}
+
+	doc := *msg
+	if old, ok := ci.docs[doc.Seq]; ok {
+		ci.remove(old)
+	} else {
+		ci.seqs = append(ci.seqs, doc.Seq)
+	}
+	ci.add(&doc)
+	ci.evict()
+
+	return nil
+}
+
+// Update applies edit or delete event to indexed message.
+// Deleted and expired messages are removed from the index.
+func (m *Memory) Update(id string, ev *goch.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ci, ok := m.chats[id]
+	if !ok {
+		return nil
+	}
+
+	doc, ok := ci.docs[ev.Ref]
+	if !ok {
+		return nil
+	}
+
+	ci.remove(doc)
+
+	if doc.Apply(ev) && !doc.Deleted {
+		ci.add(doc)
+	}
+
+	return nil
+}
+
+// Search returns messages in chat matching q, newest first
+func (m *Memory) Search(id string, q Query) ([]goch.Message, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ci, ok := m.chats[id]
+	if !ok {
+		return nil, nil
+	}
+
+	var seqs []uint64
+	if terms := q.Terms(); len(terms) > 0 {
+		seqs = ci.match(terms)
+	} else if q.Text != "" {
+		// Text holds no words, such as only punctuation
+		return nil, nil
+	} else {
+		for seq := range ci.docs {
+			seqs = append(seqs, seq)
+		}
+	}
+
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] > seqs[j] })
+
+	size := q.Size()
+	// Expired messages are skipped until their expiry is ingested
+	now := time.Now()
+
+	var msgs []goch.Message
+	for _, seq := range seqs {
+		if doc := ci.docs[seq]; !doc.IsExpired(now) && q.Matches(doc) {
+			msgs = append(msgs, *doc)
+			if len(msgs) == size {
+				break
+			}
+		}
+	}
+
+	return msgs, nil
+}
+
+func (ci *chatIndex) add(doc *goch.Message) {
+	ci.docs[doc.Seq] = doc
+	for _, t := range Terms(doc.Text) {
+		if ci.terms[t] == nil {
+			ci.terms[t] = make(map[uint64]struct{})
+		}
+		ci.terms[t][doc.Seq] = struct{}{}
+	}
+}
+
+func (ci *chatIndex) remove(doc *goch.Message) {
+	delete(ci.docs, doc.Seq)
+	for _, t := range Terms(doc.Text) {
+		delete(ci.terms[t], doc.Seq)
+		if len(ci.terms[t]) == 0 {
+			delete(ci.terms, t)
+		}
+	}
+}
+
+// evict removes the oldest messages exceeding MaxDocs from the index.
+// Sequences of messages removed on delete are dropped along the way.
+func (ci *chatIndex) evict() {
+	for len(ci.docs) > MaxDocs {
+		seq := ci.seqs[0]
+		ci.seqs = ci.seqs[1:]
+		if doc, ok := ci.docs[seq]; ok {
+			ci.remove(doc)
+		}
+	}
+
+	if len(ci.seqs) > 2*MaxDocs {
+		seqs := make([]uint64, 0, len(ci.docs))
+		for _, seq := range ci.seqs {
+			if _, ok := ci.docs[seq]; ok {
+				seqs = append(seqs, seq)
+			}
+		}
+		ci.seqs = seqs
+	}
+}
+
+// match returns sequences of messages containing all terms
+func (ci *chatIndex) match(terms []string) []uint64 {
+	var seqs []uint64
+	for seq := range ci.terms[terms[0]] {
+		found := true
+		for _, t := range terms[1:] {
+			if _, ok := ci.terms[t][seq]; !ok {
+				found = false
+				break
+			}
+		}
+		if found {
+			seqs = append(seqs, seq)
+		}
+	}
+	return seqs
+}
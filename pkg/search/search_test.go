@@ -0,0 +1,172 @@
+package search_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ribice/goch"
+	"github.com/ribice/goch/pkg/search"
+)
+
+func TestTerms(t *testing.T) {
+	cases := []struct {
+		text string
+		want []string
+	}{
+		{text: ""},
+		{text: "?!"},
+		{text: "Deploy is done!", want: []string{"deploy", "is", "done"}},
+		{text: "deploy failed, DEPLOY again", want: []string{"deploy", "failed", "again"}},
+		{text: "Zoë's v2.1", want: []string{"zoë", "s", "v2", "1"}},
+	}
+	for _, tc := range cases {
+		got := search.Terms(tc.text)
+		if len(got) == 0 && len(tc.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("expected terms of %q to be %v, got %v", tc.text, tc.want, got)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	m := &goch.Message{Seq: 2, Time: 200, FromUID: "jane", Text: "deploy failed", Meta: map[string]string{"env": "prod"}}
+	cases := []struct {
+		name string
+		q    search.Query
+		want bool
+	}{
+		{name: "No filters", want: true},
+		{name: "Text is matched by index", q: search.Query{Text: "lunch"}, want: true},
+		{name: "Author", q: search.Query{FromUID: "jane"}, want: true},
+		{name: "Other author", q: search.Query{FromUID: "john"}},
+		{name: "Time range", q: search.Query{Since: 200, Until: 300}, want: true},
+		{name: "Before time range", q: search.Query{Since: 300}},
+		{name: "After time range", q: search.Query{Until: 100}},
+		{name: "Meta", q: search.Query{Meta: map[string]string{"env": "prod"}}, want: true},
+		{name: "Other meta", q: search.Query{Meta: map[string]string{"env": "dev"}}},
+		{name: "Missing meta", q: search.Query{Meta: map[string]string{"team": "ops"}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.q.Matches(m); got != tc.want {
+				t.Errorf("expected match to be %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSize(t *testing.T) {
+	for limit, want := range map[int]int{0: search.DefaultLimit, 5: 5, search.MaxLimit: search.MaxLimit, search.MaxLimit + 1: search.DefaultLimit} {
+		q := search.Query{Limit: limit}
+		if got := q.Size(); got != want {
+			t.Errorf("expected size of query with limit %d to be %d, got %d", limit, want, got)
+		}
+	}
+}
+
+func TestMemory(t *testing.T) {
+	idx := search.NewMemory()
+	msgs := []goch.Message{
+		{Seq: 1, Time: 100, FromUID: "john", Text: "Deploy is done!"},
+		{Seq: 2, Time: 200, FromUID: "jane", Text: "deploy failed, rolling back", Meta: map[string]string{"env": "prod"}},
+		{Seq: 3, Time: 300, FromUID: "john", Text: "Lunch?"},
+		{Seq: 4, Time: 400, FromUID: "jane", Text: "second deploy is done", Meta: map[string]string{"env": "prod"}},
+		{Seq: 5, Time: 450, FromUID: "john", Text: "deploy secret, expiring", ExpiresAt: 460},
+	}
+	for i := range msgs {
+		if err := idx.Index("general", &msgs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	idx.Index("random", &goch.Message{Seq: 1, Text: "deploy"})
+
+	idx.Update("general", &goch.Message{Type: goch.EditMessage, Ref: 3, Text: "Lunch after deploy?", Time: 500})
+	idx.Update("general", &goch.Message{Type: goch.DeleteMessage, Ref: 1, Time: 600})
+
+	cases := []struct {
+		name string
+		chat string
+		q    search.Query
+		want []uint64
+	}{
+		{
+			name: "Unknown chat",
+			chat: "unknown",
+			q:    search.Query{Text: "deploy"},
+		},
+		{
+			name: "Text",
+			chat: "general",
+			q:    search.Query{Text: "DEPLOY"},
+			want: []uint64{4, 3, 2},
+		},
+		{
+			name: "All words",
+			chat: "general",
+			q:    search.Query{Text: "deploy done"},
+			want: []uint64{4},
+		},
+		{
+			name: "Text without words",
+			chat: "general",
+			q:    search.Query{Text: "?!"},
+		},
+		{
+			name: "Author",
+			chat: "general",
+			q:    search.Query{Text: "deploy", FromUID: "john"},
+			want: []uint64{3},
+		},
+		{
+			name: "Time range",
+			chat: "general",
+			q:    search.Query{Since: 200, Until: 300},
+			want: []uint64{3, 2},
+		},
+		{
+			name: "Meta",
+			chat: "general",
+			q:    search.Query{Meta: map[string]string{"env": "prod"}},
+			want: []uint64{4, 2},
+		},
+		{
+			name: "Limit",
+			chat: "general",
+			q:    search.Query{Text: "deploy", Limit: 1},
+			want: []uint64{4},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := idx.Search(tc.chat, tc.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []uint64
+			for _, m := range res {
+				got = append(got, m.Seq)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected messages %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestMemoryMaxDocs(t *testing.T) {
+	idx := search.NewMemory()
+	for seq := uint64(1); seq <= search.MaxDocs+2; seq++ {
+		idx.Index("general", &goch.Message{Seq: seq, Time: int64(seq), Text: "deploy"})
+	}
+
+	res, err := idx.Search("general", search.Query{Text: "deploy", Until: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].Seq != 3 {
+		t.Errorf("expected oldest messages to be evicted, got %+v", res)
+	}
+}
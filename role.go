@@ -0,0 +1,133 @@
+package goch
+
+import (
+	"errors"
+	"time"
+)
+
+// Role represents member's role in a chat
+type Role int
+
+// Role constants, ordered by rank
+const (
+	GuestRole Role = iota - 1
+	MemberRole
+	ModeratorRole
+	OwnerRole
+)
+
+// Permission represents an action member can take in a chat
+type Permission int
+
+// Permission constants
+const (
+	PostPerm Permission = iota + 1
+	InvitePerm
+	TopicPerm
+	KickPerm
+	RolePerm
+	DeletePerm
+	ReadPerm
+	ArchivePerm
+	BanPerm
+	MutePerm
+	PinPerm
+)
+
+var rolePerms = map[Role][]Permission{
+	GuestRole:     {ReadPerm},
+	MemberRole:    {ReadPerm, PostPerm},
+	ModeratorRole: {ReadPerm, PostPerm, InvitePerm, TopicPerm, KickPerm, DeletePerm, BanPerm, MutePerm, PinPerm},
+	OwnerRole:     {ReadPerm, PostPerm, InvitePerm, TopicPerm, KickPerm, DeletePerm, BanPerm, MutePerm, PinPerm, RolePerm, ArchivePerm},
+}
+
+var roleNames = map[Role]string{
+	GuestRole:     "guest",
+	MemberRole:    "member",
+	ModeratorRole: "moderator",
+	OwnerRole:     "owner",
+}
+
+// Role errors
+var (
+	errInvalidRole = errors.New("chat: invalid role")
+	errForbidden   = errors.New("chat: insufficient permissions")
+	errArchived    = errors.New("chat: channel is archived")
+)
+
+// ParseRole returns role for provided name
+func ParseRole(name string) (Role, error) {
+	for r, n := range roleNames {
+		if n == name {
+			return r, nil
+		}
+	}
+	return MemberRole, errInvalidRole
+}
+
+// String returns role name
+func (r Role) String() string {
+	return roleNames[r]
+}
+
+// Can checks whether role has permission p
+func (r Role) Can(p Permission) bool {
+	for _, rp := range rolePerms[r] {
+		if rp == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize checks whether uid is allowed to perform p in chat.
+// Archived chats only allow reading and unarchiving, and muted
+// members are not allowed to post.
+func (c *Chat) Authorize(uid string, p Permission) error {
+	if c.IsBanned(uid) {
+		return errBanned
+	}
+	u, ok := c.Members[uid]
+	if !ok {
+		return errNotRegistered
+	}
+	if !u.Role.Can(p) {
+		return errForbidden
+	}
+	if c.Archived && p != ReadPerm && p != ArchivePerm {
+		return errArchived
+	}
+	if p == PostPerm {
+		return c.muted(uid, time.Now())
+	}
+	return nil
+}
+
+// AuthorizeOn checks whether uid is allowed to perform p on target member.
+// Besides having the permission, uid has to outrank the target.
+func (c *Chat) AuthorizeOn(uid, target string, p Permission) error {
+	if err := c.Authorize(uid, p); err != nil {
+		return err
+	}
+	t, ok := c.Members[target]
+	if !ok {
+		return errNotRegistered
+	}
+	if c.Members[uid].Role <= t.Role {
+		return errForbidden
+	}
+	return nil
+}
+
+// SetRole changes role of a chat member
+func (c *Chat) SetRole(uid string, r Role) error {
+	if _, ok := roleNames[r]; !ok {
+		return errInvalidRole
+	}
+	u, ok := c.Members[uid]
+	if !ok {
+		return errNotRegistered
+	}
+	u.Role = r
+	return nil
+}
@@ -0,0 +1,158 @@
+package goch_test
+
+import (
+	"testing"
+
+	"github.com/ribice/goch"
+)
+
+func TestParseRole(t *testing.T) {
+	r, err := goch.ParseRole("moderator")
+	if err != nil || r != goch.ModeratorRole {
+		t.Errorf("expected moderator role but got %v (%v)", r, err)
+	}
+	if r.String() != "moderator" {
+		t.Errorf("expected role name moderator but got %s", r.String())
+	}
+	if _, err := goch.ParseRole("admin"); err == nil {
+		t.Error("expected error but received nil")
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	c := &goch.Chat{
+		Members: map[string]*goch.User{
+			"guest":  {Role: goch.GuestRole},
+			"member": {},
+			"mod":    {Role: goch.ModeratorRole},
+			"owner":  {Role: goch.OwnerRole},
+		},
+	}
+	cases := []struct {
+		name    string
+		uid     string
+		target  string
+		perm    goch.Permission
+		wantErr string
+	}{
+		{
+			name:    "Not registered",
+			uid:     "stranger",
+			perm:    goch.PostPerm,
+			wantErr: "chat: not a member of this channel",
+		},
+		{
+			name:    "Guest cannot post",
+			uid:     "guest",
+			perm:    goch.PostPerm,
+			wantErr: "chat: insufficient permissions",
+		},
+		{
+			name: "Member can post",
+			uid:  "member",
+			perm: goch.PostPerm,
+		},
+		{
+			name:    "Member cannot pin",
+			uid:     "member",
+			perm:    goch.PinPerm,
+			wantErr: "chat: insufficient permissions",
+		},
+		{
+			name: "Moderator can pin",
+			uid:  "mod",
+			perm: goch.PinPerm,
+		},
+		{
+			name:    "Member cannot kick",
+			uid:     "member",
+			target:  "guest",
+			perm:    goch.KickPerm,
+			wantErr: "chat: insufficient permissions",
+		},
+		{
+			name:   "Moderator can kick member",
+			uid:    "mod",
+			target: "member",
+			perm:   goch.KickPerm,
+		},
+		{
+			name:    "Moderator cannot kick owner",
+			uid:     "mod",
+			target:  "owner",
+			perm:    goch.KickPerm,
+			wantErr: "chat: insufficient permissions",
+		},
+		{
+			name:    "Moderator cannot change roles",
+			uid:     "mod",
+			target:  "member",
+			perm:    goch.RolePerm,
+			wantErr: "chat: insufficient permissions",
+		},
+		{
+			name:    "Target not registered",
+			uid:     "owner",
+			target:  "stranger",
+			perm:    goch.RolePerm,
+			wantErr: "chat: not a member of this channel",
+		},
+		{
+			name:   "Owner can change roles",
+			uid:    "owner",
+			target: "mod",
+			perm:   goch.RolePerm,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var err error
+			if tc.target == "" {
+				err = c.Authorize(tc.uid, tc.perm)
+			} else {
+				err = c.AuthorizeOn(tc.uid, tc.target, tc.perm)
+			}
+			if (err != nil) != (tc.wantErr != "") || (err != nil && err.Error() != tc.wantErr) {
+				t.Errorf("expected err %q but got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSetRole(t *testing.T) {
+	c := &goch.Chat{
+		Members: map[string]*goch.User{
+			"member": {},
+		},
+	}
+	if err := c.SetRole("stranger", goch.ModeratorRole); err == nil {
+		t.Error("expected error but received nil")
+	}
+	if err := c.SetRole("member", goch.Role(42)); err == nil {
+		t.Error("expected error but received nil")
+	}
+	if err := c.SetRole("member", goch.ModeratorRole); err != nil {
+		t.Errorf("did not expect error but received: %v", err)
+	}
+	if c.Members["member"].Role != goch.ModeratorRole {
+		t.Errorf("expected moderator role but got %v", c.Members["member"].Role)
+	}
+}
+
+func TestAuthorizeArchived(t *testing.T) {
+	c := &goch.Chat{
+		Archived: true,
+		Members: map[string]*goch.User{
+			"owner": {Role: goch.OwnerRole},
+		},
+	}
+	if err := c.Authorize("owner", goch.ReadPerm); err != nil {
+		t.Errorf("did not expect error but received: %v", err)
+	}
+	if err := c.Authorize("owner", goch.ArchivePerm); err != nil {
+		t.Errorf("did not expect error but received: %v", err)
+	}
+	if err := c.Authorize("owner", goch.PostPerm); err == nil || err.Error() != "chat: channel is archived" {
+		t.Errorf("expected archived error but received: %v", err)
+	}
+}
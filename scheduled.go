@@ -0,0 +1,61 @@
+package goch
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+// MaxScheduleAhead is the furthest in the future a message can be scheduled
+const MaxScheduleAhead = 30 * 24 * time.Hour
+
+// Scheduled represents message scheduled to be sent at a later time
+type Scheduled struct {
+	ID        string   `json:"id"`
+	Channel   string   `json:"channel"`
+	Message   *Message `json:"message"`
+	SendAt    int64    `json:"send_at"`
+	CreatedAt int64    `json:"created_at"`
+	Attempts  int      `json:"attempts,omitempty"`
+}
+
+// Scheduled message errors
+var (
+	errScheduledPast = errors.New("schedule: send_at must be in the future")
+	errScheduledFar  = fmt.Errorf("schedule: messages can be scheduled at most %d days ahead", int(MaxScheduleAhead.Hours()/24))
+)
+
+// NewScheduled schedules message m to be sent to channel at sendAt (UnixNano)
+func NewScheduled(channel string, m *Message, sendAt int64) (*Scheduled, error) {
+	now := time.Now()
+	if sendAt <= now.UnixNano() {
+		return nil, errScheduledPast
+	}
+	if sendAt > now.Add(MaxScheduleAhead).UnixNano() {
+		return nil, errScheduledFar
+	}
+
+	return &Scheduled{
+		ID:        xid.New().String(),
+		Channel:   channel,
+		Message:   m,
+		SendAt:    sendAt,
+		CreatedAt: now.UnixNano(),
+	}, nil
+}
+
+// DecodeScheduled tries to decode binary formatted scheduled message in b to Scheduled
+func DecodeScheduled(b []byte) (*Scheduled, error) {
+	var s Scheduled
+	if err := decode(b, &s); err != nil {
+		return nil, fmt.Errorf("schedule: unable to unmarshal scheduled message: %v", err)
+	}
+	return &s, nil
+}
+
+// Encode encodes provided scheduled message in binary format using DefaultCodec
+func (s *Scheduled) Encode() ([]byte, error) {
+	return encode(s)
+}
@@ -0,0 +1,38 @@
+package goch_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ribice/goch"
+)
+
+func TestNewScheduled(t *testing.T) {
+	m := &goch.Message{Text: "hello", FromUID: "john"}
+	now := time.Now()
+
+	if _, err := goch.NewScheduled("general", m, now.Add(-time.Minute).UnixNano()); err == nil {
+		t.Error("expected error scheduling message in the past")
+	}
+	if _, err := goch.NewScheduled("general", m, now.Add(goch.MaxScheduleAhead+time.Hour).UnixNano()); err == nil {
+		t.Error("expected error scheduling message too far ahead")
+	}
+
+	sm, err := goch.NewScheduled("general", m, now.Add(time.Hour).UnixNano())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sm.ID == "" || sm.Channel != "general" || sm.Message != m {
+		t.Errorf("unexpected scheduled message %+v", sm)
+	}
+
+	bts, err := sm.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, err := goch.DecodeScheduled(bts)
+	if err != nil || !reflect.DeepEqual(dec, sm) {
+		t.Errorf("expected scheduled message %+v but got %+v (%v)", sm, dec, err)
+	}
+}
@@ -1,9 +1,59 @@
 package goch
 
+import (
+	"crypto/subtle"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
 // User represents user entity
 type User struct {
 	UID         string `json:"uid"`
 	DisplayName string `json:"display_name"`
 	Email       string `json:"email"`
-	Secret      string `json:"secret"`
+	Secret      string `json:"secret,omitempty"` // Plaintext secret, only present on users registered before secrets were hashed
+	SecretHash  []byte `json:"secret_hash,omitempty"`
+	Role        Role   `json:"role"`
+	Account     bool   `json:"account,omitempty"` // Profile and credentials are kept in user's Account
+	Bot         bool   `json:"bot,omitempty"`     // Posts over HTTP with an API token, cannot connect
+}
+
+// SecretHashCost is bcrypt cost used for hashing user secrets
+var SecretHashCost = bcrypt.DefaultCost
+
+// SetSecret hashes secret and stores it on user, removing plaintext secret if any
+func (u *User) SetSecret(secret string) error {
+	h, err := hashSecret(secret)
+	if err != nil {
+		return err
+	}
+	u.SecretHash = h
+	u.Secret = ""
+	return nil
+}
+
+// VerifySecret checks whether secret matches user's secret in constant time
+func (u *User) VerifySecret(secret string) bool {
+	if len(u.SecretHash) > 0 {
+		return verifySecret(u.SecretHash, secret)
+	}
+	if u.Secret == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(u.Secret), []byte(secret)) == 1
+}
+
+// public returns copy of user without credentials
+func (u *User) public() *User {
+	uc := *u
+	uc.Secret, uc.SecretHash = "", nil
+	return &uc
+}
+
+func hashSecret(secret string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(secret), SecretHashCost)
+}
+
+func verifySecret(hash []byte, secret string) bool {
+	return bcrypt.CompareHashAndPassword(hash, []byte(secret)) == nil
 }
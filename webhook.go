@@ -0,0 +1,156 @@
+package goch
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+// Webhook event names
+const (
+	MessageWebhookEvent  = "message"
+	ReplyWebhookEvent    = "reply"
+	EditWebhookEvent     = "edit"
+	DeleteWebhookEvent   = "delete"
+	ReactionWebhookEvent = "reaction"
+	PinWebhookEvent      = "pin"
+	ExpireWebhookEvent   = "expire"
+)
+
+var webhookEvents = map[string]bool{
+	MessageWebhookEvent:  true,
+	ReplyWebhookEvent:    true,
+	EditWebhookEvent:     true,
+	DeleteWebhookEvent:   true,
+	ReactionWebhookEvent: true,
+	PinWebhookEvent:      true,
+	ExpireWebhookEvent:   true,
+}
+
+var errInvalidWebhookEvent = errors.New("webhook: events must be one of message, reply, edit, delete, reaction, pin or expire")
+
+// Webhook represents outgoing webhook subscribed to chat messages
+type Webhook struct {
+	ID        string   `json:"id"`
+	Channel   string   `json:"channel"`
+	URL       string   `json:"url"`
+	Secret    string   `json:"secret,omitempty"` // Used for signing payloads
+	Events    []string `json:"events"`           // Empty if subscribed to all events
+	CreatedAt int64    `json:"created_at"`
+}
+
+// DeadLetter represents message which could not be delivered to a webhook
+type DeadLetter struct {
+	WebhookID string   `json:"webhook_id"`
+	URL       string   `json:"url"`
+	Event     string   `json:"event"`
+	Message   *Message `json:"message"`
+	Attempts  int      `json:"attempts"`
+	Error     string   `json:"error"`
+	FailedAt  int64    `json:"failed_at"`
+}
+
+// NewWebhook creates new webhook for a channel, subscribed to provided
+// events. Webhook is subscribed to all events if none are provided.
+func NewWebhook(channel, url string, events []string) (*Webhook, error) {
+	for _, e := range events {
+		if !webhookEvents[e] {
+			return nil, errInvalidWebhookEvent
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("webhook: unable to generate secret: %v", err)
+	}
+
+	return &Webhook{
+		ID:        xid.New().String(),
+		Channel:   channel,
+		URL:       url,
+		Secret:    hex.EncodeToString(secret),
+		Events:    events,
+		CreatedAt: time.Now().UnixNano(),
+	}, nil
+}
+
+// WebhookEvent returns name of webhook event message m represents
+func WebhookEvent(m *Message) string {
+	switch m.Type {
+	case EditMessage:
+		return EditWebhookEvent
+	case DeleteMessage:
+		return DeleteWebhookEvent
+	case ReactMessage, UnreactMessage:
+		return ReactionWebhookEvent
+	case PinMessage, UnpinMessage:
+		return PinWebhookEvent
+	case ExpireMessage:
+		return ExpireWebhookEvent
+	}
+	if m.IsReply() {
+		return ReplyWebhookEvent
+	}
+	return MessageWebhookEvent
+}
+
+// Subscribed checks whether webhook is subscribed to event
+func (w *Webhook) Subscribed(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns hex encoded HMAC-SHA256 signature of payload
+func (w *Webhook) Sign(payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.Secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Public returns copy of webhook without its secret
+func (w *Webhook) Public() *Webhook {
+	pw := *w
+	pw.Secret = ""
+	return &pw
+}
+
+// DecodeWebhook tries to decode binary formatted webhook in b to Webhook
+func DecodeWebhook(b []byte) (*Webhook, error) {
+	var w Webhook
+	if err := decode(b, &w); err != nil {
+		return nil, fmt.Errorf("webhook: unable to unmarshal webhook: %v", err)
+	}
+	return &w, nil
+}
+
+// Encode encodes provided webhook in binary format using DefaultCodec
+func (w *Webhook) Encode() ([]byte, error) {
+	return encode(w)
+}
+
+// DecodeDeadLetter tries to decode binary formatted dead letter in b to DeadLetter
+func DecodeDeadLetter(b []byte) (*DeadLetter, error) {
+	var dl DeadLetter
+	if err := decode(b, &dl); err != nil {
+		return nil, fmt.Errorf("webhook: unable to unmarshal dead letter: %v", err)
+	}
+	return &dl, nil
+}
+
+// Encode encodes provided dead letter in binary format using DefaultCodec
+func (dl *DeadLetter) Encode() ([]byte, error) {
+	return encode(dl)
+}
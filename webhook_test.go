@@ -0,0 +1,65 @@
+package goch_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/ribice/goch"
+)
+
+func TestNewWebhook(t *testing.T) {
+	if _, err := goch.NewWebhook("channel", "http://localhost", []string{"message", "typing"}); err == nil {
+		t.Error("expected error but received nil")
+	}
+
+	wh, err := goch.NewWebhook("channel", "http://localhost", []string{"message", "edit"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wh.ID == "" || len(wh.Secret) != 64 || wh.Channel != "channel" {
+		t.Errorf("unexpected webhook %v", wh)
+	}
+
+	if !wh.Subscribed(goch.EditWebhookEvent) || wh.Subscribed(goch.ReplyWebhookEvent) {
+		t.Errorf("unexpected webhook subscriptions %v", wh.Events)
+	}
+
+	if wh.Public().Secret != "" || wh.Secret == "" {
+		t.Error("expected only public copy to have secret cleared")
+	}
+
+	mac := hmac.New(sha256.New, []byte(wh.Secret))
+	mac.Write([]byte("payload"))
+	if wh.Sign([]byte("payload")) != hex.EncodeToString(mac.Sum(nil)) {
+		t.Error("unexpected payload signature")
+	}
+
+	bts, err := wh.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, err := goch.DecodeWebhook(bts)
+	if err != nil || !reflect.DeepEqual(dec, wh) {
+		t.Errorf("expected webhook %v but got %v (%v)", wh, dec, err)
+	}
+}
+
+func TestWebhookEvent(t *testing.T) {
+	cases := map[string]goch.Message{
+		goch.MessageWebhookEvent:  {Text: "hello"},
+		goch.ReplyWebhookEvent:    {Text: "hello", Parent: 1},
+		goch.EditWebhookEvent:     {Type: goch.EditMessage, Ref: 1, Parent: 1},
+		goch.DeleteWebhookEvent:   {Type: goch.DeleteMessage, Ref: 1},
+		goch.ReactionWebhookEvent: {Type: goch.UnreactMessage, Ref: 1},
+		goch.PinWebhookEvent:      {Type: goch.PinMessage, Ref: 1},
+		goch.ExpireWebhookEvent:   {Type: goch.ExpireMessage, Ref: 1},
+	}
+	for want, m := range cases {
+		if got := goch.WebhookEvent(&m); got != want {
+			t.Errorf("expected event %s but got %s", want, got)
+		}
+	}
+}